@@ -0,0 +1,109 @@
+package dstate
+
+import "github.com/jonas747/discordgo"
+
+// ChangeSubscriber is implemented by trackers that can notify about changes to the state
+type ChangeSubscriber interface {
+	// Subscribe calls f with every change applied to the state, without the locks on the state held
+	// so it's safe to query the tracker from within f, trackers may still hold other locks though, see the tracker's docs
+	//
+	// f is called from whichever goroutine is handling events at the time, which is not necessarily the one that caused the change,
+	// and it can be called from several goroutines at once. Changes are only guaranteed to be in order when events are handled from a single goroutine.
+	// You should avoid blocking in f, as it holds up event handling.
+	// returns a function that removes the subscription
+	Subscribe(f func(change StateChange)) (unsubscribe func())
+}
+
+// StateChange is one of the *Change types below
+//
+// Old is nil if the object was added, and New is nil if it was removed
+// both are references to state and should be treated as read only
+type StateChange interface {
+	GetGuildID() int64
+}
+
+var (
+	_ StateChange = (*GuildChange)(nil)
+	_ StateChange = (*ChannelChange)(nil)
+	_ StateChange = (*RoleChange)(nil)
+	_ StateChange = (*EmojisChange)(nil)
+	_ StateChange = (*VoiceStateChange)(nil)
+	_ StateChange = (*MemberChange)(nil)
+	_ StateChange = (*MessageChange)(nil)
+)
+
+// GuildChange is emitted when a guild is created, updated or deleted
+// on guild creates and deletes this is the only change emitted, and not one for each channel, role or member in it
+type GuildChange struct {
+	GuildID int64
+	Old     *GuildState
+	New     *GuildState
+}
+
+func (c *GuildChange) GetGuildID() int64 {
+	return c.GuildID
+}
+
+type ChannelChange struct {
+	GuildID int64
+	Old     *ChannelState
+	New     *ChannelState
+}
+
+func (c *ChannelChange) GetGuildID() int64 {
+	return c.GuildID
+}
+
+type RoleChange struct {
+	GuildID int64
+	Old     *discordgo.Role
+	New     *discordgo.Role
+}
+
+func (c *RoleChange) GetGuildID() int64 {
+	return c.GuildID
+}
+
+// EmojisChange is emitted when the emojis of a guild are updated, as discord sends the full list of emojis each time
+type EmojisChange struct {
+	GuildID int64
+	Old     []discordgo.Emoji
+	New     []discordgo.Emoji
+}
+
+func (c *EmojisChange) GetGuildID() int64 {
+	return c.GuildID
+}
+
+type VoiceStateChange struct {
+	GuildID int64
+	Old     *discordgo.VoiceState
+	New     *discordgo.VoiceState
+}
+
+func (c *VoiceStateChange) GetGuildID() int64 {
+	return c.GuildID
+}
+
+// MemberChange is emitted on member and presence updates
+type MemberChange struct {
+	GuildID int64
+	Old     *MemberState
+	New     *MemberState
+}
+
+func (c *MemberChange) GetGuildID() int64 {
+	return c.GuildID
+}
+
+// MessageChange is emitted when messages are created, updated and deleted
+// deleted messages are still kept in state so in that case New will be the message with Deleted set
+type MessageChange struct {
+	GuildID int64
+	Old     *MessageState
+	New     *MessageState
+}
+
+func (c *MessageChange) GetGuildID() int64 {
+	return c.GuildID
+}
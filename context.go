@@ -0,0 +1,241 @@
+package dstate
+
+import (
+	"context"
+	"strconv"
+)
+
+// ContextStateTracker is a variant of StateTracker for trackers where lookups can fail or take a while, such as remote ones
+//
+// Instead of returning nil, misses are reported as errors:
+// ErrGuildNotFound if the guild is not in the state, and ErrMemberNotCached if the guild is but the member is not
+type ContextStateTracker interface {
+	// GetGuild returns a guild set for the provided guildID, or ErrGuildNotFound
+	GetGuild(ctx context.Context, guildID int64) (*GuildSet, error)
+
+	// GetShardGuilds returns all the guild sets on the shard, or ErrShardNotFound if shardID is out of range
+	// (WithContext can only check that for trackers implementing ShardCounter)
+	GetShardGuilds(ctx context.Context, shardID int64) ([]*GuildSet, error)
+
+	// GetMember returns a member from state, or ErrGuildNotFound or ErrMemberNotCached
+	GetMember(ctx context.Context, guildID int64, memberID int64) (*MemberState, error)
+
+	// GetMessages works like StateTracker.GetMessages, but returns ErrGuildNotFound if the guild is not in the state
+	// a channel without cached messages is not an error
+	GetMessages(ctx context.Context, guildID int64, channelID int64, query *MessagesQuery) ([]*MessageState, error)
+
+	// IterateMembers works like StateTracker.IterateMembers, but stops with ctx.Err() if the context is cancelled between chunks
+	// returns ErrGuildNotFound if the guild is not in the state
+	IterateMembers(ctx context.Context, guildID int64, f func(chunk []*MemberState) bool) error
+}
+
+var _ error = (*ErrMemberNotCached)(nil)
+
+// ErrMemberNotCached means the guild is in the state but the member is not, which does not mean they're not a member
+type ErrMemberNotCached struct {
+	GuildID  int64
+	MemberID int64
+}
+
+func (e *ErrMemberNotCached) Error() string {
+	return "Member not cached: " + strconv.FormatInt(e.MemberID, 10) + " (guild " + strconv.FormatInt(e.GuildID, 10) + ")"
+}
+
+// IsMemberNotCached returns true if a ErrMemberNotCached, and also the MemberID if it was
+func IsMemberNotCached(e error) (bool, int64) {
+	if mn, ok := e.(*ErrMemberNotCached); ok {
+		return true, mn.MemberID
+	}
+
+	return false, 0
+}
+
+var _ error = (*ErrShardNotFound)(nil)
+
+type ErrShardNotFound struct {
+	ShardID int64
+}
+
+func (e *ErrShardNotFound) Error() string {
+	return "Shard not found: " + strconv.FormatInt(e.ShardID, 10)
+}
+
+// IsShardNotFound returns true if a ErrShardNotFound, and also the ShardID if it was
+func IsShardNotFound(e error) (bool, int64) {
+	if sn, ok := e.(*ErrShardNotFound); ok {
+		return true, sn.ShardID
+	}
+
+	return false, 0
+}
+
+// IsMiss returns true if the error is one of the not found or not cached errors, as opposed to a failure
+func IsMiss(e error) bool {
+	switch e.(type) {
+	case *ErrGuildNotFound, *ErrChannelNotFound, *ErrMemberNotCached, *ErrShardNotFound:
+		return true
+	}
+
+	return false
+}
+
+// ShardCounter is implemented by trackers that know their total shard count, such as inmemorytracker.InMemoryTracker
+type ShardCounter interface {
+	TotalShards() int64
+}
+
+// ShardInRange returns false if the tracker implements ShardCounter and shardID is out of range for it,
+// in which case StateTracker.GetShardGuilds would panic
+func ShardInRange(tracker StateTracker, shardID int64) bool {
+	sc, ok := tracker.(ShardCounter)
+	return !ok || (shardID >= 0 && shardID < sc.TotalShards())
+}
+
+// WithContext adapts a StateTracker to a ContextStateTracker
+// the context is only checked before each call, and between chunks in IterateMembers
+func WithContext(tracker StateTracker) ContextStateTracker {
+	if wc, ok := tracker.(*withoutContext); ok {
+		return wc.tracker
+	}
+
+	return &withContext{tracker: tracker}
+}
+
+type withContext struct {
+	tracker StateTracker
+}
+
+var _ ContextStateTracker = (*withContext)(nil)
+
+func (w *withContext) GetGuild(ctx context.Context, guildID int64) (*GuildSet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	gs := w.tracker.GetGuild(guildID)
+	if gs == nil {
+		return nil, &ErrGuildNotFound{GuildID: guildID}
+	}
+
+	return gs, nil
+}
+
+func (w *withContext) GetShardGuilds(ctx context.Context, shardID int64) ([]*GuildSet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// StateTracker.GetShardGuilds panics on unknown shards
+	if !ShardInRange(w.tracker, shardID) {
+		return nil, &ErrShardNotFound{ShardID: shardID}
+	}
+
+	return w.tracker.GetShardGuilds(shardID), nil
+}
+
+func (w *withContext) GetMember(ctx context.Context, guildID int64, memberID int64) (*MemberState, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ms := w.tracker.GetMember(guildID, memberID)
+	if ms != nil {
+		return ms, nil
+	}
+
+	if w.tracker.GetGuild(guildID) == nil {
+		return nil, &ErrGuildNotFound{GuildID: guildID}
+	}
+
+	return nil, &ErrMemberNotCached{GuildID: guildID, MemberID: memberID}
+}
+
+func (w *withContext) GetMessages(ctx context.Context, guildID int64, channelID int64, query *MessagesQuery) ([]*MessageState, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	messages := w.tracker.GetMessages(guildID, channelID, query)
+	if messages == nil && w.tracker.GetGuild(guildID) == nil {
+		return nil, &ErrGuildNotFound{GuildID: guildID}
+	}
+
+	return messages, nil
+}
+
+func (w *withContext) IterateMembers(ctx context.Context, guildID int64, f func(chunk []*MemberState) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	called := false
+	w.tracker.IterateMembers(guildID, func(chunk []*MemberState) bool {
+		called = true
+		if ctx.Err() != nil {
+			return false
+		}
+
+		return f(chunk)
+	})
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if !called && w.tracker.GetGuild(guildID) == nil {
+		return &ErrGuildNotFound{GuildID: guildID}
+	}
+
+	return nil
+}
+
+// WithoutContext adapts a ContextStateTracker to a StateTracker, using context.Background for all calls
+// misses are returned as nil like StateTracker does, other errors are passed to errHandler if it's not nil
+func WithoutContext(tracker ContextStateTracker, errHandler func(err error)) StateTracker {
+	if wc, ok := tracker.(*withContext); ok {
+		return wc.tracker
+	}
+
+	return &withoutContext{tracker: tracker, errHandler: errHandler}
+}
+
+type withoutContext struct {
+	tracker    ContextStateTracker
+	errHandler func(err error)
+}
+
+var _ StateTracker = (*withoutContext)(nil)
+
+func (w *withoutContext) handleErr(err error) {
+	if err != nil && !IsMiss(err) && w.errHandler != nil {
+		w.errHandler(err)
+	}
+}
+
+func (w *withoutContext) GetGuild(guildID int64) *GuildSet {
+	gs, err := w.tracker.GetGuild(context.Background(), guildID)
+	w.handleErr(err)
+	return gs
+}
+
+func (w *withoutContext) GetShardGuilds(shardID int64) []*GuildSet {
+	guilds, err := w.tracker.GetShardGuilds(context.Background(), shardID)
+	w.handleErr(err)
+	return guilds
+}
+
+func (w *withoutContext) GetMember(guildID int64, memberID int64) *MemberState {
+	ms, err := w.tracker.GetMember(context.Background(), guildID, memberID)
+	w.handleErr(err)
+	return ms
+}
+
+func (w *withoutContext) GetMessages(guildID int64, channelID int64, query *MessagesQuery) []*MessageState {
+	messages, err := w.tracker.GetMessages(context.Background(), guildID, channelID, query)
+	w.handleErr(err)
+	return messages
+}
+
+func (w *withoutContext) IterateMembers(guildID int64, f func(chunk []*MemberState) bool) {
+	w.handleErr(w.tracker.IterateMembers(context.Background(), guildID, f))
+}
@@ -0,0 +1,190 @@
+package dstate
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// mapTracker is a minimal StateTracker for testing the adapters
+type mapTracker struct {
+	guilds  map[int64]*GuildSet
+	members map[int64][]*MemberState
+}
+
+func (m *mapTracker) GetGuild(guildID int64) *GuildSet {
+	return m.guilds[guildID]
+}
+
+func (m *mapTracker) GetShardGuilds(shardID int64) []*GuildSet {
+	if shardID != 0 {
+		panic("unknown shard")
+	}
+
+	result := make([]*GuildSet, 0, len(m.guilds))
+	for _, v := range m.guilds {
+		result = append(result, v)
+	}
+	return result
+}
+
+func (m *mapTracker) TotalShards() int64 {
+	return 1
+}
+
+func (m *mapTracker) GetMember(guildID int64, memberID int64) *MemberState {
+	for _, v := range m.members[guildID] {
+		if v.User.ID == memberID {
+			return v
+		}
+	}
+	return nil
+}
+
+func (m *mapTracker) GetMessages(guildID int64, channelID int64, query *MessagesQuery) []*MessageState {
+	return nil
+}
+
+func (m *mapTracker) IterateMembers(guildID int64, f func(chunk []*MemberState) bool) {
+	members := m.members[guildID]
+	for i := range members {
+		if !f(members[i : i+1]) {
+			return
+		}
+	}
+}
+
+func createContextTestTracker() *mapTracker {
+	return &mapTracker{
+		guilds: map[int64]*GuildSet{
+			1: {GuildState: GuildState{ID: 1}},
+		},
+		members: map[int64][]*MemberState{
+			1: {createHierarchyTestMember(1000), createHierarchyTestMember(1001)},
+		},
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	tracker := WithContext(createContextTestTracker())
+	ctx := context.Background()
+
+	if gs, err := tracker.GetGuild(ctx, 1); err != nil || gs == nil {
+		t.Fatal("expected guild, got error: ", err)
+	}
+
+	if _, err := tracker.GetGuild(ctx, 2); !isGuildNotFound(err, 2) {
+		t.Fatal("expected ErrGuildNotFound, got: ", err)
+	}
+
+	if _, err := tracker.GetMember(ctx, 2, 1000); !isGuildNotFound(err, 2) {
+		t.Fatal("expected ErrGuildNotFound, got: ", err)
+	}
+
+	if _, err := tracker.GetMember(ctx, 1, 5000); err == nil {
+		t.Fatal("expected error")
+	} else if is, id := IsMemberNotCached(err); !is || id != 5000 {
+		t.Fatal("expected ErrMemberNotCached, got: ", err)
+	}
+
+	if _, err := tracker.GetShardGuilds(ctx, 5); err == nil {
+		t.Fatal("expected error")
+	} else if is, id := IsShardNotFound(err); !is || id != 5 {
+		t.Fatal("expected ErrShardNotFound, got: ", err)
+	}
+
+	if messages, err := tracker.GetMessages(ctx, 1, 10, &MessagesQuery{}); err != nil || messages != nil {
+		t.Fatal("expected no messages and no error, got: ", err)
+	}
+
+	if _, err := tracker.GetMessages(ctx, 2, 10, &MessagesQuery{}); !isGuildNotFound(err, 2) {
+		t.Fatal("expected ErrGuildNotFound, got: ", err)
+	}
+
+	if err := tracker.IterateMembers(ctx, 2, func(chunk []*MemberState) bool { return true }); !isGuildNotFound(err, 2) {
+		t.Fatal("expected ErrGuildNotFound, got: ", err)
+	}
+
+	// cancelled between chunks
+	cctx, cancel := context.WithCancel(ctx)
+	chunks := 0
+	err := tracker.IterateMembers(cctx, 1, func(chunk []*MemberState) bool {
+		chunks++
+		cancel()
+		return true
+	})
+	if chunks != 1 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected to be cancelled after 1 chunk, chunks: %d, err: %v", chunks, err)
+	}
+
+	if _, err := tracker.GetGuild(cctx, 1); !errors.Is(err, context.Canceled) {
+		t.Fatal("expected context.Canceled, got: ", err)
+	}
+}
+
+// hides TotalShards, and panics in GetShardGuilds like a buggy tracker would
+type panicShardTracker struct {
+	StateTracker
+}
+
+func (p *panicShardTracker) GetShardGuilds(shardID int64) []*GuildSet {
+	panic("bug")
+}
+
+func TestWithContextShardPanic(t *testing.T) {
+	tracker := WithContext(&panicShardTracker{StateTracker: createContextTestTracker()})
+
+	defer func() {
+		if r := recover(); r != "bug" {
+			t.Fatal("expected the panic to propagate, got: ", r)
+		}
+	}()
+
+	tracker.GetShardGuilds(context.Background(), 0)
+	t.Fatal("expected a panic")
+}
+
+func TestWithoutContext(t *testing.T) {
+	original := createContextTestTracker()
+	if WithoutContext(WithContext(original), nil) != original {
+		t.Fatal("adapters not unwrapped")
+	}
+
+	var handled []error
+	failing := errors.New("failed")
+	tracker := WithoutContext(&errorTracker{ContextStateTracker: WithContext(original), err: failing}, func(err error) {
+		handled = append(handled, err)
+	})
+
+	if gs := tracker.GetGuild(1); gs != nil {
+		t.Fatal("expected nil on error")
+	}
+
+	if ms := tracker.GetMember(2, 1000); ms != nil {
+		t.Fatal("expected nil on miss")
+	}
+
+	if ms := tracker.GetMember(1, 1000); ms == nil {
+		t.Fatal("expected member")
+	}
+
+	// misses should not be passed to the handler
+	if len(handled) != 1 || handled[0] != failing {
+		t.Fatalf("unexpected handled errors: %v", handled)
+	}
+}
+
+// errorTracker fails GetGuild calls
+type errorTracker struct {
+	ContextStateTracker
+	err error
+}
+
+func (e *errorTracker) GetGuild(ctx context.Context, guildID int64) (*GuildSet, error) {
+	return nil, e.err
+}
+
+func isGuildNotFound(err error, guildID int64) bool {
+	is, id := IsGuildNotFound(err)
+	return is && id == guildID
+}
@@ -0,0 +1,438 @@
+package dstate
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/jonas747/discordgo"
+)
+
+type ChangeType int
+
+const (
+	ChangeAdded    ChangeType = 1
+	ChangeRemoved  ChangeType = 2
+	ChangeModified ChangeType = 3
+)
+
+func (c ChangeType) String() string {
+	switch c {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	}
+
+	return "unknown"
+}
+
+// FieldChange is a change to a single field, Field is the name of the struct field, e.g "Name" or "Topic"
+// Old and New are the values of the field
+type FieldChange struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+// PermissionsChange is a change of a permissions bit set
+type PermissionsChange struct {
+	Old int64
+	New int64
+}
+
+// Added returns the permissions that are in New but not in Old
+func (p PermissionsChange) Added() int64 {
+	return p.New &^ p.Old
+}
+
+// Removed returns the permissions that are in Old but not in New
+func (p PermissionsChange) Removed() int64 {
+	return p.Old &^ p.New
+}
+
+// GuildDiff is the result of DiffGuildSets, the lists are sorted by ID
+type GuildDiff struct {
+	GuildID int64
+
+	// Changes to the GuildState fields
+	Fields []FieldChange
+
+	Channels []*ChannelDiff
+	Threads  []*ChannelDiff
+	Roles    []*RoleDiff
+	Emojis   []*EmojiDiff
+}
+
+// IsEmpty returns true if there are no changes
+func (d *GuildDiff) IsEmpty() bool {
+	return len(d.Fields) == 0 && len(d.Channels) == 0 && len(d.Threads) == 0 && len(d.Roles) == 0 && len(d.Emojis) == 0
+}
+
+type ChannelDiff struct {
+	Type ChangeType
+	ID   int64
+
+	// Old is nil if the channel was added, and New is nil if it was removed
+	Old *ChannelState
+	New *ChannelState
+
+	// Changes to fields other than the overwrites, only set if modified
+	Fields []FieldChange
+
+	// Changes to the permission overwrites, only set if modified
+	Overwrites []*OverwriteDiff
+}
+
+type OverwriteDiff struct {
+	Type ChangeType
+
+	// The role or user ID
+	ID int64
+
+	// Old is nil if the overwrite was added, and New is nil if it was removed
+	Old *discordgo.PermissionOverwrite
+	New *discordgo.PermissionOverwrite
+
+	// The permissions from Old to New, treating a missing overwrite as allowing and denying nothing
+	Allow PermissionsChange
+	Deny  PermissionsChange
+}
+
+type RoleDiff struct {
+	Type ChangeType
+	ID   int64
+
+	// Old is nil if the role was added, and New is nil if it was removed
+	Old *discordgo.Role
+	New *discordgo.Role
+
+	// Changes to fields other than the permissions, only set if modified
+	Fields []FieldChange
+
+	// nil if the permissions did not change
+	Permissions *PermissionsChange
+}
+
+type EmojiDiff struct {
+	Type ChangeType
+	ID   int64
+
+	// Old is nil if the emoji was added, and New is nil if it was removed
+	Old *discordgo.Emoji
+	New *discordgo.Emoji
+
+	// Only set if modified
+	Fields []FieldChange
+}
+
+type MemberDiff struct {
+	GuildID int64
+	UserID  int64
+
+	// Changes to the user, member and presence fields, prefixed with the struct they're in, e.g "User.Username", "Member.Nick" and "Presence.Status"
+	// a member or presence going from nil to set or the other way around is reported as a "Member" or "Presence" change
+	Fields []FieldChange
+
+	RolesAdded   []int64
+	RolesRemoved []int64
+}
+
+// DiffGuildSets compares the two guild sets, which are assumed to be the same guild at different points in time
+// unlike the other diff functions this never returns nil, use IsEmpty to check if there were any changes
+func DiffGuildSets(old *GuildSet, new *GuildSet) *GuildDiff {
+	diff := &GuildDiff{
+		GuildID: new.ID,
+		Fields:  DiffGuildStates(&old.GuildState, &new.GuildState),
+	}
+
+	diff.Channels = diffChannelLists(old.Channels, new.Channels)
+	diff.Threads = diffChannelLists(old.Threads, new.Threads)
+
+	oldRoles := make(map[int64]*discordgo.Role, len(old.Roles))
+	for i := range old.Roles {
+		oldRoles[old.Roles[i].ID] = &old.Roles[i]
+	}
+
+	for i := range new.Roles {
+		r := &new.Roles[i]
+		if d := DiffRoles(oldRoles[r.ID], r); d != nil {
+			diff.Roles = append(diff.Roles, d)
+		}
+		delete(oldRoles, r.ID)
+	}
+
+	for _, v := range oldRoles {
+		diff.Roles = append(diff.Roles, DiffRoles(v, nil))
+	}
+	sort.Slice(diff.Roles, func(i, j int) bool { return diff.Roles[i].ID < diff.Roles[j].ID })
+
+	oldEmojis := make(map[int64]*discordgo.Emoji, len(old.Emojis))
+	for i := range old.Emojis {
+		oldEmojis[old.Emojis[i].ID] = &old.Emojis[i]
+	}
+
+	for i := range new.Emojis {
+		e := &new.Emojis[i]
+		if d := DiffEmojis(oldEmojis[e.ID], e); d != nil {
+			diff.Emojis = append(diff.Emojis, d)
+		}
+		delete(oldEmojis, e.ID)
+	}
+
+	for _, v := range oldEmojis {
+		diff.Emojis = append(diff.Emojis, DiffEmojis(v, nil))
+	}
+	sort.Slice(diff.Emojis, func(i, j int) bool { return diff.Emojis[i].ID < diff.Emojis[j].ID })
+
+	return diff
+}
+
+func diffChannelLists(old []ChannelState, new []ChannelState) []*ChannelDiff {
+	oldChannels := make(map[int64]*ChannelState, len(old))
+	for i := range old {
+		oldChannels[old[i].ID] = &old[i]
+	}
+
+	var result []*ChannelDiff
+	for i := range new {
+		c := &new[i]
+		if d := DiffChannels(oldChannels[c.ID], c); d != nil {
+			result = append(result, d)
+		}
+		delete(oldChannels, c.ID)
+	}
+
+	for _, v := range oldChannels {
+		result = append(result, DiffChannels(v, nil))
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// DiffGuildStates returns the changed fields between the two guild states
+func DiffGuildStates(old *GuildState, new *GuildState) []FieldChange {
+	return diffFields(nil, "", reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem())
+}
+
+// DiffChannels compares two versions of a channel, either of which may be nil if it was added or removed
+// returns nil if there are no changes
+func DiffChannels(old *ChannelState, new *ChannelState) *ChannelDiff {
+	switch {
+	case old == nil && new == nil:
+		return nil
+	case old == nil:
+		return &ChannelDiff{Type: ChangeAdded, ID: new.ID, New: new}
+	case new == nil:
+		return &ChannelDiff{Type: ChangeRemoved, ID: old.ID, Old: old}
+	}
+
+	fields := diffFields(nil, "", reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem(), "PermissionOverwrites")
+	overwrites := DiffOverwrites(old.PermissionOverwrites, new.PermissionOverwrites)
+	if len(fields) == 0 && len(overwrites) == 0 {
+		return nil
+	}
+
+	return &ChannelDiff{
+		Type:       ChangeModified,
+		ID:         new.ID,
+		Old:        old,
+		New:        new,
+		Fields:     fields,
+		Overwrites: overwrites,
+	}
+}
+
+// DiffOverwrites compares two sets of permission overwrites, the result is sorted by ID
+func DiffOverwrites(old []discordgo.PermissionOverwrite, new []discordgo.PermissionOverwrite) []*OverwriteDiff {
+	oldOverwrites := make(map[int64]*discordgo.PermissionOverwrite, len(old))
+	for i := range old {
+		oldOverwrites[old[i].ID] = &old[i]
+	}
+
+	var result []*OverwriteDiff
+	for i := range new {
+		n := &new[i]
+		o := oldOverwrites[n.ID]
+		delete(oldOverwrites, n.ID)
+
+		if o != nil && *o == *n {
+			continue
+		}
+
+		d := &OverwriteDiff{
+			Type:  ChangeAdded,
+			ID:    n.ID,
+			Old:   o,
+			New:   n,
+			Allow: PermissionsChange{New: int64(n.Allow)},
+			Deny:  PermissionsChange{New: int64(n.Deny)},
+		}
+
+		if o != nil {
+			d.Type = ChangeModified
+			d.Allow.Old = int64(o.Allow)
+			d.Deny.Old = int64(o.Deny)
+		}
+
+		result = append(result, d)
+	}
+
+	for _, o := range oldOverwrites {
+		result = append(result, &OverwriteDiff{
+			Type:  ChangeRemoved,
+			ID:    o.ID,
+			Old:   o,
+			Allow: PermissionsChange{Old: int64(o.Allow)},
+			Deny:  PermissionsChange{Old: int64(o.Deny)},
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// DiffRoles compares two versions of a role, either of which may be nil if it was added or removed
+// returns nil if there are no changes
+func DiffRoles(old *discordgo.Role, new *discordgo.Role) *RoleDiff {
+	switch {
+	case old == nil && new == nil:
+		return nil
+	case old == nil:
+		return &RoleDiff{Type: ChangeAdded, ID: new.ID, New: new}
+	case new == nil:
+		return &RoleDiff{Type: ChangeRemoved, ID: old.ID, Old: old}
+	}
+
+	diff := &RoleDiff{
+		Type:   ChangeModified,
+		ID:     new.ID,
+		Old:    old,
+		New:    new,
+		Fields: diffFields(nil, "", reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem(), "Permissions"),
+	}
+
+	if old.Permissions != new.Permissions {
+		diff.Permissions = &PermissionsChange{Old: int64(old.Permissions), New: int64(new.Permissions)}
+	}
+
+	if len(diff.Fields) == 0 && diff.Permissions == nil {
+		return nil
+	}
+
+	return diff
+}
+
+// DiffEmojis compares two versions of a emoji, either of which may be nil if it was added or removed
+// returns nil if there are no changes
+func DiffEmojis(old *discordgo.Emoji, new *discordgo.Emoji) *EmojiDiff {
+	switch {
+	case old == nil && new == nil:
+		return nil
+	case old == nil:
+		return &EmojiDiff{Type: ChangeAdded, ID: new.ID, New: new}
+	case new == nil:
+		return &EmojiDiff{Type: ChangeRemoved, ID: old.ID, Old: old}
+	}
+
+	fields := diffFields(nil, "", reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem())
+	if len(fields) == 0 {
+		return nil
+	}
+
+	return &EmojiDiff{
+		Type:   ChangeModified,
+		ID:     new.ID,
+		Old:    old,
+		New:    new,
+		Fields: fields,
+	}
+}
+
+// DiffMembers compares two versions of a member, returns nil if there are no changes
+func DiffMembers(old *MemberState, new *MemberState) *MemberDiff {
+	diff := &MemberDiff{
+		GuildID: new.GuildID,
+		UserID:  new.User.ID,
+	}
+
+	diff.Fields = diffFields(diff.Fields, "User.", reflect.ValueOf(&old.User).Elem(), reflect.ValueOf(&new.User).Elem())
+
+	switch {
+	case old.Member == nil && new.Member == nil:
+	case old.Member == nil || new.Member == nil:
+		diff.Fields = append(diff.Fields, FieldChange{Field: "Member", Old: old.Member, New: new.Member})
+	default:
+		diff.Fields = diffFields(diff.Fields, "Member.", reflect.ValueOf(old.Member).Elem(), reflect.ValueOf(new.Member).Elem(), "Roles")
+	}
+
+	var oldRoles, newRoles []int64
+	if old.Member != nil {
+		oldRoles = old.Member.Roles
+	}
+	if new.Member != nil {
+		newRoles = new.Member.Roles
+	}
+
+	for _, v := range newRoles {
+		if !containsID(oldRoles, v) {
+			diff.RolesAdded = append(diff.RolesAdded, v)
+		}
+	}
+
+	for _, v := range oldRoles {
+		if !containsID(newRoles, v) {
+			diff.RolesRemoved = append(diff.RolesRemoved, v)
+		}
+	}
+
+	switch {
+	case old.Presence == nil && new.Presence == nil:
+	case old.Presence == nil || new.Presence == nil:
+		diff.Fields = append(diff.Fields, FieldChange{Field: "Presence", Old: old.Presence, New: new.Presence})
+	default:
+		diff.Fields = diffFields(diff.Fields, "Presence.", reflect.ValueOf(old.Presence).Elem(), reflect.ValueOf(new.Presence).Elem())
+	}
+
+	if len(diff.Fields) == 0 && len(diff.RolesAdded) == 0 && len(diff.RolesRemoved) == 0 {
+		return nil
+	}
+
+	return diff
+}
+
+// appends the exported fields of the structs old and new that are not equal to dst, skipping the fields in skip
+func diffFields(dst []FieldChange, prefix string, old reflect.Value, new reflect.Value, skip ...string) []FieldChange {
+	t := old.Type()
+
+OUTER:
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		for _, v := range skip {
+			if v == field.Name {
+				continue OUTER
+			}
+		}
+
+		of, nf := old.Field(i), new.Field(i)
+
+		// nil and empty slices are treated as equal
+		if of.Kind() == reflect.Slice && of.Len() == 0 && nf.Len() == 0 {
+			continue
+		}
+
+		o, n := of.Interface(), nf.Interface()
+		if !reflect.DeepEqual(o, n) {
+			dst = append(dst, FieldChange{Field: prefix + field.Name, Old: o, New: n})
+		}
+	}
+
+	return dst
+}
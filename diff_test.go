@@ -0,0 +1,122 @@
+package dstate
+
+import (
+	"testing"
+
+	"github.com/jonas747/discordgo"
+)
+
+func createDiffTestGuild() *GuildSet {
+	return &GuildSet{
+		GuildState: GuildState{ID: 1, Name: "guild", OwnerID: 1000},
+		Channels: []ChannelState{
+			{ID: 10, GuildID: 1, Name: "general", Topic: "hello", PermissionOverwrites: []discordgo.PermissionOverwrite{
+				{ID: 1, Type: "role", Deny: discordgo.PermissionSendMessages},
+				{ID: 100, Type: "role", Allow: discordgo.PermissionSendMessages},
+			}},
+			{ID: 11, GuildID: 1, Name: "removed"},
+		},
+		Roles: []discordgo.Role{
+			{ID: 1, Name: "@everyone", Permissions: discordgo.PermissionReadMessages},
+			{ID: 100, Name: "mod", Permissions: discordgo.PermissionKickMembers},
+			{ID: 101, Name: "unchanged"},
+		},
+		Emojis: []discordgo.Emoji{{ID: 50, Name: "emoji"}},
+	}
+}
+
+func TestDiffGuildSets(t *testing.T) {
+	old := createDiffTestGuild()
+	if diff := DiffGuildSets(old, createDiffTestGuild()); !diff.IsEmpty() {
+		t.Fatalf("expected no changes: %#v", diff)
+	}
+
+	new := createDiffTestGuild()
+	new.Name = "renamed"
+	new.Features = []string{}
+	new.Channels[0].Topic = "changed"
+	new.Channels[0].PermissionOverwrites = []discordgo.PermissionOverwrite{
+		{ID: 1, Type: "role", Deny: discordgo.PermissionSendMessages | discordgo.PermissionAddReactions},
+		{ID: 1000, Type: "member", Allow: discordgo.PermissionManageMessages},
+	}
+	new.Channels = append(new.Channels[:1], ChannelState{ID: 12, GuildID: 1, Name: "added"})
+	new.Roles[1].Permissions = discordgo.PermissionKickMembers | discordgo.PermissionBanMembers
+	new.Roles[1].Color = 0xff0000
+	new.Emojis = nil
+
+	diff := DiffGuildSets(old, new)
+
+	if len(diff.Fields) != 1 || diff.Fields[0].Field != "Name" || diff.Fields[0].Old != "guild" || diff.Fields[0].New != "renamed" {
+		t.Fatalf("unexpected guild fields: %#v", diff.Fields)
+	}
+
+	if len(diff.Channels) != 3 {
+		t.Fatalf("expected 3 channel changes: %#v", diff.Channels)
+	}
+
+	modified := diff.Channels[0]
+	if modified.ID != 10 || modified.Type != ChangeModified || len(modified.Fields) != 1 || modified.Fields[0].Field != "Topic" {
+		t.Fatalf("unexpected channel change: %#v", modified)
+	}
+
+	if len(modified.Overwrites) != 3 {
+		t.Fatalf("expected 3 overwrite changes: %#v", modified.Overwrites)
+	}
+
+	if o := modified.Overwrites[0]; o.ID != 1 || o.Type != ChangeModified || o.Deny.Added() != discordgo.PermissionAddReactions || o.Deny.Removed() != 0 || o.Allow.Added() != 0 {
+		t.Fatalf("unexpected overwrite change: %#v", o)
+	}
+
+	if o := modified.Overwrites[1]; o.ID != 100 || o.Type != ChangeRemoved || o.Allow.Removed() != discordgo.PermissionSendMessages {
+		t.Fatalf("unexpected overwrite change: %#v", o)
+	}
+
+	if o := modified.Overwrites[2]; o.ID != 1000 || o.Type != ChangeAdded || o.Allow.Added() != discordgo.PermissionManageMessages {
+		t.Fatalf("unexpected overwrite change: %#v", o)
+	}
+
+	if diff.Channels[1].ID != 11 || diff.Channels[1].Type != ChangeRemoved || diff.Channels[2].ID != 12 || diff.Channels[2].Type != ChangeAdded {
+		t.Fatalf("unexpected channel changes: %#v, %#v", diff.Channels[1], diff.Channels[2])
+	}
+
+	if len(diff.Roles) != 1 {
+		t.Fatalf("expected 1 role change: %#v", diff.Roles)
+	}
+
+	role := diff.Roles[0]
+	if role.ID != 100 || role.Permissions == nil || role.Permissions.Added() != discordgo.PermissionBanMembers || len(role.Fields) != 1 || role.Fields[0].Field != "Color" {
+		t.Fatalf("unexpected role change: %#v", role)
+	}
+
+	if len(diff.Emojis) != 1 || diff.Emojis[0].Type != ChangeRemoved {
+		t.Fatalf("unexpected emoji changes: %#v", diff.Emojis)
+	}
+}
+
+func TestDiffMembers(t *testing.T) {
+	old := &MemberState{
+		GuildID: 1,
+		User:    discordgo.User{ID: 1000, Username: "user"},
+		Member:  &MemberFields{Roles: []int64{100, 101}},
+	}
+
+	if DiffMembers(old, old) != nil {
+		t.Fatal("expected no changes")
+	}
+
+	new := &MemberState{
+		GuildID:  1,
+		User:     discordgo.User{ID: 1000, Username: "renamed"},
+		Member:   &MemberFields{Roles: []int64{101, 102}, Nick: "nick"},
+		Presence: &PresenceFields{Status: StatusOnline},
+	}
+
+	diff := DiffMembers(old, new)
+	if len(diff.Fields) != 3 || diff.Fields[0].Field != "User.Username" || diff.Fields[1].Field != "Member.Nick" || diff.Fields[2].Field != "Presence" {
+		t.Fatalf("unexpected fields: %#v", diff.Fields)
+	}
+
+	if len(diff.RolesAdded) != 1 || diff.RolesAdded[0] != 102 || len(diff.RolesRemoved) != 1 || diff.RolesRemoved[0] != 100 {
+		t.Fatalf("unexpected role changes: %v, %v", diff.RolesAdded, diff.RolesRemoved)
+	}
+}
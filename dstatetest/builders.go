@@ -0,0 +1,470 @@
+// Package dstatetest provides fixtures and a fake dstate.StateTracker for testing code that uses dstate, without needing gateway events
+//
+// The builders have sensible defaults for everything, so only the fields relevant to the test have to be set:
+//
+//	gs := dstatetest.Guild(1).
+//		Everyone(discordgo.PermissionReadMessages).
+//		Role(dstatetest.Role(100).Permissions(discordgo.PermissionBanMembers)).
+//		Channel(dstatetest.Channel(10).Overwrite(dstatetest.RoleOverwrite(1).Deny(discordgo.PermissionSendMessages))).
+//		Build()
+//
+//	tracker := dstatetest.NewTracker().AddGuild(gs).AddMember(dstatetest.Member(1, 1000).Roles(100).Build())
+package dstatetest
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+// DefaultJoinedAt is the time members built with Member joined at, unless changed
+var DefaultJoinedAt = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// discord's epoch in milliseconds, the timestamp part of snowflakes is relative to this
+const discordEpoch = 1420070400000
+
+// SnowflakeTime returns the creation time embedded in a snowflake ID
+func SnowflakeTime(id int64) time.Time {
+	ms := (id >> 22) + discordEpoch
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC()
+}
+
+// GuildBuilder builds a dstate.GuildSet, see Guild
+type GuildBuilder struct {
+	gs dstate.GuildSet
+}
+
+// Guild returns a builder for a available guild with a @everyone role without any permissions
+func Guild(id int64) *GuildBuilder {
+	return &GuildBuilder{
+		gs: dstate.GuildSet{
+			GuildState: dstate.GuildState{
+				ID:          id,
+				Name:        "test guild-" + strconv.FormatInt(id, 10),
+				Available:   true,
+				MemberCount: 1,
+			},
+			Roles: []discordgo.Role{{ID: id, Name: "@everyone"}},
+		},
+	}
+}
+
+func (b *GuildBuilder) Name(name string) *GuildBuilder {
+	b.gs.Name = name
+	return b
+}
+
+func (b *GuildBuilder) Owner(userID int64) *GuildBuilder {
+	b.gs.OwnerID = userID
+	return b
+}
+
+func (b *GuildBuilder) MemberCount(count int64) *GuildBuilder {
+	b.gs.MemberCount = count
+	return b
+}
+
+func (b *GuildBuilder) Unavailable() *GuildBuilder {
+	b.gs.Available = false
+	return b
+}
+
+// Everyone sets the permissions of the @everyone role
+func (b *GuildBuilder) Everyone(perms int64) *GuildBuilder {
+	for i := range b.gs.Roles {
+		if b.gs.Roles[i].ID == b.gs.ID {
+			b.gs.Roles[i].Permissions = int(perms)
+		}
+	}
+	return b
+}
+
+// Role adds a role, replacing any existing one with the same ID
+func (b *GuildBuilder) Role(r *RoleBuilder) *GuildBuilder {
+	role := r.Build()
+	for i := range b.gs.Roles {
+		if b.gs.Roles[i].ID == role.ID {
+			b.gs.Roles[i] = role
+			return b
+		}
+	}
+
+	b.gs.Roles = append(b.gs.Roles, role)
+	return b
+}
+
+// Channel adds a channel, or a thread if it's a thread type
+func (b *GuildBuilder) Channel(c *ChannelBuilder) *GuildBuilder {
+	cs := c.Build()
+	cs.GuildID = b.gs.ID
+
+	if cs.IsThread() {
+		b.gs.Threads = append(b.gs.Threads, cs)
+	} else {
+		b.gs.Channels = append(b.gs.Channels, cs)
+	}
+	return b
+}
+
+func (b *GuildBuilder) Emoji(emoji discordgo.Emoji) *GuildBuilder {
+	b.gs.Emojis = append(b.gs.Emojis, emoji)
+	return b
+}
+
+// VoiceState adds a voice state for the user in the channel
+func (b *GuildBuilder) VoiceState(userID int64, channelID int64) *GuildBuilder {
+	b.gs.VoiceStates = append(b.gs.VoiceStates, discordgo.VoiceState{
+		GuildID:   b.gs.ID,
+		UserID:    userID,
+		ChannelID: channelID,
+	})
+	return b
+}
+
+// Build returns the guild set, with the channels and roles sorted like the trackers do
+// the builder can keep being used after this
+func (b *GuildBuilder) Build() *dstate.GuildSet {
+	gs := b.gs
+
+	gs.Channels = append([]dstate.ChannelState(nil), b.gs.Channels...)
+	gs.Threads = append([]dstate.ChannelState(nil), b.gs.Threads...)
+	gs.Roles = append([]discordgo.Role(nil), b.gs.Roles...)
+	gs.Emojis = append([]discordgo.Emoji(nil), b.gs.Emojis...)
+	gs.VoiceStates = append([]discordgo.VoiceState(nil), b.gs.VoiceStates...)
+
+	sort.Sort(dstate.Channels(gs.Channels))
+	sort.Sort(dstate.Roles(gs.Roles))
+
+	return &gs
+}
+
+// ChannelBuilder builds a dstate.ChannelState, see Channel
+type ChannelBuilder struct {
+	cs dstate.ChannelState
+}
+
+// Channel returns a builder for a text channel, the guild ID is set when added to a guild
+func Channel(id int64) *ChannelBuilder {
+	return &ChannelBuilder{
+		cs: dstate.ChannelState{
+			ID:   id,
+			Name: "test channel-" + strconv.FormatInt(id, 10),
+			Type: discordgo.ChannelTypeGuildText,
+		},
+	}
+}
+
+// Thread returns a builder for a public thread in the parent channel
+func Thread(id int64, parentID int64) *ChannelBuilder {
+	return Channel(id).Type(dstate.ChannelTypeGuildPublicThread).Parent(parentID)
+}
+
+func (b *ChannelBuilder) Name(name string) *ChannelBuilder {
+	b.cs.Name = name
+	return b
+}
+
+func (b *ChannelBuilder) Topic(topic string) *ChannelBuilder {
+	b.cs.Topic = topic
+	return b
+}
+
+func (b *ChannelBuilder) Type(t discordgo.ChannelType) *ChannelBuilder {
+	b.cs.Type = t
+	return b
+}
+
+func (b *ChannelBuilder) NSFW() *ChannelBuilder {
+	b.cs.NSFW = true
+	return b
+}
+
+func (b *ChannelBuilder) Position(position int) *ChannelBuilder {
+	b.cs.Position = position
+	return b
+}
+
+// Parent sets the category of the channel, or the channel a thread is in
+func (b *ChannelBuilder) Parent(parentID int64) *ChannelBuilder {
+	b.cs.ParentID = parentID
+	return b
+}
+
+func (b *ChannelBuilder) Overwrite(o *OverwriteBuilder) *ChannelBuilder {
+	b.cs.PermissionOverwrites = append(b.cs.PermissionOverwrites, o.Build())
+	return b
+}
+
+func (b *ChannelBuilder) Build() dstate.ChannelState {
+	cs := b.cs
+	cs.PermissionOverwrites = append([]discordgo.PermissionOverwrite(nil), b.cs.PermissionOverwrites...)
+	return cs
+}
+
+// RoleBuilder builds a discordgo.Role, see Role
+type RoleBuilder struct {
+	role discordgo.Role
+}
+
+// Role returns a builder for a role without any permissions, the position defaults to 1
+func Role(id int64) *RoleBuilder {
+	return &RoleBuilder{
+		role: discordgo.Role{
+			ID:       id,
+			Name:     "test role-" + strconv.FormatInt(id, 10),
+			Position: 1,
+		},
+	}
+}
+
+func (b *RoleBuilder) Name(name string) *RoleBuilder {
+	b.role.Name = name
+	return b
+}
+
+func (b *RoleBuilder) Permissions(perms int64) *RoleBuilder {
+	b.role.Permissions = int(perms)
+	return b
+}
+
+func (b *RoleBuilder) Position(position int) *RoleBuilder {
+	b.role.Position = position
+	return b
+}
+
+func (b *RoleBuilder) Color(color int) *RoleBuilder {
+	b.role.Color = color
+	return b
+}
+
+func (b *RoleBuilder) Hoist() *RoleBuilder {
+	b.role.Hoist = true
+	return b
+}
+
+func (b *RoleBuilder) Mentionable() *RoleBuilder {
+	b.role.Mentionable = true
+	return b
+}
+
+func (b *RoleBuilder) Managed() *RoleBuilder {
+	b.role.Managed = true
+	return b
+}
+
+func (b *RoleBuilder) Build() discordgo.Role {
+	return b.role
+}
+
+// OverwriteBuilder builds a discordgo.PermissionOverwrite, see RoleOverwrite and MemberOverwrite
+type OverwriteBuilder struct {
+	o discordgo.PermissionOverwrite
+}
+
+// RoleOverwrite returns a builder for a overwrite for the role, use the guild ID for the @everyone role
+func RoleOverwrite(roleID int64) *OverwriteBuilder {
+	return &OverwriteBuilder{o: discordgo.PermissionOverwrite{ID: roleID, Type: "role"}}
+}
+
+func MemberOverwrite(userID int64) *OverwriteBuilder {
+	return &OverwriteBuilder{o: discordgo.PermissionOverwrite{ID: userID, Type: "member"}}
+}
+
+func (b *OverwriteBuilder) Allow(perms int64) *OverwriteBuilder {
+	b.o.Allow |= int(perms)
+	return b
+}
+
+func (b *OverwriteBuilder) Deny(perms int64) *OverwriteBuilder {
+	b.o.Deny |= int(perms)
+	return b
+}
+
+func (b *OverwriteBuilder) Build() discordgo.PermissionOverwrite {
+	return b.o
+}
+
+// MemberBuilder builds a dstate.MemberState, see Member
+type MemberBuilder struct {
+	ms       dstate.MemberState
+	member   dstate.MemberFields
+	presence *dstate.PresenceFields
+	noMember bool
+}
+
+// Member returns a builder for a member without a presence, that joined at DefaultJoinedAt
+func Member(guildID int64, userID int64) *MemberBuilder {
+	return &MemberBuilder{
+		ms: dstate.MemberState{
+			GuildID: guildID,
+			User:    *User(userID),
+		},
+		member: dstate.MemberFields{
+			JoinedAt: discordgo.Timestamp(DefaultJoinedAt.Format(time.RFC3339)),
+		},
+	}
+}
+
+// User returns a user with a username based on the ID
+func User(id int64) *discordgo.User {
+	return &discordgo.User{
+		ID:            id,
+		Username:      "test member-" + strconv.FormatInt(id, 10),
+		Discriminator: "0000",
+	}
+}
+
+func (b *MemberBuilder) Username(username string) *MemberBuilder {
+	b.ms.User.Username = username
+	return b
+}
+
+func (b *MemberBuilder) Bot() *MemberBuilder {
+	b.ms.User.Bot = true
+	return b
+}
+
+func (b *MemberBuilder) Nick(nick string) *MemberBuilder {
+	b.member.Nick = nick
+	return b
+}
+
+func (b *MemberBuilder) Roles(roles ...int64) *MemberBuilder {
+	b.member.Roles = append(b.member.Roles, roles...)
+	return b
+}
+
+func (b *MemberBuilder) JoinedAt(t time.Time) *MemberBuilder {
+	b.member.JoinedAt = discordgo.Timestamp(t.Format(time.RFC3339))
+	return b
+}
+
+// Presence adds presence fields with the status
+func (b *MemberBuilder) Presence(status dstate.PresenceStatus) *MemberBuilder {
+	if b.presence == nil {
+		b.presence = &dstate.PresenceFields{}
+	}
+	b.presence.Status = status
+	return b
+}
+
+// Game sets the main activity, also adding presence fields with a online status if there are none
+func (b *MemberBuilder) Game(t discordgo.GameType, name string) *MemberBuilder {
+	if b.presence == nil {
+		b.Presence(dstate.StatusOnline)
+	}
+	b.presence.Game = &dstate.LightGame{Type: t, Name: name}
+	return b
+}
+
+// PresenceOnly removes the member fields, as is the case for users only seen through presence updates
+func (b *MemberBuilder) PresenceOnly() *MemberBuilder {
+	b.noMember = true
+	if b.presence == nil {
+		b.Presence(dstate.StatusOnline)
+	}
+	return b
+}
+
+func (b *MemberBuilder) Build() *dstate.MemberState {
+	ms := b.ms
+
+	if !b.noMember {
+		member := b.member
+		member.Roles = append([]int64(nil), b.member.Roles...)
+		ms.Member = &member
+	}
+
+	if b.presence != nil {
+		presence := *b.presence
+		ms.Presence = &presence
+	}
+
+	return &ms
+}
+
+// MessageBuilder builds a dstate.MessageState, see Message
+type MessageBuilder struct {
+	m dstate.MessageState
+}
+
+// Message returns a builder for a message created at the time embedded in its ID, by the user with ID 1
+func Message(guildID int64, channelID int64, id int64) *MessageBuilder {
+	return &MessageBuilder{
+		m: dstate.MessageState{
+			ID:              id,
+			GuildID:         guildID,
+			ChannelID:       channelID,
+			Author:          *User(1),
+			Content:         "test message-" + strconv.FormatInt(id, 10),
+			ParsedCreatedAt: SnowflakeTime(id),
+		},
+	}
+}
+
+func (b *MessageBuilder) Content(content string) *MessageBuilder {
+	b.m.Content = content
+	return b
+}
+
+// Author sets the author to a user with a username based on the ID, see User
+func (b *MessageBuilder) Author(userID int64) *MessageBuilder {
+	b.m.Author = *User(userID)
+	return b
+}
+
+// AuthorMember sets the author and member from a member state, which needs to have member fields
+func (b *MessageBuilder) AuthorMember(ms *dstate.MemberState) *MessageBuilder {
+	b.m.Author = ms.User
+	b.m.Member = ms.DgoMember()
+	return b
+}
+
+func (b *MessageBuilder) Mentions(users ...*discordgo.User) *MessageBuilder {
+	for _, v := range users {
+		b.m.Mentions = append(b.m.Mentions, *v)
+	}
+	return b
+}
+
+func (b *MessageBuilder) MentionRoles(roles ...int64) *MessageBuilder {
+	b.m.MentionRoles = append(b.m.MentionRoles, roles...)
+	return b
+}
+
+func (b *MessageBuilder) Embed(embed discordgo.MessageEmbed) *MessageBuilder {
+	b.m.Embeds = append(b.m.Embeds, embed)
+	return b
+}
+
+func (b *MessageBuilder) Attachment(attachment discordgo.MessageAttachment) *MessageBuilder {
+	b.m.Attachments = append(b.m.Attachments, attachment)
+	return b
+}
+
+func (b *MessageBuilder) CreatedAt(t time.Time) *MessageBuilder {
+	b.m.ParsedCreatedAt = t
+	return b
+}
+
+func (b *MessageBuilder) EditedAt(t time.Time) *MessageBuilder {
+	b.m.ParsedEditedAt = t
+	return b
+}
+
+func (b *MessageBuilder) Deleted() *MessageBuilder {
+	b.m.Deleted = true
+	return b
+}
+
+func (b *MessageBuilder) Build() *dstate.MessageState {
+	m := b.m
+	m.Mentions = append([]discordgo.User(nil), b.m.Mentions...)
+	m.MentionRoles = append([]int64(nil), b.m.MentionRoles...)
+	m.Embeds = append([]discordgo.MessageEmbed(nil), b.m.Embeds...)
+	m.Attachments = append([]discordgo.MessageAttachment(nil), b.m.Attachments...)
+	return &m
+}
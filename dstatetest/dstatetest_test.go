@@ -0,0 +1,134 @@
+package dstatetest
+
+import (
+	"testing"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+const testGuildID = 1
+const testChannelID = 10
+const testRoleID = 100
+
+func createTestGuild() *dstate.GuildSet {
+	return Guild(testGuildID).
+		Owner(999).
+		Everyone(discordgo.PermissionReadMessages | discordgo.PermissionSendMessages).
+		Role(Role(testRoleID).Permissions(discordgo.PermissionManageMessages)).
+		Channel(Channel(testChannelID).Overwrite(RoleOverwrite(testGuildID).Deny(discordgo.PermissionSendMessages))).
+		Channel(Channel(11)).
+		Channel(Thread(20, testChannelID)).
+		Build()
+}
+
+func TestBuilders(t *testing.T) {
+	gs := createTestGuild()
+
+	if len(gs.Channels) != 2 || len(gs.Threads) != 1 || len(gs.Roles) != 2 {
+		t.Fatalf("unexpected guild: %#v", gs)
+	}
+
+	if gs.GetChannel(testChannelID).GuildID != testGuildID {
+		t.Fatal("guild id not set on channel")
+	}
+
+	perms, err := gs.GetMemberPermissions(testChannelID, 1000, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if perms&discordgo.PermissionSendMessages != 0 || perms&discordgo.PermissionReadMessages == 0 {
+		t.Fatal("overwrite not applied: ", perms)
+	}
+
+	// threads use the overwrites of their parent
+	perms, _ = gs.GetMemberPermissions(20, 1000, []int64{testRoleID})
+	if perms&discordgo.PermissionSendMessages != 0 || perms&discordgo.PermissionManageMessages == 0 {
+		t.Fatal("unexpected thread permissions: ", perms)
+	}
+
+	ms := Member(testGuildID, 1000).Roles(testRoleID).Nick("nick").Build()
+	if ms.Member == nil || ms.Member.Nick != "nick" || len(ms.Member.Roles) != 1 || ms.Presence != nil {
+		t.Fatalf("unexpected member: %#v", ms)
+	}
+
+	ms = Member(testGuildID, 1001).PresenceOnly().Build()
+	if ms.Member != nil || ms.Presence == nil || ms.Presence.Status != dstate.StatusOnline {
+		t.Fatalf("unexpected presence only member: %#v", ms)
+	}
+
+	m := Message(testGuildID, testChannelID, 1<<22).Author(1000).Build()
+	if m.Author.ID != 1000 || !m.ParsedCreatedAt.Equal(SnowflakeTime(1<<22)) || m.ParsedCreatedAt.UnixNano()/1e6 != discordEpoch+1 {
+		t.Fatalf("unexpected message: %#v", m)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker().
+		AddGuild(createTestGuild()).
+		AddMember(
+			Member(testGuildID, 1000).Roles(testRoleID).Build(),
+			Member(testGuildID, 1001).Build(),
+		).
+		AddMessage(
+			Message(testGuildID, testChannelID, 3).Author(1000).Build(),
+			Message(testGuildID, testChannelID, 1).Author(1001).Build(),
+			Message(testGuildID, testChannelID, 2).Author(1000).Deleted().Build(),
+			Message(testGuildID, testChannelID, 4).Author(1001).Build(),
+		)
+
+	if tracker.GetGuild(testGuildID) == nil || tracker.GetGuild(2) != nil {
+		t.Fatal("unexpected GetGuild result")
+	}
+
+	if tracker.GetMember(testGuildID, 1000) == nil || tracker.GetMember(testGuildID, 5) != nil {
+		t.Fatal("unexpected GetMember result")
+	}
+
+	_, missing := dstate.GetMembers(tracker, testGuildID, []int64{1000, 5})
+	if len(missing) != 1 || missing[0] != 5 {
+		t.Fatal("unexpected missing members: ", missing)
+	}
+
+	messages := tracker.GetMessages(testGuildID, testChannelID, &dstate.MessagesQuery{Limit: 2})
+	if len(messages) != 2 || messages[0].ID != 4 || messages[1].ID != 3 {
+		t.Fatalf("unexpected messages: %v", messages)
+	}
+
+	messages = tracker.GetMessages(testGuildID, testChannelID, &dstate.MessagesQuery{RoleID: testRoleID, IncludeDeleted: true})
+	if len(messages) != 2 || messages[0].ID != 3 || messages[1].ID != 2 {
+		t.Fatalf("unexpected messages: %v", messages)
+	}
+
+	if len(tracker.GetShardGuilds(0)) != 1 {
+		t.Fatal("expected 1 guild on shard 0")
+	}
+
+	chunks := 0
+	tracker.IterateMembers(testGuildID, func(chunk []*dstate.MemberState) bool {
+		chunks++
+		if len(chunk) != 2 {
+			t.Fatal("expected 2 members in chunk, got: ", len(chunk))
+		}
+		return true
+	})
+
+	if chunks != 1 {
+		t.Fatal("expected 1 chunk, got: ", chunks)
+	}
+
+	calls := tracker.CallsTo("GetMember")
+	if len(calls) != 2 || calls[1].Args[1] != int64(5) {
+		t.Fatalf("unexpected calls: %#v", calls)
+	}
+
+	if len(tracker.Calls()) != 9 {
+		t.Fatal("unexpected number of calls: ", len(tracker.Calls()))
+	}
+
+	tracker.ResetCalls()
+	if len(tracker.Calls()) != 0 {
+		t.Fatal("calls not reset")
+	}
+}
@@ -0,0 +1,279 @@
+package dstatetest
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/jonas747/dstate/v3"
+)
+
+// Call is a recorded call to a Tracker method
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Tracker is a fake dstate.StateTracker that returns the fixtures added to it, and records all calls made to it
+// the fixtures are returned as is, so they should not be modified after being added
+type Tracker struct {
+	mu sync.Mutex
+
+	totalShards int64
+	guilds      map[int64]*dstate.GuildSet
+
+	// key is GuildID, kept in the order they were added
+	members map[int64][]*dstate.MemberState
+
+	// key is ChannelID, sorted by ID
+	messages map[int64][]*dstate.MessageState
+
+	calls []Call
+}
+
+var _ dstate.StateTracker = (*Tracker)(nil)
+var _ dstate.MemberBatchTracker = (*Tracker)(nil)
+var _ dstate.ShardCounter = (*Tracker)(nil)
+
+// NewTracker returns a empty tracker with a single shard
+func NewTracker() *Tracker {
+	return &Tracker{
+		totalShards: 1,
+		guilds:      make(map[int64]*dstate.GuildSet),
+		members:     make(map[int64][]*dstate.MemberState),
+		messages:    make(map[int64][]*dstate.MessageState),
+	}
+}
+
+// SetTotalShards sets the total shard count used to decide what shard guilds belong to in GetShardGuilds
+func (t *Tracker) SetTotalShards(totalShards int64) *Tracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.totalShards = totalShards
+	return t
+}
+
+// TotalShards implements dstate.ShardCounter
+func (t *Tracker) TotalShards() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.totalShards
+}
+
+// AddGuild adds the guilds, replacing existing ones with the same ID
+func (t *Tracker) AddGuild(guilds ...*dstate.GuildSet) *Tracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, v := range guilds {
+		t.guilds[v.ID] = v
+	}
+	return t
+}
+
+// AddMember adds the members, replacing existing ones with the same guild and user ID
+func (t *Tracker) AddMember(members ...*dstate.MemberState) *Tracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, v := range members {
+		guildMembers := t.members[v.GuildID]
+		replaced := false
+		for i, existing := range guildMembers {
+			if existing.User.ID == v.User.ID {
+				guildMembers[i] = v
+				replaced = true
+				break
+			}
+		}
+
+		if !replaced {
+			t.members[v.GuildID] = append(guildMembers, v)
+		}
+	}
+	return t
+}
+
+// AddMessage adds the messages, replacing existing ones with the same ID
+func (t *Tracker) AddMessage(messages ...*dstate.MessageState) *Tracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, v := range messages {
+		channelMessages := t.messages[v.ChannelID]
+		i := sort.Search(len(channelMessages), func(i int) bool {
+			return channelMessages[i].ID >= v.ID
+		})
+
+		if i < len(channelMessages) && channelMessages[i].ID == v.ID {
+			channelMessages[i] = v
+			continue
+		}
+
+		channelMessages = append(channelMessages, nil)
+		copy(channelMessages[i+1:], channelMessages[i:])
+		channelMessages[i] = v
+		t.messages[v.ChannelID] = channelMessages
+	}
+	return t
+}
+
+// Calls returns all the calls made so far, oldest first
+func (t *Tracker) Calls() []Call {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Call(nil), t.calls...)
+}
+
+// CallsTo returns the calls made to the method, oldest first
+func (t *Tracker) CallsTo(method string) []Call {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var result []Call
+	for _, v := range t.calls {
+		if v.Method == method {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// ResetCalls clears the recorded calls
+func (t *Tracker) ResetCalls() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.calls = nil
+}
+
+// assumes t.mu is locked
+func (t *Tracker) recordLocked(method string, args ...interface{}) {
+	t.calls = append(t.calls, Call{Method: method, Args: args})
+}
+
+func (t *Tracker) GetGuild(guildID int64) *dstate.GuildSet {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.recordLocked("GetGuild", guildID)
+	return t.guilds[guildID]
+}
+
+// GetShardGuilds panics if shardID is out of range, like the interface specifies
+func (t *Tracker) GetShardGuilds(shardID int64) []*dstate.GuildSet {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.recordLocked("GetShardGuilds", shardID)
+
+	if shardID < 0 || shardID >= t.totalShards {
+		panic("unknown shard")
+	}
+
+	var result []*dstate.GuildSet
+	for _, v := range t.guilds {
+		if (v.ID>>22)%t.totalShards == shardID {
+			result = append(result, v)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+func (t *Tracker) GetMember(guildID int64, memberID int64) *dstate.MemberState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.recordLocked("GetMember", guildID, memberID)
+	return t.getMemberLocked(guildID, memberID)
+}
+
+// assumes t.mu is locked
+func (t *Tracker) getMemberLocked(guildID int64, memberID int64) *dstate.MemberState {
+	for _, v := range t.members[guildID] {
+		if v.User.ID == memberID {
+			return v
+		}
+	}
+
+	return nil
+}
+
+func (t *Tracker) GetMembers(guildID int64, ids []int64) (members []*dstate.MemberState, missing []int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.recordLocked("GetMembers", guildID, ids)
+
+	members = make([]*dstate.MemberState, len(ids))
+	for i, id := range ids {
+		members[i] = t.getMemberLocked(guildID, id)
+		if members[i] == nil {
+			missing = append(missing, id)
+		}
+	}
+
+	return members, missing
+}
+
+// GetMessages applies the query like the real trackers, newest messages first
+func (t *Tracker) GetMessages(guildID int64, channelID int64, query *dstate.MessagesQuery) []*dstate.MessageState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.recordLocked("GetMessages", guildID, channelID, query)
+
+	result := query.Buf[:0]
+	channelMessages := t.messages[channelID]
+	for i := len(channelMessages) - 1; i >= 0; i-- {
+		if query.Limit > 0 && len(result) >= query.Limit {
+			break
+		}
+
+		m := channelMessages[i]
+		if m.GuildID != guildID {
+			continue
+		}
+
+		if query.Before != 0 && m.ID >= query.Before {
+			continue
+		}
+
+		if query.After != 0 && m.ID <= query.After {
+			break
+		}
+
+		// prefer the roles of the cached member over the ones on the message, like the real trackers
+		var roles []int64
+		var rolesKnown bool
+		if ms := t.getMemberLocked(guildID, m.Author.ID); ms != nil && ms.Member != nil {
+			roles, rolesKnown = ms.Member.Roles, true
+		}
+
+		if !query.Match(m, roles, rolesKnown) {
+			continue
+		}
+
+		result = append(result, m)
+	}
+
+	return result
+}
+
+// IterateMembers calls f with all the members of the guild in a single chunk, in the order they were added
+func (t *Tracker) IterateMembers(guildID int64, f func(chunk []*dstate.MemberState) bool) {
+	t.mu.Lock()
+	t.recordLocked("IterateMembers", guildID)
+	members := append([]*dstate.MemberState(nil), t.members[guildID]...)
+	t.mu.Unlock()
+
+	if len(members) > 0 {
+		f(members)
+	}
+}
@@ -67,6 +67,16 @@ func MessageStateFromDgo(m *discordgo.Message) *MessageState {
 		author = *m.Author
 	}
 
+	var reactions []MessageReactionState
+	if len(m.Reactions) > 0 {
+		reactions = make([]MessageReactionState, 0, len(m.Reactions))
+		for _, v := range m.Reactions {
+			if v.Emoji != nil {
+				reactions = append(reactions, MessageReactionState{Emoji: *v.Emoji, Count: v.Count})
+			}
+		}
+	}
+
 	parsedC, _ := m.Timestamp.Parse()
 	var parsedE time.Time
 	if m.EditedTimestamp != "" {
@@ -87,6 +97,7 @@ func MessageStateFromDgo(m *discordgo.Message) *MessageState {
 		MentionRoles:    m.MentionRoles,
 		ParsedCreatedAt: parsedC,
 		ParsedEditedAt:  parsedE,
+		Reactions:       reactions,
 	}
 }
 
@@ -116,22 +127,6 @@ func MemberStateFromPresence(p *discordgo.PresenceUpdate) *MemberState {
 		}
 	}
 
-	// update the rest
-	var status PresenceStatus
-
-	switch p.Status {
-	case discordgo.StatusOnline:
-		status = StatusOnline
-	case discordgo.StatusIdle:
-		status = StatusIdle
-	case discordgo.StatusDoNotDisturb:
-		status = StatusDoNotDisturb
-	case discordgo.StatusInvisible:
-		status = StatusInvisible
-	case discordgo.StatusOffline:
-		status = StatusOffline
-	}
-
 	return &MemberState{
 		User:    user,
 		GuildID: p.GuildID,
@@ -139,11 +134,55 @@ func MemberStateFromPresence(p *discordgo.PresenceUpdate) *MemberState {
 		Member: nil,
 		Presence: &PresenceFields{
 			Game:   lg,
-			Status: status,
+			Status: PresenceStatusFromDgo(p.Status),
 		},
 	}
 }
 
+// MemberStateFromPresenceFull works like MemberStateFromPresence but also keeps all the activities in PresenceFields.Activities
+// discordgo does not decode the activity assets and emojis, or the client status, use PresenceUpdate and MemberStateFromGatewayPresenceFull for those
+func MemberStateFromPresenceFull(p *discordgo.PresenceUpdate) *MemberState {
+	ms := MemberStateFromPresence(p)
+
+	if len(p.Activities) > 0 {
+		activities := make([]*Activity, len(p.Activities))
+		for i, v := range p.Activities {
+			activities[i] = &Activity{
+				LightGame: LightGame{
+					Name:    v.Name,
+					Details: v.Details,
+					URL:     v.URL,
+					State:   v.State,
+					Type:    v.Type,
+				},
+				TimeStamps:    v.TimeStamps,
+				ApplicationID: v.ApplicationID,
+			}
+		}
+		ms.Presence.Activities = activities
+	}
+
+	return ms
+}
+
+// PresenceStatusFromDgo converts a discordgo status to a PresenceStatus, unknown or empty statuses become StatusNotSet
+func PresenceStatusFromDgo(s discordgo.Status) PresenceStatus {
+	switch s {
+	case discordgo.StatusOnline:
+		return StatusOnline
+	case discordgo.StatusIdle:
+		return StatusIdle
+	case discordgo.StatusDoNotDisturb:
+		return StatusDoNotDisturb
+	case discordgo.StatusInvisible:
+		return StatusInvisible
+	case discordgo.StatusOffline:
+		return StatusOffline
+	}
+
+	return StatusNotSet
+}
+
 func ChannelStateFromDgo(c *discordgo.Channel) ChannelState {
 	pos := make([]discordgo.PermissionOverwrite, len(c.PermissionOverwrites))
 	for i, v := range c.PermissionOverwrites {
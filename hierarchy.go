@@ -0,0 +1,272 @@
+package dstate
+
+import (
+	"strconv"
+
+	"github.com/jonas747/discordgo"
+)
+
+type ModerationAction int
+
+const (
+	ModerationActionKick ModerationAction = iota + 1
+	ModerationActionBan
+	ModerationActionEditRole
+	ModerationActionAssignRole
+)
+
+func (a ModerationAction) String() string {
+	switch a {
+	case ModerationActionKick:
+		return "kick"
+	case ModerationActionBan:
+		return "ban"
+	case ModerationActionEditRole:
+		return "edit role"
+	case ModerationActionAssignRole:
+		return "assign role"
+	}
+
+	return "unknown (" + strconv.Itoa(int(a)) + ")"
+}
+
+type ModerationDenyReason int
+
+const (
+	// The actor is missing the required permission, see ErrModerationDenied.Permission
+	ModerationDenyMissingPermissions ModerationDenyReason = iota + 1
+
+	// The actor or target only has presence data cached, so their roles are not known
+	ModerationDenyMemberNotCached
+
+	ModerationDenySelf
+	ModerationDenyTargetIsOwner
+
+	// The target's highest role is higher or equal to the actor's highest role
+	ModerationDenyTargetHigherOrEqual
+
+	// The role is higher or equal to the actor's highest role
+	ModerationDenyRoleHigherOrEqual
+
+	// The role is managed by a integration, or is the @everyone role
+	ModerationDenyRoleNotAssignable
+
+	ModerationDenyRoleNotFound
+)
+
+func (r ModerationDenyReason) String() string {
+	switch r {
+	case ModerationDenyMissingPermissions:
+		return "missing permissions"
+	case ModerationDenyMemberNotCached:
+		return "member not cached"
+	case ModerationDenySelf:
+		return "can't target yourself"
+	case ModerationDenyTargetIsOwner:
+		return "target is the owner"
+	case ModerationDenyTargetHigherOrEqual:
+		return "target has a higher or equal role"
+	case ModerationDenyRoleHigherOrEqual:
+		return "role is higher or equal to your highest role"
+	case ModerationDenyRoleNotAssignable:
+		return "role is not assignable"
+	case ModerationDenyRoleNotFound:
+		return "role not found"
+	}
+
+	return "unknown (" + strconv.Itoa(int(r)) + ")"
+}
+
+var _ error = (*ErrModerationDenied)(nil)
+
+// ErrModerationDenied is returned by the moderation capability checks when the action is not allowed
+type ErrModerationDenied struct {
+	Action ModerationAction
+	Reason ModerationDenyReason
+
+	// Set if the reason is ModerationDenyMissingPermissions
+	Permission int64
+
+	// Set for the role related actions
+	RoleID int64
+}
+
+func (e *ErrModerationDenied) Error() string {
+	return "Can't " + e.Action.String() + ": " + e.Reason.String()
+}
+
+// IsModerationDenied returns true if a ErrModerationDenied, and also the reason if it was
+func IsModerationDenied(e error) (bool, ModerationDenyReason) {
+	if md, ok := e.(*ErrModerationDenied); ok {
+		return true, md.Reason
+	}
+
+	return false, 0
+}
+
+// HighestRole returns the highest of the provided roles, ignoring roles not in the guild
+// returns nil if none of them were found
+func (gs *GuildSet) HighestRole(roles []int64) *discordgo.Role {
+	var highest *discordgo.Role
+	for i := range gs.Roles {
+		role := &gs.Roles[i]
+		if !containsID(roles, role.ID) {
+			continue
+		}
+
+		if highest == nil || IsRoleAbove(role, highest) {
+			highest = role
+		}
+	}
+
+	return highest
+}
+
+// HighestMemberRole returns the highest role of the member, or nil if they have no roles or ms.Member is not available
+func (gs *GuildSet) HighestMemberRole(ms *MemberState) *discordgo.Role {
+	if ms.Member == nil {
+		return nil
+	}
+
+	return gs.HighestRole(ms.Member.Roles)
+}
+
+// CompareMemberHierarchy returns 1 if a is above b in the role hierarchy, -1 if below and 0 if they're equal
+// the owner is above everyone else, and members without roles are below everyone with roles
+func (gs *GuildSet) CompareMemberHierarchy(a, b *MemberState) int {
+	if a.User.ID == b.User.ID {
+		return 0
+	}
+
+	if a.User.ID == gs.OwnerID {
+		return 1
+	} else if b.User.ID == gs.OwnerID {
+		return -1
+	}
+
+	return compareRoles(gs.HighestMemberRole(a), gs.HighestMemberRole(b))
+}
+
+func compareRoles(a, b *discordgo.Role) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case b == nil:
+		return 1
+	case a == nil:
+		return -1
+	case a.ID == b.ID:
+		return 0
+	case IsRoleAbove(a, b):
+		return 1
+	default:
+		return -1
+	}
+}
+
+// CanKick returns nil if actor is able to kick target, otherwise a ErrModerationDenied with the reason
+func (gs *GuildSet) CanKick(actor *MemberState, target *MemberState) error {
+	if target == nil {
+		return &ErrModerationDenied{Action: ModerationActionKick, Reason: ModerationDenyMemberNotCached}
+	}
+
+	return gs.canModerateMember(ModerationActionKick, discordgo.PermissionKickMembers, actor, target)
+}
+
+// CanBan returns nil if actor is able to ban target, otherwise a ErrModerationDenied with the reason
+// target may be nil if the user is not a member of the guild, in which case only the permissions are checked
+func (gs *GuildSet) CanBan(actor *MemberState, target *MemberState) error {
+	if target == nil {
+		return gs.checkModerationPerms(ModerationActionBan, discordgo.PermissionBanMembers, actor)
+	}
+
+	return gs.canModerateMember(ModerationActionBan, discordgo.PermissionBanMembers, actor, target)
+}
+
+// CanEditRole returns nil if actor is able to edit the role, otherwise a ErrModerationDenied with the reason
+func (gs *GuildSet) CanEditRole(actor *MemberState, roleID int64) error {
+	return gs.canManageRole(ModerationActionEditRole, actor, roleID)
+}
+
+// CanAssignRole returns nil if actor is able to give or take the role from members, otherwise a ErrModerationDenied with the reason
+// unlike kicks and bans, assigning roles does not depend on the target's roles
+func (gs *GuildSet) CanAssignRole(actor *MemberState, roleID int64) error {
+	if err := gs.canManageRole(ModerationActionAssignRole, actor, roleID); err != nil {
+		return err
+	}
+
+	role := gs.GetRole(roleID)
+	if role.Managed || role.ID == gs.ID {
+		return &ErrModerationDenied{Action: ModerationActionAssignRole, Reason: ModerationDenyRoleNotAssignable, RoleID: roleID}
+	}
+
+	return nil
+}
+
+func (gs *GuildSet) canModerateMember(action ModerationAction, perm int64, actor *MemberState, target *MemberState) error {
+	if actor.User.ID == target.User.ID {
+		return &ErrModerationDenied{Action: action, Reason: ModerationDenySelf}
+	}
+
+	if target.User.ID == gs.OwnerID {
+		return &ErrModerationDenied{Action: action, Reason: ModerationDenyTargetIsOwner}
+	}
+
+	if err := gs.checkModerationPerms(action, perm, actor); err != nil {
+		return err
+	}
+
+	if actor.User.ID == gs.OwnerID {
+		return nil
+	}
+
+	if target.Member == nil {
+		return &ErrModerationDenied{Action: action, Reason: ModerationDenyMemberNotCached}
+	}
+
+	if gs.CompareMemberHierarchy(actor, target) <= 0 {
+		return &ErrModerationDenied{Action: action, Reason: ModerationDenyTargetHigherOrEqual}
+	}
+
+	return nil
+}
+
+func (gs *GuildSet) canManageRole(action ModerationAction, actor *MemberState, roleID int64) error {
+	role := gs.GetRole(roleID)
+	if role == nil {
+		return &ErrModerationDenied{Action: action, Reason: ModerationDenyRoleNotFound, RoleID: roleID}
+	}
+
+	if err := gs.checkModerationPerms(action, discordgo.PermissionManageRoles, actor); err != nil {
+		err.(*ErrModerationDenied).RoleID = roleID
+		return err
+	}
+
+	if actor.User.ID == gs.OwnerID {
+		return nil
+	}
+
+	if compareRoles(gs.HighestMemberRole(actor), role) <= 0 {
+		return &ErrModerationDenied{Action: action, Reason: ModerationDenyRoleHigherOrEqual, RoleID: roleID}
+	}
+
+	return nil
+}
+
+// checks the guild wide permissions of the actor
+func (gs *GuildSet) checkModerationPerms(action ModerationAction, perm int64, actor *MemberState) error {
+	if actor.User.ID == gs.OwnerID {
+		return nil
+	}
+
+	if actor.Member == nil {
+		return &ErrModerationDenied{Action: action, Reason: ModerationDenyMemberNotCached}
+	}
+
+	perms := CalculatePermissions(&gs.GuildState, gs.Roles, nil, actor.User.ID, actor.Member.Roles)
+	if perms&perm != perm {
+		return &ErrModerationDenied{Action: action, Reason: ModerationDenyMissingPermissions, Permission: perm}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package dstate
+
+import (
+	"testing"
+
+	"github.com/jonas747/discordgo"
+)
+
+func createHierarchyTestGuild() *GuildSet {
+	return &GuildSet{
+		GuildState: GuildState{
+			ID:      1,
+			OwnerID: 1000,
+		},
+		Roles: []discordgo.Role{
+			{ID: 10, Position: 3, Permissions: discordgo.PermissionAdministrator},
+			{ID: 11, Position: 2, Permissions: discordgo.PermissionKickMembers | discordgo.PermissionBanMembers | discordgo.PermissionManageRoles},
+			{ID: 12, Position: 1},
+			{ID: 13, Position: 1, Managed: true},
+			{ID: 1, Position: 0},
+		},
+	}
+}
+
+func createHierarchyTestMember(id int64, roles ...int64) *MemberState {
+	return &MemberState{
+		User:    discordgo.User{ID: id},
+		GuildID: 1,
+		Member:  &MemberFields{Roles: roles},
+	}
+}
+
+func expectModerationReason(t *testing.T, err error, expected ModerationDenyReason) {
+	t.Helper()
+
+	if expected == 0 {
+		if err != nil {
+			t.Fatal("expected no error, got: ", err)
+		}
+		return
+	}
+
+	if is, reason := IsModerationDenied(err); !is || reason != expected {
+		t.Fatalf("expected reason %q, got: %v", expected, err)
+	}
+}
+
+func TestHighestRole(t *testing.T) {
+	gs := createHierarchyTestGuild()
+
+	if r := gs.HighestRole([]int64{12, 11, 999}); r == nil || r.ID != 11 {
+		t.Fatalf("incorrect highest role: %#v", r)
+	}
+
+	// same position, lower id is higher
+	if r := gs.HighestRole([]int64{13, 12}); r == nil || r.ID != 12 {
+		t.Fatalf("incorrect highest role: %#v", r)
+	}
+
+	if r := gs.HighestRole(nil); r != nil {
+		t.Fatalf("expected nil, got: %#v", r)
+	}
+}
+
+func TestCompareMemberHierarchy(t *testing.T) {
+	gs := createHierarchyTestGuild()
+
+	owner := createHierarchyTestMember(1000)
+	admin := createHierarchyTestMember(1001, 10)
+	mod := createHierarchyTestMember(1002, 11, 12)
+	noRoles := createHierarchyTestMember(1003)
+
+	if gs.CompareMemberHierarchy(owner, admin) != 1 || gs.CompareMemberHierarchy(admin, owner) != -1 {
+		t.Fatal("owner should be above everyone")
+	}
+
+	if gs.CompareMemberHierarchy(admin, mod) != 1 || gs.CompareMemberHierarchy(mod, admin) != -1 {
+		t.Fatal("admin should be above mod")
+	}
+
+	if gs.CompareMemberHierarchy(mod, noRoles) != 1 || gs.CompareMemberHierarchy(noRoles, createHierarchyTestMember(1004)) != 0 {
+		t.Fatal("incorrect comparison of members without roles")
+	}
+}
+
+func TestModerationChecks(t *testing.T) {
+	gs := createHierarchyTestGuild()
+
+	owner := createHierarchyTestMember(1000)
+	admin := createHierarchyTestMember(1001, 10)
+	mod := createHierarchyTestMember(1002, 11)
+	mod2 := createHierarchyTestMember(1003, 11)
+	user := createHierarchyTestMember(1004, 12)
+	presenceOnly := &MemberState{User: discordgo.User{ID: 1005}}
+
+	expectModerationReason(t, gs.CanKick(owner, admin), 0)
+	expectModerationReason(t, gs.CanKick(admin, owner), ModerationDenyTargetIsOwner)
+	expectModerationReason(t, gs.CanKick(mod, user), 0)
+	expectModerationReason(t, gs.CanKick(mod, mod2), ModerationDenyTargetHigherOrEqual)
+	expectModerationReason(t, gs.CanKick(mod, admin), ModerationDenyTargetHigherOrEqual)
+	expectModerationReason(t, gs.CanKick(mod, mod), ModerationDenySelf)
+	expectModerationReason(t, gs.CanKick(user, createHierarchyTestMember(1006)), ModerationDenyMissingPermissions)
+	expectModerationReason(t, gs.CanKick(mod, presenceOnly), ModerationDenyMemberNotCached)
+	expectModerationReason(t, gs.CanKick(mod, nil), ModerationDenyMemberNotCached)
+
+	expectModerationReason(t, gs.CanBan(mod, nil), 0)
+	expectModerationReason(t, gs.CanBan(user, nil), ModerationDenyMissingPermissions)
+	expectModerationReason(t, gs.CanBan(admin, mod), 0)
+
+	expectModerationReason(t, gs.CanEditRole(mod, 12), 0)
+	expectModerationReason(t, gs.CanEditRole(mod, 11), ModerationDenyRoleHigherOrEqual)
+	expectModerationReason(t, gs.CanEditRole(mod, 999), ModerationDenyRoleNotFound)
+	expectModerationReason(t, gs.CanEditRole(user, 1), ModerationDenyMissingPermissions)
+	expectModerationReason(t, gs.CanEditRole(owner, 10), 0)
+
+	expectModerationReason(t, gs.CanAssignRole(mod, 12), 0)
+	expectModerationReason(t, gs.CanAssignRole(mod, 13), ModerationDenyRoleNotAssignable)
+	expectModerationReason(t, gs.CanAssignRole(mod, 1), ModerationDenyRoleNotAssignable)
+	expectModerationReason(t, gs.CanAssignRole(admin, 10), ModerationDenyRoleHigherOrEqual)
+}
@@ -8,8 +8,7 @@ import (
 var _ dstate.StateTracker = (*InMemoryTracker)(nil)
 
 func (tracker *InMemoryTracker) GetGuild(guildID int64) *dstate.GuildSet {
-	shard := tracker.getGuildShard(guildID)
-	shard.mu.RLock()
+	shard := tracker.rlockGuildShard(guildID)
 	defer shard.mu.RUnlock()
 
 	set, ok := shard.guilds[guildID]
@@ -17,23 +16,36 @@ func (tracker *InMemoryTracker) GetGuild(guildID int64) *dstate.GuildSet {
 		return nil
 	}
 
-	return &dstate.GuildSet{
-		GuildState:  *set.Guild,
-		Channels:    set.Channels,
-		Roles:       set.Roles,
-		Emojis:      set.Emojis,
-		VoiceStates: set.VoiceStates,
-	}
+	return set.guildSet()
 }
 
 func (tracker *InMemoryTracker) GetMember(guildID int64, memberID int64) *dstate.MemberState {
-	shard := tracker.getGuildShard(guildID)
-	shard.mu.RLock()
+	shard := tracker.rlockGuildShard(guildID)
 	defer shard.mu.RUnlock()
 
 	return shard.getMemberLocked(guildID, memberID)
 }
 
+var _ dstate.MemberBatchTracker = (*InMemoryTracker)(nil)
+
+// GetMembers implements dstate.MemberBatchTracker, all the members are looked up under a single read lock
+func (tracker *InMemoryTracker) GetMembers(guildID int64, ids []int64) (members []*dstate.MemberState, missing []int64) {
+	shard := tracker.rlockGuildShard(guildID)
+	defer shard.mu.RUnlock()
+
+	members = make([]*dstate.MemberState, len(ids))
+	guildMembers := shard.members[guildID]
+	for i, id := range ids {
+		if ms, ok := guildMembers[id]; ok {
+			members[i] = &ms.MemberState
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	return members, missing
+}
+
 func (shard *ShardTracker) getMemberLocked(guildID int64, memberID int64) *dstate.MemberState {
 
 	if members, ok := shard.members[guildID]; ok {
@@ -46,8 +58,7 @@ func (shard *ShardTracker) getMemberLocked(guildID int64, memberID int64) *dstat
 }
 
 func (tracker *InMemoryTracker) GetMemberPermissions(guildID int64, channelID int64, memberID int64) (perms int64, ok bool) {
-	shard := tracker.getGuildShard(guildID)
-	shard.mu.RLock()
+	shard := tracker.rlockGuildShard(guildID)
 	defer shard.mu.RUnlock()
 
 	member := shard.getMemberLocked(guildID, memberID)
@@ -59,8 +70,7 @@ func (tracker *InMemoryTracker) GetMemberPermissions(guildID int64, channelID in
 }
 
 func (tracker *InMemoryTracker) GetRolePermisisons(guildID int64, channelID int64, memberID int64, roles []int64) (perms int64, ok bool) {
-	shard := tracker.getGuildShard(guildID)
-	shard.mu.RLock()
+	shard := tracker.rlockGuildShard(guildID)
 	defer shard.mu.RUnlock()
 
 	return tracker.getRolePermisisonsLocked(shard, guildID, channelID, memberID, roles)
@@ -76,7 +86,7 @@ func (tracker *InMemoryTracker) getRolePermisisonsLocked(shard *ShardTracker, gu
 
 	var overwrites []discordgo.PermissionOverwrite
 
-	if channel := guild.channel(channelID); channel != nil {
+	if channel := guild.permissionsChannel(channelID); channel != nil {
 		overwrites = channel.PermissionOverwrites
 	} else if channelID != 0 {
 		// we still continue as far as we can with the calculations even though we can't apply channel permissions
@@ -87,50 +97,35 @@ func (tracker *InMemoryTracker) getRolePermisisonsLocked(shard *ShardTracker, gu
 	return perms, ok
 }
 
-func (tracker *InMemoryTracker) getGuildShard(guildID int64) *ShardTracker {
-	shardID := int((guildID >> 22) % tracker.totalShards)
-	return tracker.shards[shardID]
-}
-
-func (tracker *InMemoryTracker) getShard(shardID int64) *ShardTracker {
-	return tracker.shards[shardID]
-}
-
-func (tracker *InMemoryTracker) cloneMembers(guildID int64) []*dstate.MemberState {
-	shard := tracker.getGuildShard(guildID)
-	shard.mu.RLock()
+// GetThreadMembers returns the cached members of a thread
+// note that discord only sends thread members for the bot itself unless you have the GUILD_MEMBERS intent
+func (tracker *InMemoryTracker) GetThreadMembers(guildID int64, threadID int64) []*dstate.ThreadMember {
+	shard := tracker.rlockGuildShard(guildID)
 	defer shard.mu.RUnlock()
 
-	members, ok := shard.members[guildID]
-	if !ok {
-		return nil
-	}
-
-	membersCop := make([]*dstate.MemberState, 0, len(members))
-	if cap(membersCop) < 1 {
+	members := shard.threadMembers[threadID]
+	if len(members) < 1 {
 		return nil
 	}
 
+	result := make([]*dstate.ThreadMember, 0, len(members))
 	for _, v := range members {
-		membersCop = append(membersCop, &v.MemberState)
+		result = append(result, v)
 	}
 
-	return membersCop
+	return result
 }
 
-// this IterateMembers implementation is very simple, it makes a full copy of the member slice and calls f in one chunk
-func (tracker *InMemoryTracker) IterateMembers(guildID int64, f func(chunk []*dstate.MemberState) bool) {
-	members := tracker.cloneMembers(guildID)
-	if len(members) < 1 {
-		return // nothing to do
-	}
+func (tracker *InMemoryTracker) getGuildShard(guildID int64) *ShardTracker {
+	return tracker.getLayout().guildShard(guildID)
+}
 
-	f(members)
+func (tracker *InMemoryTracker) getShard(shardID int64) *ShardTracker {
+	return tracker.getLayout().shards[shardID]
 }
 
 func (tracker *InMemoryTracker) GetMessages(guildID int64, channelID int64, query *dstate.MessagesQuery) []*dstate.MessageState {
-	shard := tracker.getGuildShard(guildID)
-	shard.mu.RLock()
+	shard := tracker.rlockGuildShard(guildID)
 	defer shard.mu.RUnlock()
 
 	messages := shard.messages[channelID]
@@ -138,73 +133,22 @@ func (tracker *InMemoryTracker) GetMessages(guildID int64, channelID int64, quer
 		return nil
 	}
 
-	limit := query.Limit
-	if limit < 1 {
-		limit = messages.Len()
-	}
-
-	buf := query.Buf
-	if buf != nil && cap(buf) >= limit {
-		buf = buf[:limit]
-	} else {
-		buf = make([]*dstate.MessageState, limit)
-	}
-
-	i := 0
-	for e := messages.Back(); e != nil; e = e.Prev() {
-		cast := e.Value.(*dstate.MessageState)
-		include, cont := checkMessage(query, cast)
-		if include {
-			buf[i] = cast
-			i++
-
-			if i >= limit {
-				break
-			}
-		}
-
-		if !cont {
-			break
+	return messages.query(query, func(userID int64) ([]int64, bool) {
+		if ms := shard.getMemberLocked(guildID, userID); ms != nil && ms.Member != nil {
+			return ms.Member.Roles, true
 		}
-	}
-
-	return buf[:i]
-}
-
-func checkMessage(q *dstate.MessagesQuery, m *dstate.MessageState) (include bool, continueIter bool) {
-	if q.Before != 0 && m.ID >= q.Before {
-		return false, true
-	}
-
-	if q.After != 0 && m.ID <= q.After {
-		return false, false
-	}
-
-	if !q.IncludeDeleted && m.Deleted {
-		return false, true
-	}
 
-	return true, true
+		return nil, false
+	})
 }
 
 func (tracker *InMemoryTracker) GetShardGuilds(shardID int64) []*dstate.GuildSet {
-	shard := tracker.getShard(shardID)
-	if shard == nil {
-		return nil
-	}
-
-	shard.mu.RLock()
+	shard := tracker.rlockShard(shardID)
 	defer shard.mu.RUnlock()
 
 	gCop := make([]*dstate.GuildSet, 0, len(shard.guilds))
 	for _, v := range shard.guilds {
-		gCop = append(gCop, &dstate.GuildSet{
-			GuildState:  *v.Guild,
-			Channels:    v.Channels,
-			Roles:       v.Roles,
-			Emojis:      v.Emojis,
-			VoiceStates: v.VoiceStates,
-		})
+		gCop = append(gCop, v.guildSet())
 	}
 
 	return gCop
@@ -212,26 +156,17 @@ func (tracker *InMemoryTracker) GetShardGuilds(shardID int64) []*dstate.GuildSet
 
 // SetGuild allows you to manually add guilds to the state tracker, for example when recovering state
 func (tracker *InMemoryTracker) SetGuild(gs *dstate.GuildSet) {
-	shard := tracker.getGuildShard(gs.ID)
-	if shard == nil {
-		panic("unknown shard")
-	}
-
-	shard.mu.Lock()
+	shard := tracker.lockGuildShard(gs.ID)
 	defer shard.mu.Unlock()
 
 	shard.guilds[gs.ID] = SparseGuildStateFromDstate(gs)
+	shard.guildSlots.add(gs.ID)
 
 }
 
 // SetMember allows you to manually add members to the state tracker, for example for caching reasons
 func (tracker *InMemoryTracker) SetMember(ms *dstate.MemberState) {
-	shard := tracker.getGuildShard(ms.GuildID)
-	if shard == nil {
-		panic("unknown shard")
-	}
-
-	shard.mu.Lock()
+	shard := tracker.lockGuildShard(ms.GuildID)
 	defer shard.mu.Unlock()
 
 	shard.innerHandleMemberUpdate(ms)
@@ -240,12 +175,7 @@ func (tracker *InMemoryTracker) SetMember(ms *dstate.MemberState) {
 // DelShard allows you to manually reset shards in the state
 // notice how i said reset and not delete, as the shards themselves are fixed.
 func (tracker *InMemoryTracker) DelShard(shardID int64) {
-	shard := tracker.getShard(shardID)
-	if shard == nil {
-		panic("unknown shard")
-	}
-
-	shard.mu.Lock()
+	shard := tracker.lockShard(shardID)
 	defer shard.mu.Unlock()
 
 	shard.reset()
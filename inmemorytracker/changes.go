@@ -0,0 +1,106 @@
+package inmemorytracker
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/jonas747/dstate/v3"
+)
+
+var _ dstate.ChangeSubscriber = (*InMemoryTracker)(nil)
+
+// Subscribe implements dstate.ChangeSubscriber
+//
+// f is mostly called from HandleEvent while it holds the lock that keeps the shards from being resharded,
+// so it must not call Reshard or RunGCLoop, as they wait for event handling to finish and would deadlock
+func (tracker *InMemoryTracker) Subscribe(f func(change dstate.StateChange)) (unsubscribe func()) {
+	return tracker.changes.subscribe(f)
+}
+
+// changeBroker is shared between all the shards of a tracker
+type changeBroker struct {
+	mu     sync.RWMutex
+	subs   map[int]func(dstate.StateChange)
+	nextID int
+
+	// number of subscribers, checked without the lock so that we don't build changes when theres no one listening
+	numSubs int32
+}
+
+func newChangeBroker() *changeBroker {
+	return &changeBroker{
+		subs: make(map[int]func(dstate.StateChange)),
+	}
+}
+
+func (b *changeBroker) subscribe(f func(dstate.StateChange)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+
+	b.subs[id] = f
+	atomic.StoreInt32(&b.numSubs, int32(len(b.subs)))
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			delete(b.subs, id)
+			atomic.StoreInt32(&b.numSubs, int32(len(b.subs)))
+		})
+	}
+}
+
+func (b *changeBroker) active() bool {
+	return atomic.LoadInt32(&b.numSubs) > 0
+}
+
+func (b *changeBroker) dispatch(changes []dstate.StateChange) {
+	// copy the subscribers so that they're free to unsubscribe from within the callback
+	b.mu.RLock()
+	subs := make([]func(dstate.StateChange), 0, len(b.subs))
+	for _, f := range b.subs {
+		subs = append(subs, f)
+	}
+	b.mu.RUnlock()
+
+	for _, c := range changes {
+		for _, f := range subs {
+			f(c)
+		}
+	}
+}
+
+// emit queues a change to be dispatched once the event has been handled
+// callers should check changes.active() before building the change, to avoid the allocations when there's no subscribers
+// assumes state is locked
+func (shard *ShardTracker) emit(change dstate.StateChange) {
+	if !shard.changes.active() {
+		return
+	}
+
+	shard.pendingChanges = append(shard.pendingChanges, change)
+	atomic.StoreInt32(&shard.hasPendingChanges, 1)
+}
+
+// flushChanges dispatches the queued changes, this is called after the handler has released the lock
+// the queue is shared by the shard, so this may dispatch changes queued by other goroutines, and several flushes may run at the same time
+func (shard *ShardTracker) flushChanges() {
+	if atomic.LoadInt32(&shard.hasPendingChanges) == 0 {
+		return
+	}
+
+	shard.mu.Lock()
+	changes := shard.pendingChanges
+	shard.pendingChanges = nil
+	atomic.StoreInt32(&shard.hasPendingChanges, 0)
+	shard.mu.Unlock()
+
+	if len(changes) > 0 {
+		shard.changes.dispatch(changes)
+	}
+}
@@ -0,0 +1,81 @@
+package inmemorytracker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+func TestChangeSubscription(t *testing.T) {
+	tracker := createTestState(TrackerConfig{})
+
+	var changes []dstate.StateChange
+	unsub := tracker.Subscribe(func(change dstate.StateChange) {
+		// the lock should be released at this point
+		if tracker.GetGuild(initialTestGuildID) == nil {
+			t.Error("guild not found from within subscription")
+		}
+
+		changes = append(changes, change)
+	})
+
+	updt := createTestChannel(initialTestGuildID, initialTestChannelID, nil)
+	updt.Name = "new name"
+	tracker.HandleEvent(testSession, &discordgo.ChannelUpdate{Channel: updt})
+
+	if len(changes) != 1 {
+		t.Fatalf("unexpected amount of changes: %d", len(changes))
+	}
+
+	cc, ok := changes[0].(*dstate.ChannelChange)
+	if !ok {
+		t.Fatalf("unexpected change type: %T", changes[0])
+	}
+
+	if cc.Old == nil || cc.New == nil || cc.Old.Name == cc.New.Name || cc.New.Name != "new name" {
+		t.Fatalf("incorrect channel change: old: %#v, new: %#v", cc.Old, cc.New)
+	}
+
+	// member removal
+	changes = nil
+	tracker.HandleEvent(testSession, &discordgo.GuildMemberRemove{
+		Member: createTestMember(initialTestGuildID, initialTestMemberID, nil),
+	})
+
+	if len(changes) != 1 {
+		t.Fatalf("unexpected amount of changes: %d", len(changes))
+	}
+
+	mc, ok := changes[0].(*dstate.MemberChange)
+	if !ok || mc.New != nil || mc.Old == nil || mc.Old.User.ID != initialTestMemberID {
+		t.Fatalf("incorrect member change: %#v", changes[0])
+	}
+
+	// message update
+	tracker.HandleEvent(testSession, &discordgo.MessageCreate{
+		Message: createTestMessage(10000, time.Now()),
+	})
+
+	changes = nil
+	updatedMsg := createTestMessage(10000, time.Now())
+	updatedMsg.Content = "edited"
+	tracker.HandleEvent(testSession, &discordgo.MessageUpdate{Message: updatedMsg})
+
+	if len(changes) != 1 {
+		t.Fatalf("unexpected amount of changes: %d", len(changes))
+	}
+
+	msgc, ok := changes[0].(*dstate.MessageChange)
+	if !ok || msgc.Old.Content != "test message" || msgc.New.Content != "edited" {
+		t.Fatalf("incorrect message change: %#v", changes[0])
+	}
+
+	unsub()
+	changes = nil
+	tracker.HandleEvent(testSession, &discordgo.ChannelUpdate{Channel: updt})
+	if len(changes) != 0 {
+		t.Fatal("received changes after unsubscribing")
+	}
+}
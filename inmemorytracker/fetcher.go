@@ -0,0 +1,196 @@
+package inmemorytracker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+// DefaultMemberNotFoundTTL is used if TrackerConfig.MemberNotFoundTTL is not set
+const DefaultMemberNotFoundTTL = time.Minute
+
+// ErrNoMemberFetcher is returned by FetchMember if TrackerConfig.MemberFetcher is not set
+var ErrNoMemberFetcher = errors.New("inmemorytracker: no member fetcher configured")
+
+// MemberFetcher fetches a member that's not cached, for example discordgo's Session.GuildMember
+// if the user is not a member of the guild it should return a nil member, or a *discordgo.RESTError with a 404 status
+type MemberFetcher func(guildID int64, memberID int64) (*discordgo.Member, error)
+
+type memberFetchKey struct {
+	GuildID  int64
+	MemberID int64
+}
+
+// a in progress fetch, done is closed once ms and err are set
+type memberFetch struct {
+	done chan struct{}
+	ms   *dstate.MemberState
+	err  error
+}
+
+type memberFetcher struct {
+	fetch       MemberFetcher
+	notFoundTTL time.Duration
+
+	mu       sync.Mutex
+	inflight map[memberFetchKey]*memberFetch
+
+	// members that were not found, and when that expires
+	notFound  map[memberFetchKey]time.Time
+	nextPrune int
+}
+
+func newMemberFetcher(conf TrackerConfig) *memberFetcher {
+	if conf.MemberFetcher == nil {
+		return nil
+	}
+
+	ttl := conf.MemberNotFoundTTL
+	if ttl == 0 {
+		ttl = DefaultMemberNotFoundTTL
+	}
+
+	return &memberFetcher{
+		fetch:       conf.MemberFetcher,
+		notFoundTTL: ttl,
+		inflight:    make(map[memberFetchKey]*memberFetch),
+		notFound:    make(map[memberFetchKey]time.Time),
+	}
+}
+
+// FetchMember returns the member from state, and fetches it using TrackerConfig.MemberFetcher if it's not cached.
+// The fetched member is added to the state, and concurrent fetches of the same member only results in a single call to the fetcher.
+//
+// Returns nil, nil if the user is not a member of the guild, which is remembered for TrackerConfig.MemberNotFoundTTL.
+// If ctx is done before the fetch finishes ctx.Err() is returned, the fetch itself is not cancelled and the result is still cached.
+func (tracker *InMemoryTracker) FetchMember(ctx context.Context, guildID int64, memberID int64) (*dstate.MemberState, error) {
+	if ms := tracker.GetMember(guildID, memberID); ms != nil {
+		return ms, nil
+	}
+
+	if tracker.fetcher == nil {
+		return nil, ErrNoMemberFetcher
+	}
+
+	key := memberFetchKey{GuildID: guildID, MemberID: memberID}
+	f, created := tracker.fetcher.start(key)
+	if f == nil {
+		// known to not be a member
+		return nil, nil
+	}
+
+	if created {
+		// run in its own goroutine so that none of the callers waiting on it are stuck if their ctx is done
+		go tracker.runMemberFetch(key, f)
+	}
+
+	select {
+	case <-f.done:
+		return f.ms, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// start returns the in progress fetch for the member, or creates a new one if there is none in which case created is true
+// returns nil if the member is negative cached
+func (mf *memberFetcher) start(key memberFetchKey) (f *memberFetch, created bool) {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+
+	if f, ok := mf.inflight[key]; ok {
+		return f, false
+	}
+
+	if expires, ok := mf.notFound[key]; ok {
+		if time.Now().Before(expires) {
+			return nil, false
+		}
+		delete(mf.notFound, key)
+	}
+
+	f = &memberFetch{done: make(chan struct{})}
+	mf.inflight[key] = f
+	return f, true
+}
+
+func (tracker *InMemoryTracker) runMemberFetch(key memberFetchKey, f *memberFetch) {
+	mf := tracker.fetcher
+
+	m, err := mf.fetch(key.GuildID, key.MemberID)
+	if err != nil && isNotFoundErr(err) {
+		m, err = nil, nil
+	}
+
+	if m != nil {
+		f.ms = tracker.cacheFetchedMember(key.GuildID, m)
+	}
+	f.err = err
+
+	mf.mu.Lock()
+	delete(mf.inflight, key)
+	if m == nil && err == nil && mf.notFoundTTL > 0 {
+		mf.addNotFoundLocked(key)
+	}
+	mf.mu.Unlock()
+
+	close(f.done)
+}
+
+// assumes mf.mu is locked
+func (mf *memberFetcher) addNotFoundLocked(key memberFetchKey) {
+	now := time.Now()
+	mf.notFound[key] = now.Add(mf.notFoundTTL)
+
+	// remove expired entries every time the map doubles in size
+	if len(mf.notFound) < mf.nextPrune {
+		return
+	}
+
+	for k, expires := range mf.notFound {
+		if !now.Before(expires) {
+			delete(mf.notFound, k)
+		}
+	}
+	mf.nextPrune = len(mf.notFound)*2 + 100
+}
+
+// adds the fetched member to the state if allowed by the cache policy, unless it was added in the meantime through the gateway in which case that's returned instead
+// members of guilds that are not in state are not cached, as nothing would remove them again
+func (tracker *InMemoryTracker) cacheFetchedMember(guildID int64, m *discordgo.Member) *dstate.MemberState {
+	// the guild id is not included in the rest response
+	m.GuildID = guildID
+	ms := dstate.MemberStateFromMember(m)
+
+	shard := tracker.lockGuildShard(guildID)
+	defer shard.mu.Unlock()
+
+	if existing := shard.getMemberLocked(guildID, ms.User.ID); existing != nil {
+		return existing
+	}
+
+	if _, ok := shard.guilds[guildID]; !ok {
+		return ms
+	}
+
+	shard.innerHandleMemberUpdate(ms)
+	if cached := shard.getMemberLocked(guildID, ms.User.ID); cached != nil {
+		return cached
+	}
+
+	// not allowed to be cached by the guild's cache policy
+	return ms
+}
+
+func isNotFoundErr(err error) bool {
+	if re, ok := err.(*discordgo.RESTError); ok && re.Response != nil {
+		return re.Response.StatusCode == http.StatusNotFound
+	}
+
+	return false
+}
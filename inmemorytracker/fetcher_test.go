@@ -0,0 +1,148 @@
+package inmemorytracker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jonas747/discordgo"
+)
+
+func TestFetchMember(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+
+	tracker := createTestState(TrackerConfig{
+		MemberFetcher: func(guildID int64, memberID int64) (*discordgo.Member, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return createTestMember(0, memberID, []int64{initialTestRoleID}), nil
+		},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ms, err := tracker.FetchMember(context.Background(), initialTestGuildID, 2000)
+			if err != nil || ms == nil || ms.User.ID != 2000 || ms.GuildID != initialTestGuildID {
+				t.Errorf("unexpected result: %v, %v", ms, err)
+			}
+		}()
+	}
+
+	// give the goroutines a chance to all join the same fetch
+	time.Sleep(time.Millisecond * 10)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatal("expected 1 call to the fetcher, got: ", n)
+	}
+
+	assertMemberExists(t, tracker, initialTestGuildID, 2000, true, false)
+
+	// cached, so the fetcher should not be called
+	if ms, err := tracker.FetchMember(context.Background(), initialTestGuildID, initialTestMemberID); err != nil || ms == nil {
+		t.Fatal("expected cached member: ", err)
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatal("expected 1 call to the fetcher, got: ", n)
+	}
+}
+
+func TestFetchMemberUnknownGuild(t *testing.T) {
+	tracker := createTestState(TrackerConfig{
+		MemberFetcher: func(guildID int64, memberID int64) (*discordgo.Member, error) {
+			return createTestMember(0, memberID, nil), nil
+		},
+	})
+
+	ms, err := tracker.FetchMember(context.Background(), 555, 2000)
+	if err != nil || ms == nil || ms.User.ID != 2000 || ms.GuildID != 555 {
+		t.Fatalf("unexpected result: %v, %v", ms, err)
+	}
+
+	// the guild is not in state, so the member should not have been kept
+	if tracker.GetMember(555, 2000) != nil {
+		t.Fatal("member of guild not in state was cached")
+	}
+}
+
+func TestFetchMemberNotFound(t *testing.T) {
+	var calls int32
+	errFailed := errors.New("failed")
+
+	tracker := createTestState(TrackerConfig{
+		MemberNotFoundTTL: time.Millisecond * 50,
+		MemberFetcher: func(guildID int64, memberID int64) (*discordgo.Member, error) {
+			atomic.AddInt32(&calls, 1)
+			switch memberID {
+			case 2000:
+				return nil, &discordgo.RESTError{Response: &http.Response{StatusCode: http.StatusNotFound}}
+			case 2001:
+				return nil, nil
+			}
+			return nil, errFailed
+		},
+	})
+
+	fetch := func(memberID int64, expectedCalls int32, expectedErr error) {
+		t.Helper()
+
+		ms, err := tracker.FetchMember(context.Background(), initialTestGuildID, memberID)
+		if ms != nil || err != expectedErr {
+			t.Fatalf("unexpected result for %d: %v, %v", memberID, ms, err)
+		}
+
+		if n := atomic.LoadInt32(&calls); n != expectedCalls {
+			t.Fatalf("expected %d calls to the fetcher, got: %d", expectedCalls, n)
+		}
+	}
+
+	fetch(2000, 1, nil)
+	fetch(2000, 1, nil)
+	fetch(2001, 2, nil)
+	fetch(2001, 2, nil)
+
+	// errors should not be cached
+	fetch(2002, 3, errFailed)
+	fetch(2002, 4, errFailed)
+
+	time.Sleep(time.Millisecond * 60)
+	fetch(2000, 5, nil)
+}
+
+func TestFetchMemberCancelled(t *testing.T) {
+	release := make(chan struct{})
+	tracker := createTestState(TrackerConfig{
+		MemberFetcher: func(guildID int64, memberID int64) (*discordgo.Member, error) {
+			<-release
+			return createTestMember(0, memberID, nil), nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := tracker.FetchMember(ctx, initialTestGuildID, 2000); err != context.Canceled {
+		t.Fatal("expected context.Canceled, got: ", err)
+	}
+
+	// the fetch should still finish and be cached
+	close(release)
+	ms, err := tracker.FetchMember(context.Background(), initialTestGuildID, 2000)
+	if err != nil || ms == nil {
+		t.Fatal("expected member: ", err)
+	}
+
+	if _, err := createTestState(TrackerConfig{}).FetchMember(context.Background(), initialTestGuildID, 2000); err != ErrNoMemberFetcher {
+		t.Fatal("expected ErrNoMemberFetcher, got: ", err)
+	}
+}
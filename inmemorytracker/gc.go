@@ -1,19 +1,39 @@
 package inmemorytracker
 
 import (
-	"container/list"
 	"time"
 
 	"github.com/jonas747/dstate/v3"
 )
 
-func (shard *ShardTracker) runGcLoop(interval time.Duration) {
+// starts the gc loop, stopping the previous one if it's already running
+func (shard *ShardTracker) startGcLoop(interval time.Duration) {
+	shard.stopGcLoop()
+
+	shard.stopGC = make(chan struct{})
+	go shard.runGcLoop(interval, shard.stopGC)
+}
+
+func (shard *ShardTracker) stopGcLoop() {
+	if shard.stopGC != nil {
+		close(shard.stopGC)
+		shard.stopGC = nil
+	}
+}
+
+func (shard *ShardTracker) runGcLoop(interval time.Duration, stop chan struct{}) {
 	var remainingGuilds []int64
 
 	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
 	for {
-		<-ticker.C
-		remainingGuilds = shard.gcTick(time.Now(), remainingGuilds)
+		select {
+		case <-ticker.C:
+			remainingGuilds = shard.gcTick(time.Now(), remainingGuilds)
+		case <-stop:
+			return
+		}
 	}
 }
 
@@ -35,6 +55,7 @@ func (shard *ShardTracker) gcTick(t time.Time, remainingGuilds []int64) []int64
 
 		if guild, ok := shard.guilds[next]; ok {
 			shard.gcGuild(t, guild)
+			shard.gcMemberChunksLocked(t, next)
 			break
 		}
 	}
@@ -49,12 +70,26 @@ func (shard *ShardTracker) gcGuild(t time.Time, gs *SparseGuildState) {
 		limitLen, limitAge = shard.conf.ChannelMessageLimitsF(gs.Guild.ID)
 	}
 
-	if limitLen < 1 && limitAge < 1 {
+	policy := shard.cachePolicyLocked(gs.Guild.ID)
+	if policy.MessageLen > 0 {
+		limitLen = policy.MessageLen
+	}
+	if policy.MessageDur > 0 {
+		limitAge = policy.MessageDur
+	}
+
+	if limitLen < 1 && limitAge < 1 && len(policy.ChannelMessageLimits) < 1 {
 		return // nothing to do, no limits
 	}
 
 	for _, v := range gs.Channels {
-		shard.gcGuildChannel(t, gs, v.ID, limitLen, limitAge)
+		channelLen, channelAge := policy.channelMessageLimits(v.ID, limitLen, limitAge)
+		shard.gcGuildChannel(t, gs, v.ID, channelLen, channelAge)
+	}
+
+	for _, v := range gs.Threads {
+		channelLen, channelAge := policy.channelMessageLimits(v.ID, limitLen, limitAge)
+		shard.gcGuildChannel(t, gs, v.ID, channelLen, channelAge)
 	}
 
 	if shard.conf.RemoveOfflineMembersAfter > 0 {
@@ -64,40 +99,22 @@ func (shard *ShardTracker) gcGuild(t time.Time, gs *SparseGuildState) {
 
 func (shard *ShardTracker) gcGuildChannel(t time.Time, gs *SparseGuildState, channel int64, maxLen int, maxAge time.Duration) {
 	if messages, ok := shard.messages[channel]; ok {
-		if maxLen > 0 {
-			overflow := messages.Len() - maxLen
-			for i := overflow; i > 0; i-- {
-				messages.Remove(messages.Front())
-			}
+		if maxLen > 0 && messages.Len() > maxLen {
+			messages.trimFront(messages.Len() - maxLen)
 		}
 
 		if maxAge > 0 {
-			if oldest := messages.Front(); oldest != nil {
-				v := oldest.Value.(*dstate.MessageState)
-				age := t.Sub(v.ParsedCreatedAt)
-
-				if age > maxAge {
-					shard.gcMessagesAge(t, gs, channel, maxAge, messages)
+			// messages are sorted by creation time, so the old ones are all at the front
+			old := 0
+			for ; old < messages.Len(); old++ {
+				if t.Sub(messages.at(old).ParsedCreatedAt) <= maxAge {
+					break
 				}
 			}
-		}
-	}
-}
-
-func (shard *ShardTracker) gcMessagesAge(t time.Time, gs *SparseGuildState, channel int64, maxAge time.Duration, messages *list.List) {
-	toDel := make([]*list.Element, 0, 100)
-	for e := messages.Front(); e != nil; e = e.Next() {
-		v := e.Value.(*dstate.MessageState)
-		age := t.Sub(v.ParsedCreatedAt)
 
-		if age > maxAge {
-			toDel = append(toDel, e)
+			messages.trimFront(old)
 		}
 	}
-
-	for _, v := range toDel {
-		messages.Remove(v)
-	}
 }
 
 func (shard *ShardTracker) getGuildIDs() []int64 {
@@ -125,5 +142,9 @@ func (shard *ShardTracker) gcMembers(t time.Time, gs *SparseGuildState, maxAge t
 		}
 
 		delete(members, k)
+		shard.unindexMemberLocked(v)
+
+		// we no longer have all the members cached
+		shard.setMembersCompleteLocked(gs.Guild.ID, false)
 	}
 }
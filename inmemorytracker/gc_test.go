@@ -68,15 +68,19 @@ func verifyMessages(t *testing.T, state *InMemoryTracker, channelID int64, expec
 		t.Fatalf("mismatched lengths, got: %d, expected: %d", messages.Len(), len(expectedResult))
 	}
 
-	i := 0
-	for e := messages.Front(); e != nil; e = e.Next() {
-
-		cast := e.Value.(*dstate.MessageState)
+	for i := 0; i < messages.Len(); i++ {
+		cast := messages.at(i)
 		if cast.ID != expectedResult[i] {
 			t.Fatalf("mismatched result at index [%d]: %d, expected %d", i, cast.ID, expectedResult[i])
 		}
 
-		i++
+		if indexed, ok := messages.get(cast.ID); !ok || indexed != i {
+			t.Fatalf("message %d missing from the index", cast.ID)
+		}
+	}
+
+	if len(messages.byID) != len(expectedResult) {
+		t.Fatalf("mismatched index length, got: %d, expected: %d", len(messages.byID), len(expectedResult))
 	}
 }
 
@@ -123,6 +127,21 @@ func TestGCMembers(t *testing.T) {
 	verifyMembers(t, state, initialTestGuildID, []int64{1001})
 }
 
+func TestGCNoMessageLimits(t *testing.T) {
+	// without any message limits the guild is skipped entirely, members included
+	state := createTestState(TrackerConfig{
+		RemoveOfflineMembersAfter: time.Hour,
+	})
+	shard := state.getShard(0)
+
+	shard.members[initialTestGuildID] = map[int64]*WrappedMember{
+		1000: createGCTestMember(1000, time.Date(2021, 5, 20, 10, 0, 0, 0, time.UTC), nil, nil),
+	}
+
+	shard.gcTick(time.Date(2021, 5, 20, 12, 0, 0, 0, time.UTC), nil)
+	verifyMembers(t, state, initialTestGuildID, []int64{1000})
+}
+
 func verifyMembers(t *testing.T, state *InMemoryTracker, guildID int64, expectedResult []int64) {
 	shard := state.getShard(0)
 
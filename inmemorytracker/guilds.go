@@ -0,0 +1,95 @@
+package inmemorytracker
+
+import (
+	"github.com/jonas747/dstate/v3"
+)
+
+var _ dstate.GuildIterator = (*InMemoryTracker)(nil)
+
+// IterateGuilds implements dstate.GuildIterator
+// f is called with chunks of up to TrackerConfig.IterateGuildsChunkSize guilds, the read lock of the shards is not held while f is called
+// the chunk slice is reused between calls to f, so make a copy of it if you need to keep it around
+//
+// Guilds added during the iteration are not included, guilds removed during it may or may not be,
+// and guilds moved by a concurrent Reshard may be skipped
+func (tracker *InMemoryTracker) IterateGuilds(query *dstate.GuildsQuery, f func(chunk []*dstate.GuildState) bool) {
+	chunkSize := tracker.conf.IterateGuildsChunkSize
+	if chunkSize < 1 {
+		chunkSize = DefaultIterateGuildsChunkSize
+	}
+
+	gen := currentSlotGeneration()
+
+	var chunk []*dstate.GuildState
+	for _, shard := range tracker.getLayout().shards {
+		cursor := 0
+		for done := false; !done; {
+			shard.mu.RLock()
+			chunk, cursor, done = shard.nextGuildsChunkLocked(query, chunk, chunkSize, cursor, gen)
+			shard.mu.RUnlock()
+
+			if len(chunk) >= chunkSize {
+				if !f(chunk) {
+					return
+				}
+				chunk = chunk[:0]
+			}
+		}
+	}
+
+	if len(chunk) > 0 {
+		f(chunk)
+	}
+}
+
+// appends the guilds matching query starting at the slot cursor to buf, until buf has chunkSize guilds, skipping the slots filled after generation gen
+// returns the slot to continue from, and true if there are no more guilds in the shard after this
+// assumes state is locked
+func (shard *ShardTracker) nextGuildsChunkLocked(query *dstate.GuildsQuery, buf []*dstate.GuildState, chunkSize int, cursor int, gen uint64) ([]*dstate.GuildState, int, bool) {
+	slots := shard.guildSlots
+	for ; cursor < len(slots.ids); cursor++ {
+		if len(buf) >= chunkSize {
+			return buf, cursor, false
+		}
+
+		id := slots.get(cursor, gen)
+		if id == 0 {
+			continue
+		}
+
+		// the guild states are never modified after being set, so they're safe to return
+		if gs, ok := shard.guilds[id]; ok && query.Match(gs.Guild) {
+			buf = append(buf, gs.Guild)
+		}
+	}
+
+	return buf, cursor, true
+}
+
+// GetStateCounts implements dstate.GuildIterator
+func (tracker *InMemoryTracker) GetStateCounts() *dstate.StateCounts {
+	counts := &dstate.StateCounts{}
+	for _, shard := range tracker.getLayout().shards {
+		shard.addCounts(counts)
+	}
+
+	return counts
+}
+
+func (shard *ShardTracker) addCounts(counts *dstate.StateCounts) {
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	counts.Guilds += len(shard.guilds)
+	for _, v := range shard.guilds {
+		counts.Members += v.Guild.MemberCount
+	}
+
+	for _, v := range shard.members {
+		counts.CachedMembers += len(v)
+	}
+
+	for _, v := range shard.messages {
+		counts.CachedMessages += v.Len()
+	}
+}
@@ -0,0 +1,150 @@
+package inmemorytracker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+func createIterateGuildsTestState() *InMemoryTracker {
+	state := NewInMemoryTracker(TrackerConfig{}, 2)
+
+	for i := int64(1); i <= 6; i++ {
+		guildID := i << 22
+		session := &discordgo.Session{ShardID: int(i % 2), ShardCount: 2}
+
+		var features []string
+		if i%3 == 0 {
+			features = []string{"COMMUNITY"}
+		}
+
+		state.HandleEvent(session, &discordgo.GuildCreate{
+			Guild: &discordgo.Guild{
+				ID:          guildID,
+				OwnerID:     100 + i%2,
+				MemberCount: int(i * 10),
+				Features:    features,
+				Members: []*discordgo.Member{
+					createTestMember(guildID, 1000, nil),
+				},
+				Channels: []*discordgo.Channel{
+					createTestChannel(guildID, guildID+1, nil),
+				},
+			},
+		})
+
+		state.HandleEvent(session, &discordgo.MessageCreate{
+			Message: &discordgo.Message{
+				ID:        guildID + 2,
+				ChannelID: guildID + 1,
+				GuildID:   guildID,
+				Timestamp: discordgo.Timestamp(time.Now().Format(time.RFC3339)),
+			},
+		})
+	}
+
+	return state
+}
+
+func TestIterateGuilds(t *testing.T) {
+	state := createIterateGuildsTestState()
+
+	cases := []struct {
+		query    dstate.GuildsQuery
+		expected []int64
+	}{
+		{dstate.GuildsQuery{}, []int64{1, 2, 3, 4, 5, 6}},
+		{dstate.GuildsQuery{OwnerID: 101}, []int64{1, 3, 5}},
+		{dstate.GuildsQuery{Feature: "COMMUNITY"}, []int64{3, 6}},
+		{dstate.GuildsQuery{MinMemberCount: 20, MaxMemberCount: 40}, []int64{2, 3, 4}},
+		{dstate.GuildsQuery{OwnerID: 100, Feature: "COMMUNITY"}, []int64{6}},
+		{dstate.GuildsQuery{OwnerID: 999}, nil},
+	}
+
+	for i, c := range cases {
+		seen := make(map[int64]bool)
+		state.IterateGuilds(&c.query, func(chunk []*dstate.GuildState) bool {
+			for _, v := range chunk {
+				seen[v.ID>>22] = true
+			}
+			return true
+		})
+
+		if len(seen) != len(c.expected) {
+			t.Fatalf("case %d: mismatched results, got: %v, expected: %v", i, seen, c.expected)
+		}
+
+		for _, v := range c.expected {
+			if !seen[v] {
+				t.Fatalf("case %d: mismatched results, got: %v, expected: %v", i, seen, c.expected)
+			}
+		}
+	}
+
+	chunks := 0
+	state.IterateGuilds(&dstate.GuildsQuery{}, func(chunk []*dstate.GuildState) bool {
+		chunks++
+		return false
+	})
+	if chunks != 1 {
+		t.Fatalf("iteration not stopped, chunks: %d", chunks)
+	}
+}
+
+func TestIterateGuildsChunks(t *testing.T) {
+	state := createIterateGuildsTestState()
+	state.conf.IterateGuildsChunkSize = 2
+
+	var sizes []int
+	seen := make(map[int64]bool)
+	var buf **dstate.GuildState
+	state.IterateGuilds(nil, func(chunk []*dstate.GuildState) bool {
+		sizes = append(sizes, len(chunk))
+
+		// the chunks are filled across shards, in the same buffer
+		if buf == nil {
+			buf = &chunk[:1][0]
+		} else if buf != &chunk[:1][0] {
+			t.Fatal("chunk buffer not reused")
+		}
+
+		for _, v := range chunk {
+			if seen[v.ID] {
+				t.Fatalf("guild %d seen twice", v.ID>>22)
+			}
+			seen[v.ID] = true
+		}
+
+		// remove a guild on the second shard that has not been visited yet
+		if len(sizes) == 1 {
+			state.HandleEvent(&discordgo.Session{ShardID: 1, ShardCount: 2}, &discordgo.GuildDelete{Guild: &discordgo.Guild{ID: 5 << 22}})
+		}
+		return true
+	})
+
+	if len(sizes) != 3 || sizes[0] != 2 || sizes[1] != 2 || sizes[2] != 1 {
+		t.Fatalf("unexpected chunk sizes: %v", sizes)
+	}
+
+	if len(seen) != 5 || seen[5<<22] {
+		t.Fatalf("unexpected guilds: %v", seen)
+	}
+}
+
+func TestGetStateCounts(t *testing.T) {
+	state := createIterateGuildsTestState()
+
+	counts := state.GetStateCounts()
+	expected := dstate.StateCounts{
+		Guilds:         6,
+		Members:        210,
+		CachedMembers:  6,
+		CachedMessages: 6,
+	}
+
+	if *counts != expected {
+		t.Fatalf("incorrect counts: %#v, expected: %#v", counts, expected)
+	}
+}
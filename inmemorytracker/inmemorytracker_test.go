@@ -1,10 +1,12 @@
 package inmemorytracker
 
 import (
+	"encoding/json"
 	"strconv"
 	"testing"
 
 	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
 )
 
 var testSession = &discordgo.Session{ShardID: 0, ShardCount: 1}
@@ -126,6 +128,121 @@ func TestMemberAdd(t *testing.T) {
 	}
 }
 
+func TestGetMembers(t *testing.T) {
+	tracker := createTestState(TrackerConfig{})
+
+	tracker.HandleEvent(testSession, &discordgo.GuildMemberAdd{
+		Member: createTestMember(1, 1001, nil),
+	})
+
+	members, missing := tracker.GetMembers(1, []int64{1001, 5000, initialTestMemberID, 5001})
+	if len(members) != 4 {
+		t.Fatal("unexpected length of members: ", len(members))
+	}
+
+	if members[0] == nil || members[0].User.ID != 1001 || members[2] == nil || members[2].User.ID != initialTestMemberID {
+		t.Fatal("members not aligned with ids")
+	}
+
+	if members[1] != nil || members[3] != nil {
+		t.Fatal("expected nil for missing members")
+	}
+
+	if len(missing) != 2 || missing[0] != 5000 || missing[1] != 5001 {
+		t.Fatal("unexpected missing ids: ", missing)
+	}
+
+	_, missing = tracker.GetMembers(2, []int64{1001})
+	if len(missing) != 1 {
+		t.Fatal("expected member in unknown guild to be missing")
+	}
+}
+
+func TestFullPresences(t *testing.T) {
+	presence := &discordgo.PresenceUpdate{
+		GuildID: initialTestGuildID,
+		Presence: discordgo.Presence{
+			User:   createTestUser(initialTestMemberID),
+			Status: discordgo.StatusIdle,
+			Activities: discordgo.Activities{
+				{Name: "Custom Status", Type: dstate.ActivityTypeCustom, State: "busy"},
+				{Name: "a game", TimeStamps: discordgo.TimeStamps{StartTimestamp: 1000}, ApplicationID: "123"},
+			},
+		},
+	}
+
+	light := createTestState(TrackerConfig{})
+	light.HandleEvent(testSession, presence)
+
+	ms := light.GetMember(initialTestGuildID, initialTestMemberID)
+	if ms.Presence.Game == nil || ms.Presence.Game.Name != "Custom Status" || ms.Presence.Activities != nil {
+		t.Fatalf("unexpected light presence: %#v", ms.Presence)
+	}
+
+	full := createTestState(TrackerConfig{FullPresences: true})
+	full.HandleEvent(testSession, presence)
+
+	ms = full.GetMember(initialTestGuildID, initialTestMemberID)
+	if ms.Presence.Status != dstate.StatusIdle || len(ms.Presence.Activities) != 2 || ms.Member == nil {
+		t.Fatalf("unexpected full presence: %#v", ms.Presence)
+	}
+
+	if cs := ms.Presence.CustomStatus(); cs == nil || cs.State != "busy" {
+		t.Fatal("custom status not found")
+	}
+
+	if a := ms.Presence.Activities[1]; a.TimeStamps.StartTimestamp != 1000 || a.ApplicationID != "123" {
+		t.Fatalf("unexpected activity: %#v", a)
+	}
+}
+
+func TestGatewayPresenceUpdate(t *testing.T) {
+	raw := `{
+		"user": {"id": "1000"},
+		"guild_id": "1",
+		"status": "online",
+		"client_status": {"desktop": "online", "mobile": "idle"},
+		"activities": [
+			{"name": "Custom Status", "type": 4, "state": "busy", "emoji": {"name": "🔥"}},
+			{"name": "a game", "type": 0, "assets": {"large_image": "abc", "large_text": "big"}, "timestamps": {"start": 1000}}
+		]
+	}`
+
+	var presence dstate.PresenceUpdate
+	if err := json.Unmarshal([]byte(raw), &presence); err != nil {
+		t.Fatal("failed decoding presence: ", err)
+	}
+
+	state := createTestState(TrackerConfig{FullPresences: true})
+	state.HandleEvent(testSession, &presence)
+
+	ms := state.GetMember(initialTestGuildID, initialTestMemberID)
+	if ms.Member == nil || ms.Presence.Status != dstate.StatusOnline || len(ms.Presence.Activities) != 2 {
+		t.Fatalf("unexpected presence: %#v", ms.Presence)
+	}
+
+	if cs := ms.Presence.ClientStatus; cs == nil || cs.Desktop != dstate.StatusOnline || cs.Mobile != dstate.StatusIdle || cs.Web != dstate.StatusNotSet {
+		t.Fatalf("unexpected client status: %#v", cs)
+	}
+
+	if cs := ms.Presence.CustomStatus(); cs == nil || cs.State != "busy" || cs.Emoji == nil || cs.Emoji.Name != "🔥" {
+		t.Fatalf("unexpected custom status: %#v", cs)
+	}
+
+	if a := ms.Presence.Activities[1]; a.Assets.LargeImageID != "abc" || a.Assets.LargeText != "big" || a.TimeStamps.StartTimestamp != 1000 {
+		t.Fatalf("unexpected activity: %#v", a)
+	}
+
+	// the main activity is still set without full presences, but not the rest
+	light := createTestState(TrackerConfig{})
+	light.HandleEvent(testSession, &presence)
+
+	ms = light.GetMember(initialTestGuildID, initialTestMemberID)
+	if ms.Presence.Game == nil || ms.Presence.Game.Name != "Custom Status" || ms.Presence.Activities != nil || ms.Presence.ClientStatus != nil {
+		t.Fatalf("unexpected light presence: %#v", ms.Presence)
+	}
+}
+
 func TestChannelUpdate(t *testing.T) {
 	tracker := createTestState(TrackerConfig{})
 	channel := tracker.GetGuild(initialTestGuildID).GetChannel(initialTestChannelID)
@@ -0,0 +1,240 @@
+package inmemorytracker
+
+import (
+	"context"
+	"time"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+// Tracks the progress of a guild members request, identified by the guild and nonce
+type memberChunksKey struct {
+	GuildID int64
+	Nonce   string
+}
+
+type memberChunksProgress struct {
+	received     []bool
+	numReceived  int
+	lastReceived time.Time
+}
+
+// memberChunksTimeout is how long the progress of a members request is kept after the last chunk,
+// requests that never finish are removed by the gc after this
+const memberChunksTimeout = time.Minute * 10
+
+// IsMemberListComplete returns true if all the members of the guild are believed to be cached
+//
+// This is the case for guilds that are not large, as their full member list is included in the guild create,
+// and for large guilds once a members request has finished and atleast as many members as the guild's member count are cached.
+// It's reset if the GC removes members, or on new guild creates for large guilds.
+func (tracker *InMemoryTracker) IsMemberListComplete(guildID int64) bool {
+	shard := tracker.rlockGuildShard(guildID)
+	defer shard.mu.RUnlock()
+
+	return shard.membersComplete[guildID]
+}
+
+// MemberChunksProgress returns the number of received and total member chunks of in progress member requests for the guild
+// returns 0, 0 if there's no in progress requests
+func (tracker *InMemoryTracker) MemberChunksProgress(guildID int64) (received int, total int) {
+	shard := tracker.rlockGuildShard(guildID)
+	defer shard.mu.RUnlock()
+
+	for k, v := range shard.memberChunks {
+		if k.GuildID == guildID {
+			received += v.numReceived
+			total += len(v.received)
+		}
+	}
+
+	return received, total
+}
+
+// WaitMemberListComplete blocks until the member list of the guild is complete (see IsMemberListComplete) or ctx is done
+// note that this does not request the members, that has to be done through the gateway
+func (tracker *InMemoryTracker) WaitMemberListComplete(ctx context.Context, guildID int64) error {
+	shard := tracker.lockGuildShard(guildID)
+	if shard.membersComplete[guildID] {
+		shard.mu.Unlock()
+		return nil
+	}
+
+	ch := make(chan struct{})
+	shard.membersCompleteWaiters[guildID] = append(shard.membersCompleteWaiters[guildID], ch)
+	shard.mu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+	}
+
+	// the guild might have been moved to another shard by Reshard in the meantime
+	shard = tracker.lockGuildShard(guildID)
+	defer shard.mu.Unlock()
+
+	waiters := shard.membersCompleteWaiters[guildID]
+	for i, v := range waiters {
+		if v == ch {
+			shard.membersCompleteWaiters[guildID] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+
+	if len(shard.membersCompleteWaiters[guildID]) < 1 {
+		delete(shard.membersCompleteWaiters, guildID)
+	}
+
+	return ctx.Err()
+}
+
+func (shard *ShardTracker) handleMembersChunk(mc *discordgo.GuildMembersChunk, presences []*dstate.Presence) {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	gs, ok := shard.guilds[mc.GuildID]
+	if !ok {
+		return
+	}
+
+	changes := shard.newMemberChangesLocked(mc.GuildID)
+	for _, v := range mc.Members {
+		ms := dstate.MemberStateFromMember(v)
+		ms.GuildID = mc.GuildID
+		changes.before(ms.User.ID)
+		shard.innerHandleMemberUpdate(ms)
+	}
+
+	// the presences only include the user id, so they're loaded after the members to carry over the user from them
+	for _, v := range presences {
+		if v.User != nil {
+			changes.before(v.User.ID)
+			shard.innerHandlePresenceUpdate(shard.gatewayPresenceMemberState(mc.GuildID, v), false)
+		}
+	}
+	changes.emit()
+
+	if mc.ChunkCount < 1 || mc.ChunkIndex < 0 || mc.ChunkIndex >= mc.ChunkCount {
+		return
+	}
+
+	key := memberChunksKey{GuildID: mc.GuildID, Nonce: mc.Nonce}
+	progress, ok := shard.memberChunks[key]
+	if !ok || len(progress.received) != mc.ChunkCount {
+		progress = &memberChunksProgress{
+			received: make([]bool, mc.ChunkCount),
+		}
+		shard.memberChunks[key] = progress
+	}
+
+	progress.lastReceived = time.Now()
+	if !progress.received[mc.ChunkIndex] {
+		progress.received[mc.ChunkIndex] = true
+		progress.numReceived++
+	}
+
+	if progress.numReceived < len(progress.received) {
+		return
+	}
+
+	// request finished
+	delete(shard.memberChunks, key)
+
+	// the request might have been for specific members, so only mark it as complete if we have enough members cached
+	numMembers := int64(0)
+	for _, v := range shard.members[mc.GuildID] {
+		if v.Member != nil {
+			numMembers++
+		}
+	}
+
+	if numMembers >= gs.Guild.MemberCount {
+		shard.setMembersCompleteLocked(mc.GuildID, true)
+	}
+}
+
+// assumes state is locked
+func (shard *ShardTracker) setMembersCompleteLocked(guildID int64, complete bool) {
+	if !complete {
+		delete(shard.membersComplete, guildID)
+		return
+	}
+
+	shard.membersComplete[guildID] = true
+	for _, v := range shard.membersCompleteWaiters[guildID] {
+		close(v)
+	}
+	delete(shard.membersCompleteWaiters, guildID)
+}
+
+// clears the chunk progress of the guild
+// assumes state is locked
+func (shard *ShardTracker) resetMemberChunksLocked(guildID int64) {
+	for k := range shard.memberChunks {
+		if k.GuildID == guildID {
+			delete(shard.memberChunks, k)
+		}
+	}
+}
+
+// removes the progress of the guild's member requests that have not received a chunk in memberChunksTimeout
+// assumes state is locked
+func (shard *ShardTracker) gcMemberChunksLocked(t time.Time, guildID int64) {
+	for k, v := range shard.memberChunks {
+		if k.GuildID == guildID && t.Sub(v.lastReceived) > memberChunksTimeout {
+			delete(shard.memberChunks, k)
+		}
+	}
+}
+
+// memberChanges collects the members changed by a batch of updates, to emit a single change per member afterwards
+type memberChanges struct {
+	shard   *ShardTracker
+	guildID int64
+	ids     []int64
+	old     map[int64]*dstate.MemberState
+}
+
+// returns nil if there's no subscribers, in which case the methods do nothing
+// assumes state is locked
+func (shard *ShardTracker) newMemberChangesLocked(guildID int64) *memberChanges {
+	if !shard.changes.active() {
+		return nil
+	}
+
+	return &memberChanges{
+		shard:   shard,
+		guildID: guildID,
+		old:     make(map[int64]*dstate.MemberState),
+	}
+}
+
+// records the state of the member before the first update to it
+func (c *memberChanges) before(memberID int64) {
+	if c == nil {
+		return
+	}
+
+	if _, ok := c.old[memberID]; ok {
+		return
+	}
+
+	c.ids = append(c.ids, memberID)
+	c.old[memberID] = c.shard.getMemberLocked(c.guildID, memberID)
+}
+
+// emits a change for each member that changed since before was called for it
+func (c *memberChanges) emit() {
+	if c == nil {
+		return
+	}
+
+	for _, id := range c.ids {
+		old := c.old[id]
+		if updated := c.shard.getMemberLocked(c.guildID, id); updated != old {
+			c.shard.emit(&dstate.MemberChange{GuildID: c.guildID, Old: old, New: updated})
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package inmemorytracker
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+func createLargeTestGuild(tracker *InMemoryTracker, memberCount int) {
+	tracker.HandleEvent(testSession, &discordgo.GuildCreate{
+		Guild: &discordgo.Guild{
+			ID:          initialTestGuildID,
+			Name:        "large test guild",
+			MemberCount: memberCount,
+			Large:       true,
+			Members: []*discordgo.Member{
+				createTestMember(0, initialTestMemberID, nil),
+			},
+		},
+	})
+}
+
+func TestMemberListCompleteSmallGuild(t *testing.T) {
+	tracker := createTestState(TrackerConfig{})
+	if !tracker.IsMemberListComplete(initialTestGuildID) {
+		t.Fatal("member list of non large guild should be complete")
+	}
+}
+
+func TestMembersChunk(t *testing.T) {
+	tracker := NewInMemoryTracker(TrackerConfig{}, 1)
+	createLargeTestGuild(tracker, 3)
+
+	if tracker.IsMemberListComplete(initialTestGuildID) {
+		t.Fatal("member list of large guild should not be complete")
+	}
+
+	waitResult := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		waitResult <- tracker.WaitMemberListComplete(ctx, initialTestGuildID)
+	}()
+
+	tracker.HandleEvent(testSession, &discordgo.GuildMembersChunk{
+		GuildID:    initialTestGuildID,
+		Members:    []*discordgo.Member{createTestMember(0, 1001, nil)},
+		ChunkIndex: 0,
+		ChunkCount: 2,
+		Nonce:      "a",
+	})
+
+	assertMemberExists(t, tracker, initialTestGuildID, 1001, true, false)
+	if received, total := tracker.MemberChunksProgress(initialTestGuildID); received != 1 || total != 2 {
+		t.Fatalf("unexpected progress: %d/%d", received, total)
+	}
+
+	if tracker.IsMemberListComplete(initialTestGuildID) {
+		t.Fatal("member list should not be complete before all chunks are received")
+	}
+
+	tracker.HandleEvent(testSession, &discordgo.GuildMembersChunk{
+		GuildID:    initialTestGuildID,
+		Members:    []*discordgo.Member{createTestMember(0, 1002, nil)},
+		ChunkIndex: 1,
+		ChunkCount: 2,
+		Nonce:      "a",
+	})
+
+	if !tracker.IsMemberListComplete(initialTestGuildID) {
+		t.Fatal("member list should be complete")
+	}
+
+	if err := <-waitResult; err != nil {
+		t.Fatal("wait failed: ", err)
+	}
+
+	if received, total := tracker.MemberChunksProgress(initialTestGuildID); received != 0 || total != 0 {
+		t.Fatalf("unexpected progress after completion: %d/%d", received, total)
+	}
+}
+
+func TestMembersChunkPartialRequest(t *testing.T) {
+	tracker := NewInMemoryTracker(TrackerConfig{}, 1)
+	createLargeTestGuild(tracker, 100)
+
+	// a request for specific members finishing should not mark the list as complete
+	tracker.HandleEvent(testSession, &discordgo.GuildMembersChunk{
+		GuildID:    initialTestGuildID,
+		Members:    []*discordgo.Member{createTestMember(0, 1001, nil)},
+		ChunkIndex: 0,
+		ChunkCount: 1,
+	})
+
+	if tracker.IsMemberListComplete(initialTestGuildID) {
+		t.Fatal("member list should not be complete")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := tracker.WaitMemberListComplete(ctx, initialTestGuildID); err != context.DeadlineExceeded {
+		t.Fatal("expected deadline exceeded, got: ", err)
+	}
+
+	if len(tracker.getShard(0).membersCompleteWaiters) != 0 {
+		t.Fatal("waiter not removed")
+	}
+}
+
+func TestMembersCompleteResetByGC(t *testing.T) {
+	tracker := createTestState(TrackerConfig{
+		RemoveOfflineMembersAfter: time.Hour,
+		ChannelMessageLen:         1,
+	})
+
+	tracker.HandleEvent(testSession, &discordgo.GuildMemberAdd{
+		Member: createTestMember(initialTestGuildID, 1001, nil),
+	})
+
+	if !tracker.IsMemberListComplete(initialTestGuildID) {
+		t.Fatal("member list should still be complete after member add")
+	}
+
+	shard := tracker.getShard(0)
+	shard.gcTick(time.Now().Add(time.Hour*2), nil)
+
+	if tracker.IsMemberListComplete(initialTestGuildID) {
+		t.Fatal("member list should not be complete after members were removed")
+	}
+}
+
+func TestMembersChunkPresences(t *testing.T) {
+	tracker := NewInMemoryTracker(TrackerConfig{}, 1)
+	createLargeTestGuild(tracker, 3)
+
+	// the presences in chunks only include the user id
+	raw := `{
+		"guild_id": "1",
+		"chunk_index": 0,
+		"chunk_count": 1,
+		"members": [
+			{"user": {"id": "1001", "username": "a"}, "roles": [], "joined_at": "2021-01-01T00:00:00+00:00"},
+			{"user": {"id": "1002", "username": "b"}, "roles": [], "joined_at": "2021-01-01T00:00:00+00:00"}
+		],
+		"presences": [
+			{"user": {"id": "1001"}, "status": "online", "activities": [{"name": "a game", "type": 0}]},
+			{"user": {"id": "1002"}, "status": "dnd", "activities": []}
+		]
+	}`
+
+	var chunk dstate.GuildMembersChunk
+	if err := json.Unmarshal([]byte(raw), &chunk); err != nil {
+		t.Fatal("failed decoding chunk: ", err)
+	}
+
+	tracker.HandleEvent(testSession, &chunk)
+
+	ms := tracker.GetMember(initialTestGuildID, 1001)
+	if ms == nil || ms.Member == nil || ms.Presence == nil {
+		t.Fatalf("member or presence missing: %#v", ms)
+	}
+
+	if ms.User.Username != "a" || ms.Presence.Status != dstate.StatusOnline || ms.Presence.Game == nil || ms.Presence.Game.Name != "a game" {
+		t.Fatalf("incorrect member: %#v, presence: %#v", ms, ms.Presence)
+	}
+
+	ms = tracker.GetMember(initialTestGuildID, 1002)
+	if ms == nil || ms.Member == nil || ms.Presence == nil || ms.Presence.Status != dstate.StatusDoNotDisturb || ms.Presence.Game != nil {
+		t.Fatalf("incorrect member: %#v", ms)
+	}
+
+	if !tracker.IsMemberListComplete(initialTestGuildID) {
+		t.Fatal("member list should be complete")
+	}
+}
+
+func TestMembersChunkExpired(t *testing.T) {
+	tracker := NewInMemoryTracker(TrackerConfig{}, 1)
+	createLargeTestGuild(tracker, 100)
+
+	// a request that never finishes
+	tracker.HandleEvent(testSession, &discordgo.GuildMembersChunk{
+		GuildID:    initialTestGuildID,
+		Members:    []*discordgo.Member{createTestMember(0, 1001, nil)},
+		ChunkIndex: 0,
+		ChunkCount: 2,
+		Nonce:      "a",
+	})
+
+	shard := tracker.getShard(0)
+	shard.gcTick(time.Now(), nil)
+	if received, total := tracker.MemberChunksProgress(initialTestGuildID); received != 1 || total != 2 {
+		t.Fatalf("unexpected progress: %d/%d", received, total)
+	}
+
+	shard.gcTick(time.Now().Add(memberChunksTimeout*2), nil)
+	if len(shard.memberChunks) != 0 {
+		t.Fatal("progress of request not removed")
+	}
+}
+
+func TestMembersChunkChanges(t *testing.T) {
+	tracker := NewInMemoryTracker(TrackerConfig{}, 1)
+	createLargeTestGuild(tracker, 3)
+
+	var changes []*dstate.MemberChange
+	unsub := tracker.Subscribe(func(change dstate.StateChange) {
+		if c, ok := change.(*dstate.MemberChange); ok {
+			changes = append(changes, c)
+		}
+	})
+	defer unsub()
+
+	tracker.HandleEvent(testSession, &dstate.GuildMembersChunk{
+		GuildMembersChunk: discordgo.GuildMembersChunk{
+			GuildID:    initialTestGuildID,
+			Members:    []*discordgo.Member{createTestMember(0, 1001, nil), createTestMember(0, 1002, nil)},
+			ChunkIndex: 0,
+			ChunkCount: 1,
+		},
+		Presences: []*dstate.Presence{
+			{User: &discordgo.User{ID: 1001}, Status: discordgo.StatusOnline},
+		},
+	})
+
+	// a single change per member, with the presence included
+	if len(changes) != 2 {
+		t.Fatalf("unexpected amount of changes: %d", len(changes))
+	}
+
+	for i, v := range changes {
+		if v.Old != nil || v.New == nil || v.New.User.ID != int64(1001+i) || v.New.Member == nil {
+			t.Fatalf("unexpected change: %#v", v)
+		}
+	}
+
+	if changes[0].New.Presence == nil || changes[0].New.Presence.Status != dstate.StatusOnline {
+		t.Fatalf("presence missing from change: %#v", changes[0].New)
+	}
+}
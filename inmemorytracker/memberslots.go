@@ -0,0 +1,170 @@
+package inmemorytracker
+
+import (
+	"sync/atomic"
+
+	"github.com/jonas747/dstate/v3"
+)
+
+// DefaultIterateMembersChunkSize is used by IterateMembers if TrackerConfig.IterateMembersChunkSize is not set
+const DefaultIterateMembersChunkSize = 1000
+
+// DefaultIterateGuildsChunkSize is used by IterateGuilds if TrackerConfig.IterateGuildsChunkSize is not set
+const DefaultIterateGuildsChunkSize = 1000
+
+// idSlots gives each member of a guild, or each guild of a shard, a fixed position,
+// which lets IterateMembers and IterateGuilds resume where they left off after releasing the lock.
+//
+// IDs never move once added, slots freed by removed ids are only reused by new ones,
+// so an id that's present during the whole iteration is visited exactly once.
+//
+// A freed slot can be reused before the iteration reaches it, so an id that's removed and added again could end up visited twice.
+// To avoid that each slot records the generation it was filled in, and iterations skip the slots filled after they started.
+type idSlots struct {
+	ids    []int64
+	gens   []uint64
+	slotOf map[int64]int
+	free   []int
+}
+
+// incremented every time a slot is filled, this only has to increase so it's shared by all the slots
+var slotGeneration uint64
+
+// returns the current slot generation, iterations started at this point should skip slots filled after it
+func currentSlotGeneration() uint64 {
+	return atomic.LoadUint64(&slotGeneration)
+}
+
+func newIDSlots() *idSlots {
+	return &idSlots{
+		slotOf: make(map[int64]int),
+	}
+}
+
+// assumes state is locked
+func (slots *idSlots) add(id int64) {
+	if _, ok := slots.slotOf[id]; ok {
+		return
+	}
+
+	if len(slots.free) > 0 {
+		slot := slots.free[len(slots.free)-1]
+		slots.free = slots.free[:len(slots.free)-1]
+
+		slots.ids[slot] = id
+		slots.gens[slot] = atomic.AddUint64(&slotGeneration, 1)
+		slots.slotOf[id] = slot
+		return
+	}
+
+	slots.slotOf[id] = len(slots.ids)
+	slots.ids = append(slots.ids, id)
+	slots.gens = append(slots.gens, atomic.AddUint64(&slotGeneration, 1))
+}
+
+// returns the id in the slot, or 0 if it's empty or was filled after generation gen
+// assumes state is locked
+func (slots *idSlots) get(slot int, gen uint64) int64 {
+	if slots.gens[slot] > gen {
+		return 0
+	}
+
+	return slots.ids[slot]
+}
+
+// assumes state is locked
+func (slots *idSlots) remove(id int64) {
+	slot, ok := slots.slotOf[id]
+	if !ok {
+		return
+	}
+
+	delete(slots.slotOf, id)
+	slots.ids[slot] = 0
+	slots.free = append(slots.free, slot)
+}
+
+// assumes state is locked
+func (shard *ShardTracker) addMemberSlotLocked(guildID int64, memberID int64) {
+	slots, ok := shard.memberSlots[guildID]
+	if !ok {
+		slots = newIDSlots()
+		shard.memberSlots[guildID] = slots
+	}
+
+	slots.add(memberID)
+}
+
+// assumes state is locked
+func (shard *ShardTracker) removeMemberSlotLocked(guildID int64, memberID int64) {
+	if slots, ok := shard.memberSlots[guildID]; ok {
+		slots.remove(memberID)
+	}
+}
+
+// IterateMembers calls f with chunks of up to TrackerConfig.IterateMembersChunkSize members,
+// the read lock is only held while each chunk is collected and not while f is called.
+//
+// Members added during the iteration are not included, members removed during it may or may not be, and all others are included exactly once.
+// The chunk slice is reused between calls to f, so make a copy of it if you need to keep it around, the members themselves are safe to keep.
+func (tracker *InMemoryTracker) IterateMembers(guildID int64, f func(chunk []*dstate.MemberState) bool) {
+	chunkSize := tracker.conf.IterateMembersChunkSize
+	if chunkSize < 1 {
+		chunkSize = DefaultIterateMembersChunkSize
+	}
+
+	gen := currentSlotGeneration()
+
+	var chunk []*dstate.MemberState
+	cursor := 0
+	for {
+		var done bool
+		// the shard is looked up for every chunk as the guild could be moved by Reshard between them
+		shard := tracker.rlockGuildShard(guildID)
+		chunk, cursor, done = shard.nextMembersChunkLocked(guildID, chunk[:0], chunkSize, cursor, gen)
+		shard.mu.RUnlock()
+
+		if len(chunk) > 0 && !f(chunk) {
+			return
+		}
+
+		if done {
+			return
+		}
+	}
+}
+
+// appends up to chunkSize members starting at the slot cursor to buf, skipping the slots filled after generation gen
+// returns the slot to continue from, and true if there are no more members after this chunk
+// assumes state is locked
+func (shard *ShardTracker) nextMembersChunkLocked(guildID int64, buf []*dstate.MemberState, chunkSize int, cursor int, gen uint64) ([]*dstate.MemberState, int, bool) {
+	slots, ok := shard.memberSlots[guildID]
+	if !ok {
+		return buf, cursor, true
+	}
+
+	members := shard.members[guildID]
+	for ; cursor < len(slots.ids); cursor++ {
+		if len(buf) >= chunkSize {
+			return buf, cursor, false
+		}
+
+		id := slots.get(cursor, gen)
+		if id == 0 {
+			continue
+		}
+
+		if ms, ok := members[id]; ok {
+			if buf == nil {
+				n := chunkSize
+				if len(slots.slotOf) < n {
+					n = len(slots.slotOf)
+				}
+				buf = make([]*dstate.MemberState, 0, n)
+			}
+			buf = append(buf, &ms.MemberState)
+		}
+	}
+
+	return buf, cursor, true
+}
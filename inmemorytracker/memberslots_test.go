@@ -0,0 +1,155 @@
+package inmemorytracker
+
+import (
+	"testing"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+func createIterateTestState(numMembers int) *InMemoryTracker {
+	state := createTestState(TrackerConfig{
+		IterateMembersChunkSize: 10,
+	})
+
+	for i := 1; i < numMembers; i++ {
+		state.HandleEvent(testSession, &discordgo.GuildMemberAdd{
+			Member: createTestMember(initialTestGuildID, int64(initialTestMemberID+i), nil),
+		})
+	}
+
+	return state
+}
+
+func TestIterateMembers(t *testing.T) {
+	state := createIterateTestState(35)
+
+	chunks := 0
+	seen := make(map[int64]int)
+	state.IterateMembers(initialTestGuildID, func(chunk []*dstate.MemberState) bool {
+		chunks++
+		if len(chunk) > 10 {
+			t.Fatalf("chunk too big: %d", len(chunk))
+		}
+
+		for _, v := range chunk {
+			seen[v.User.ID]++
+		}
+
+		// modify the state between chunks
+		if chunks == 1 {
+			state.HandleEvent(testSession, &discordgo.GuildMemberRemove{
+				Member: createTestMember(initialTestGuildID, initialTestMemberID+30, nil),
+			})
+			state.HandleEvent(testSession, &discordgo.GuildMemberAdd{
+				Member: createTestMember(initialTestGuildID, 5000, nil),
+			})
+		}
+
+		return true
+	})
+
+	if chunks != 4 {
+		t.Fatalf("unexpected amount of chunks: %d", chunks)
+	}
+
+	for i := int64(0); i < 35; i++ {
+		id := initialTestMemberID + i
+		if id == initialTestMemberID+30 {
+			continue
+		}
+
+		if seen[id] != 1 {
+			t.Fatalf("member %d seen %d times", id, seen[id])
+		}
+	}
+
+	// stopping early
+	chunks = 0
+	state.IterateMembers(initialTestGuildID, func(chunk []*dstate.MemberState) bool {
+		chunks++
+		return false
+	})
+
+	if chunks != 1 {
+		t.Fatalf("iteration not stopped, chunks: %d", chunks)
+	}
+
+	// unknown guild
+	state.IterateMembers(999, func(chunk []*dstate.MemberState) bool {
+		t.Fatal("f called for unknown guild")
+		return true
+	})
+}
+
+func TestIterateMembersReAdded(t *testing.T) {
+	state := createIterateTestState(35)
+
+	seen := make(map[int64]int)
+	chunks := 0
+	state.IterateMembers(initialTestGuildID, func(chunk []*dstate.MemberState) bool {
+		chunks++
+		for _, v := range chunk {
+			seen[v.User.ID]++
+		}
+
+		// the re-added member gets the slot freed last, which is after the cursor
+		if chunks == 1 {
+			for _, id := range []int64{initialTestMemberID + 3, initialTestMemberID + 20} {
+				state.HandleEvent(testSession, &discordgo.GuildMemberRemove{
+					Member: createTestMember(initialTestGuildID, id, nil),
+				})
+			}
+			state.HandleEvent(testSession, &discordgo.GuildMemberAdd{
+				Member: createTestMember(initialTestGuildID, initialTestMemberID+3, nil),
+			})
+		}
+
+		return true
+	})
+
+	for i := int64(0); i < 35; i++ {
+		id := initialTestMemberID + i
+
+		expected := 1
+		if i == 20 {
+			expected = 0
+		}
+
+		if seen[id] != expected {
+			t.Fatalf("member %d seen %d times, expected %d", id, seen[id], expected)
+		}
+	}
+}
+
+func TestMemberSlotsReused(t *testing.T) {
+	state := createIterateTestState(20)
+	shard := state.getShard(0)
+
+	state.HandleEvent(testSession, &discordgo.GuildMemberRemove{
+		Member: createTestMember(initialTestGuildID, initialTestMemberID+5, nil),
+	})
+	state.HandleEvent(testSession, &discordgo.GuildMemberAdd{
+		Member: createTestMember(initialTestGuildID, 5000, nil),
+	})
+
+	slots := shard.memberSlots[initialTestGuildID]
+	if len(slots.ids) != 20 || slots.ids[5] != 5000 || len(slots.slotOf) != 20 {
+		t.Fatalf("slot not reused, slots: %d, slot 5: %d", len(slots.ids), slots.ids[5])
+	}
+}
+
+func TestIterateMembersAllocs(t *testing.T) {
+	state := createIterateTestState(1000)
+
+	allocs := testing.AllocsPerRun(10, func() {
+		state.IterateMembers(initialTestGuildID, func(chunk []*dstate.MemberState) bool {
+			return true
+		})
+	})
+
+	// the chunk buffer, closure and the like, but nothing per member
+	if allocs > 5 {
+		t.Fatalf("too many allocations: %f", allocs)
+	}
+}
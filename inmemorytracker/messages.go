@@ -0,0 +1,242 @@
+package inmemorytracker
+
+import (
+	"github.com/jonas747/dstate/v3"
+)
+
+const minChannelMessagesCap = 8
+
+// channelMessages holds the cached messages of a channel in a growable ring buffer, sorted by ID (and therefor by creation time)
+//
+// Messages are referred to by their logical index, 0 being the oldest message.
+// The ID index stores absolute positions, which is the logical index plus the number of messages ever trimmed from the front,
+// that way trimming old messages does not require updating the positions of the remaining ones.
+type channelMessages struct {
+	buf  []*dstate.MessageState
+	head int
+	n    int
+
+	// absolute position of the oldest message
+	first int64
+	byID  map[int64]int64
+}
+
+func newChannelMessages() *channelMessages {
+	return &channelMessages{
+		buf:  make([]*dstate.MessageState, minChannelMessagesCap),
+		byID: make(map[int64]int64),
+	}
+}
+
+func (cm *channelMessages) Len() int {
+	return cm.n
+}
+
+func (cm *channelMessages) at(i int) *dstate.MessageState {
+	return cm.buf[(cm.head+i)%len(cm.buf)]
+}
+
+func (cm *channelMessages) set(i int, ms *dstate.MessageState) {
+	cm.buf[(cm.head+i)%len(cm.buf)] = ms
+}
+
+// returns the logical index of the message, or false if it's not cached
+func (cm *channelMessages) get(id int64) (int, bool) {
+	pos, ok := cm.byID[id]
+	if !ok {
+		return 0, false
+	}
+
+	return int(pos - cm.first), true
+}
+
+// returns the logical index of the first message with a ID greater than or equal to id, or Len() if there's none
+func (cm *channelMessages) search(id int64) int {
+	lo, hi := 0, cm.n
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if cm.at(mid).ID < id {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	return lo
+}
+
+// insert adds the message at it's sorted position, replacing it if it's already cached
+// messages normally arrive in order, in which case this is a simple append
+func (cm *channelMessages) insert(ms *dstate.MessageState) {
+	if cm.n < 1 || cm.at(cm.n-1).ID < ms.ID {
+		cm.grow()
+		cm.set(cm.n, ms)
+		cm.byID[ms.ID] = cm.first + int64(cm.n)
+		cm.n++
+		return
+	}
+
+	if i, ok := cm.get(ms.ID); ok {
+		cm.set(i, ms)
+		return
+	}
+
+	// out of order, shift the newer messages to make room
+	i := cm.search(ms.ID)
+	cm.grow()
+	for j := cm.n; j > i; j-- {
+		moved := cm.at(j - 1)
+		cm.set(j, moved)
+		cm.byID[moved.ID] = cm.first + int64(j)
+	}
+
+	cm.set(i, ms)
+	cm.byID[ms.ID] = cm.first + int64(i)
+	cm.n++
+}
+
+// trimFront removes the count oldest messages
+func (cm *channelMessages) trimFront(count int) {
+	if count > cm.n {
+		count = cm.n
+	}
+
+	for i := 0; i < count; i++ {
+		delete(cm.byID, cm.at(0).ID)
+		cm.set(0, nil)
+		cm.head = (cm.head + 1) % len(cm.buf)
+		cm.n--
+		cm.first++
+	}
+
+	// give back memory after a large trim
+	size := len(cm.buf)
+	for size > minChannelMessagesCap && cm.n <= size/4 {
+		size /= 2
+	}
+
+	if size != len(cm.buf) {
+		cm.resize(size)
+	}
+}
+
+// makes room for at least one more message
+func (cm *channelMessages) grow() {
+	if cm.n < len(cm.buf) {
+		return
+	}
+
+	cm.resize(len(cm.buf) * 2)
+}
+
+func (cm *channelMessages) resize(size int) {
+	buf := make([]*dstate.MessageState, size)
+	for i := 0; i < cm.n; i++ {
+		buf[i] = cm.at(i)
+	}
+
+	cm.buf = buf
+	cm.head = 0
+}
+
+// returns the messages matching the query, newest first
+// authorRoles is used to look up the current roles of authors for the role filter, it may be nil
+// it returns false if the roles of the author are not known
+func (cm *channelMessages) query(query *dstate.MessagesQuery, authorRoles func(userID int64) ([]int64, bool)) []*dstate.MessageState {
+	// the range of logical indexes between Before and After
+	start, end := 0, cm.n
+	if query.Before != 0 {
+		end = cm.search(query.Before)
+	}
+	if query.After != 0 {
+		start = cm.search(query.After + 1)
+	}
+
+	limit := query.Limit
+	if limit < 1 {
+		limit = end - start
+		if limit < 0 {
+			limit = 0
+		}
+	}
+
+	buf := query.Buf
+	if buf != nil && cap(buf) >= limit {
+		buf = buf[:limit]
+	} else {
+		buf = make([]*dstate.MessageState, limit)
+	}
+
+	n := 0
+	for i := end - 1; i >= start && n < limit; i-- {
+		ms := cm.at(i)
+
+		var roles []int64
+		var rolesKnown bool
+		if query.RoleID != 0 && authorRoles != nil {
+			roles, rolesKnown = authorRoles(ms.Author.ID)
+		}
+
+		if query.Match(ms, roles, rolesKnown) {
+			buf[n] = ms
+			n++
+		}
+	}
+
+	return buf[:n]
+}
+
+// GetMessage returns a single cached message, or nil if it's not cached
+// deleted messages are also returned, check MessageState.Deleted if you don't want those
+func (tracker *InMemoryTracker) GetMessage(guildID int64, channelID int64, messageID int64) *dstate.MessageState {
+	shard := tracker.rlockGuildShard(guildID)
+	defer shard.mu.RUnlock()
+
+	messages, ok := shard.messages[channelID]
+	if !ok {
+		return nil
+	}
+
+	if i, ok := messages.get(messageID); ok {
+		return messages.at(i)
+	}
+
+	return nil
+}
+
+// returns the revisions of the message with it's current version added, or the existing ones if revisions are disabled
+func (shard *ShardTracker) appendRevision(guildID int64, ms *dstate.MessageState) []dstate.MessageRevision {
+	limit := shard.conf.MessageRevisions
+	if shard.conf.MessageRevisionsF != nil {
+		limit = shard.conf.MessageRevisionsF(guildID)
+	}
+
+	if limit < 1 {
+		return ms.Revisions
+	}
+
+	// make a new slice since the old one is shared with the previous version of the message
+	start := 0
+	if len(ms.Revisions)+1 > limit {
+		start = len(ms.Revisions) + 1 - limit
+	}
+
+	revisions := make([]dstate.MessageRevision, 0, len(ms.Revisions)+1-start)
+	revisions = append(revisions, ms.Revisions[start:]...)
+	revisions = append(revisions, ms.CurrentRevision())
+	return revisions
+}
+
+// GetMessageRevisions returns all the tracked versions of a message, oldest first and ending with the current version
+// returns nil if the message is not cached
+func (tracker *InMemoryTracker) GetMessageRevisions(guildID int64, channelID int64, messageID int64) []dstate.MessageRevision {
+	ms := tracker.GetMessage(guildID, channelID, messageID)
+	if ms == nil {
+		return nil
+	}
+
+	revisions := make([]dstate.MessageRevision, 0, len(ms.Revisions)+1)
+	revisions = append(revisions, ms.Revisions...)
+	revisions = append(revisions, ms.CurrentRevision())
+	return revisions
+}
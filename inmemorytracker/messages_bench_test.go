@@ -0,0 +1,170 @@
+package inmemorytracker
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/jonas747/dstate/v3"
+)
+
+// listChannelMessages is the previous container/list based message store, kept around to compare against in the benchmarks
+type listChannelMessages struct {
+	list *list.List
+	byID map[int64]*list.Element
+}
+
+func newListChannelMessages() *listChannelMessages {
+	return &listChannelMessages{
+		list: list.New(),
+		byID: make(map[int64]*list.Element),
+	}
+}
+
+func (cm *listChannelMessages) insert(ms *dstate.MessageState) {
+	cm.byID[ms.ID] = cm.list.PushBack(ms)
+}
+
+func (cm *listChannelMessages) trimFront(count int) {
+	for i := 0; i < count; i++ {
+		ms := cm.list.Remove(cm.list.Front()).(*dstate.MessageState)
+		delete(cm.byID, ms.ID)
+	}
+}
+
+func (cm *listChannelMessages) query(query *dstate.MessagesQuery) []*dstate.MessageState {
+	limit := query.Limit
+	if limit < 1 {
+		limit = cm.list.Len()
+	}
+
+	buf := query.Buf
+	if buf != nil && cap(buf) >= limit {
+		buf = buf[:limit]
+	} else {
+		buf = make([]*dstate.MessageState, limit)
+	}
+
+	i := 0
+	for e := cm.list.Back(); e != nil; e = e.Prev() {
+		m := e.Value.(*dstate.MessageState)
+		if query.Before != 0 && m.ID >= query.Before {
+			continue
+		}
+
+		if query.After != 0 && m.ID <= query.After {
+			break
+		}
+
+		if !query.IncludeDeleted && m.Deleted {
+			continue
+		}
+
+		buf[i] = m
+		i++
+		if i >= limit {
+			break
+		}
+	}
+
+	return buf[:i]
+}
+
+type benchMessageStore interface {
+	insert(ms *dstate.MessageState)
+	trimFront(count int)
+	query(query *dstate.MessagesQuery) []*dstate.MessageState
+}
+
+var benchMessageStores = []struct {
+	name string
+	new  func() benchMessageStore
+}{
+	{"List", func() benchMessageStore { return newListChannelMessages() }},
+	{"Ring", func() benchMessageStore { return ringBenchMessageStore{newChannelMessages()} }},
+}
+
+type ringBenchMessageStore struct {
+	*channelMessages
+}
+
+func (r ringBenchMessageStore) query(query *dstate.MessagesQuery) []*dstate.MessageState {
+	return r.channelMessages.query(query, nil)
+}
+
+func createBenchMessages(n int) []*dstate.MessageState {
+	messages := make([]*dstate.MessageState, n)
+	for i := range messages {
+		messages[i] = &dstate.MessageState{ID: int64(i + 1)}
+	}
+
+	return messages
+}
+
+// inserts messages while keeping the store at a fixed size, like the gc would
+func BenchmarkMessagesInsertTrim(b *testing.B) {
+	messages := createBenchMessages(100000)
+
+	for _, store := range benchMessageStores {
+		b.Run(store.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				cm := store.new()
+				for j, m := range messages {
+					cm.insert(m)
+					if j%100 == 0 && j > 1000 {
+						cm.trimFront(100)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMessagesQueryBefore(b *testing.B) {
+	messages := createBenchMessages(10000)
+
+	for _, store := range benchMessageStores {
+		b.Run(store.name, func(b *testing.B) {
+			cm := store.new()
+			for _, m := range messages {
+				cm.insert(m)
+			}
+
+			query := &dstate.MessagesQuery{
+				Buf:    make([]*dstate.MessageState, 50),
+				Before: 5000,
+				Limit:  50,
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cm.query(query)
+			}
+		})
+	}
+}
+
+func BenchmarkMessagesQueryLatest(b *testing.B) {
+	messages := createBenchMessages(10000)
+
+	for _, store := range benchMessageStores {
+		b.Run(store.name, func(b *testing.B) {
+			cm := store.new()
+			for _, m := range messages {
+				cm.insert(m)
+			}
+
+			query := &dstate.MessagesQuery{
+				Buf:   make([]*dstate.MessageState, 50),
+				Limit: 50,
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cm.query(query)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package inmemorytracker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+func TestGetMessage(t *testing.T) {
+	state := createTestState(TrackerConfig{})
+
+	ts := time.Date(2021, 5, 20, 10, 0, 0, 0, time.UTC)
+	for i := int64(0); i < 5; i++ {
+		state.HandleEvent(testSession, &discordgo.MessageCreate{
+			Message: createTestMessage(10000+i, ts),
+		})
+	}
+
+	if m := state.GetMessage(initialTestGuildID, initialTestChannelID, 10002); m == nil || m.ID != 10002 {
+		t.Fatalf("incorrect message: %#v", m)
+	}
+
+	if m := state.GetMessage(initialTestGuildID, initialTestChannelID, 20000); m != nil {
+		t.Fatalf("expected nil, got: %#v", m)
+	}
+
+	if m := state.GetMessage(initialTestGuildID, 999, 10002); m != nil {
+		t.Fatalf("expected nil, got: %#v", m)
+	}
+
+	state.HandleEvent(testSession, &discordgo.MessageUpdate{
+		Message: &discordgo.Message{ID: 10003, ChannelID: initialTestChannelID, GuildID: initialTestGuildID, Content: "edited"},
+	})
+	if m := state.GetMessage(initialTestGuildID, initialTestChannelID, 10003); m == nil || m.Content != "edited" {
+		t.Fatalf("message not updated: %#v", m)
+	}
+
+	state.HandleEvent(testSession, &discordgo.MessageDelete{
+		Message: &discordgo.Message{ID: 10000, ChannelID: initialTestChannelID, GuildID: initialTestGuildID},
+	})
+	state.HandleEvent(testSession, &discordgo.MessageDeleteBulk{
+		Messages:  []int64{10001, 10004, 20000},
+		ChannelID: initialTestChannelID,
+		GuildID:   initialTestGuildID,
+	})
+
+	for i := int64(0); i < 5; i++ {
+		m := state.GetMessage(initialTestGuildID, initialTestChannelID, 10000+i)
+		expectDeleted := i != 2 && i != 3
+		if m == nil || m.Deleted != expectDeleted {
+			t.Fatalf("incorrect deleted state of message %d: %#v", 10000+i, m)
+		}
+	}
+
+	verifyMessages(t, state, initialTestChannelID, []int64{10000, 10001, 10002, 10003, 10004})
+}
+
+func verifyChannelMessages(t *testing.T, cm *channelMessages, expected []int64) {
+	t.Helper()
+
+	if cm.Len() != len(expected) || len(cm.byID) != len(expected) {
+		t.Fatalf("mismatched lengths, got: %d (index: %d), expected: %d", cm.Len(), len(cm.byID), len(expected))
+	}
+
+	for i, id := range expected {
+		if cm.at(i).ID != id {
+			t.Fatalf("mismatched message at index [%d]: %d, expected: %d", i, cm.at(i).ID, id)
+		}
+
+		if indexed, ok := cm.get(id); !ok || indexed != i {
+			t.Fatalf("incorrect index of message %d: %d, expected: %d", id, indexed, i)
+		}
+	}
+}
+
+func TestChannelMessages(t *testing.T) {
+	cm := newChannelMessages()
+
+	var expected []int64
+	for i := int64(1); i <= 20; i++ {
+		cm.insert(&dstate.MessageState{ID: i * 10})
+		expected = append(expected, i*10)
+	}
+	verifyChannelMessages(t, cm, expected)
+
+	// wrap the ring around
+	cm.trimFront(5)
+	expected = expected[5:]
+	for i := int64(21); i <= 25; i++ {
+		cm.insert(&dstate.MessageState{ID: i * 10})
+		expected = append(expected, i*10)
+	}
+	verifyChannelMessages(t, cm, expected)
+
+	// out of order and duplicate inserts
+	cm.insert(&dstate.MessageState{ID: 105})
+	cm.insert(&dstate.MessageState{ID: 55})
+	cm.insert(&dstate.MessageState{ID: 100, Content: "replaced"})
+	expected = append([]int64{55, 60, 70, 80, 90, 100, 105}, expected[5:]...)
+	verifyChannelMessages(t, cm, expected)
+
+	if i, _ := cm.get(100); cm.at(i).Content != "replaced" {
+		t.Fatal("message not replaced")
+	}
+
+	// shrinks after trimming most of it
+	cm.trimFront(cm.Len() - 2)
+	verifyChannelMessages(t, cm, []int64{240, 250})
+	if len(cm.buf) != minChannelMessagesCap {
+		t.Fatalf("buffer not shrunk: %d", len(cm.buf))
+	}
+
+	cm.trimFront(10)
+	verifyChannelMessages(t, cm, nil)
+}
+
+func TestChannelMessagesQuery(t *testing.T) {
+	cm := newChannelMessages()
+	for i := int64(1); i <= 10; i++ {
+		cm.insert(&dstate.MessageState{ID: i, Deleted: i == 5})
+	}
+
+	cases := []struct {
+		query    dstate.MessagesQuery
+		expected []int64
+	}{
+		{dstate.MessagesQuery{}, []int64{10, 9, 8, 7, 6, 4, 3, 2, 1}},
+		{dstate.MessagesQuery{Limit: 3}, []int64{10, 9, 8}},
+		{dstate.MessagesQuery{Before: 7, Limit: 3}, []int64{6, 4, 3}},
+		{dstate.MessagesQuery{Before: 7, Limit: 3, IncludeDeleted: true}, []int64{6, 5, 4}},
+		{dstate.MessagesQuery{After: 7}, []int64{10, 9, 8}},
+		{dstate.MessagesQuery{Before: 9, After: 6}, []int64{8, 7}},
+		{dstate.MessagesQuery{Before: 3, After: 6}, []int64{}},
+		{dstate.MessagesQuery{Before: 100}, []int64{10, 9, 8, 7, 6, 4, 3, 2, 1}},
+	}
+
+	for i, c := range cases {
+		result := cm.query(&c.query, nil)
+		if len(result) != len(c.expected) {
+			t.Fatalf("case %d: mismatched length, got: %d, expected: %d", i, len(result), len(c.expected))
+		}
+
+		for j, v := range result {
+			if v.ID != c.expected[j] {
+				t.Fatalf("case %d: mismatched message at index [%d]: %d, expected: %d", i, j, v.ID, c.expected[j])
+			}
+		}
+	}
+}
+
+func TestGetMessagesRoleFilter(t *testing.T) {
+	state := createTestState(TrackerConfig{})
+
+	// the member without roles is cached, so the roles in their message should not be used
+	state.HandleEvent(testSession, &discordgo.GuildMemberAdd{Member: createTestMember(initialTestGuildID, 1001, nil)})
+
+	for i, authorID := range []int64{initialTestMemberID, 1001, 1002} {
+		msg := createTestMessage(int64(10000+i), time.Now())
+		msg.Author = createTestUser(authorID)
+		msg.Member = &discordgo.Member{Roles: []int64{initialTestRoleID}}
+		state.HandleEvent(testSession, &discordgo.MessageCreate{Message: msg})
+	}
+
+	// 1002 is not cached, so the roles in the message are used
+	result := state.GetMessages(initialTestGuildID, initialTestChannelID, &dstate.MessagesQuery{RoleID: initialTestRoleID})
+	if len(result) != 2 || result[0].ID != 10002 || result[1].ID != 10000 {
+		t.Fatalf("incorrect messages: %#v", result)
+	}
+}
+
+func TestMessageRevisions(t *testing.T) {
+	state := createTestState(TrackerConfig{
+		MessageRevisions: 2,
+	})
+
+	ts := time.Date(2021, 5, 20, 10, 0, 0, 0, time.UTC)
+	state.HandleEvent(testSession, &discordgo.MessageCreate{
+		Message: createTestMessage(10000, ts),
+	})
+
+	edit := func(content string, editedAt time.Time) {
+		state.HandleEvent(testSession, &discordgo.MessageUpdate{
+			Message: &discordgo.Message{
+				ID:              10000,
+				ChannelID:       initialTestChannelID,
+				GuildID:         initialTestGuildID,
+				Content:         content,
+				EditedTimestamp: discordgo.Timestamp(editedAt.Format(time.RFC3339)),
+			},
+		})
+	}
+
+	verifyRevisions := func(expected ...string) {
+		t.Helper()
+
+		revisions := state.GetMessageRevisions(initialTestGuildID, initialTestChannelID, 10000)
+		if len(revisions) != len(expected) {
+			t.Fatalf("mismatched revisions length, got: %d, expected: %d", len(revisions), len(expected))
+		}
+
+		for i, v := range revisions {
+			if v.Content != expected[i] {
+				t.Fatalf("mismatched revision at index [%d]: %q, expected: %q", i, v.Content, expected[i])
+			}
+		}
+	}
+
+	verifyRevisions("test message")
+
+	edit("edit 1", ts.Add(time.Minute))
+	verifyRevisions("test message", "edit 1")
+
+	// embed updates have the same edited timestamp and should not create revisions
+	edit("edit 1", ts.Add(time.Minute))
+	verifyRevisions("test message", "edit 1")
+
+	edit("edit 2", ts.Add(time.Minute*2))
+	edit("edit 3", ts.Add(time.Minute*3))
+	verifyRevisions("edit 1", "edit 2", "edit 3")
+
+	revisions := state.GetMessageRevisions(initialTestGuildID, initialTestChannelID, 10000)
+	if !revisions[2].ParsedEditedAt.Equal(ts.Add(time.Minute * 3)) {
+		t.Fatalf("incorrect edited at: %s", revisions[2].ParsedEditedAt)
+	}
+
+	if revisions := state.GetMessageRevisions(initialTestGuildID, initialTestChannelID, 20000); revisions != nil {
+		t.Fatalf("expected nil, got: %#v", revisions)
+	}
+}
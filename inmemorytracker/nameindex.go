@@ -0,0 +1,308 @@
+package inmemorytracker
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jonas747/dstate/v3"
+)
+
+// MemberSearchMode decides how the query is matched against the member names in SearchMembers
+type MemberSearchMode int
+
+const (
+	// Matches the full username, username#discriminator or nickname
+	MemberSearchExact MemberSearchMode = iota
+
+	// Matches names starting with the query, exact matches are returned first
+	MemberSearchPrefix
+
+	// Matches names containing the query or within a small edit distance of it, better matches are returned first
+	// note that this scans all the names in the guild, so it's a lot slower than the other modes
+	MemberSearchFuzzy
+)
+
+// MaxMemberSearchResults is the upper bound on the number of members returned by SearchMembers
+const MaxMemberSearchResults = 100
+
+// maxSortedNameUpdates is how many names can be added or removed from the sorted names of a index between searches before it's thrown away and rebuilt by the next search instead,
+// so that loading a lot of members at once doesn't insert them one by one
+const maxSortedNameUpdates = 64
+
+// memberNameIndex maps the lowercased names of the members in a guild to their ID's
+type memberNameIndex struct {
+	names map[string]map[int64]struct{}
+
+	// sorted keys of names, used for prefix searches
+	// this is built lazily by searches, which only hold a read lock, so it has it's own mutex
+	// once built, names are inserted and removed as they change, unless there's been more than maxSortedNameUpdates since the last search
+	sortedMu      sync.Mutex
+	sorted        []string
+	sortedUpdates int
+}
+
+func newMemberNameIndex() *memberNameIndex {
+	return &memberNameIndex{
+		names: make(map[string]map[int64]struct{}),
+	}
+}
+
+// assumes state is locked
+func (idx *memberNameIndex) add(name string, memberID int64) {
+	ids, ok := idx.names[name]
+	if !ok {
+		ids = make(map[int64]struct{})
+		idx.names[name] = ids
+		idx.updateSorted(name, true)
+	}
+
+	ids[memberID] = struct{}{}
+}
+
+// assumes state is locked
+func (idx *memberNameIndex) remove(name string, memberID int64) {
+	ids, ok := idx.names[name]
+	if !ok {
+		return
+	}
+
+	delete(ids, memberID)
+	if len(ids) < 1 {
+		delete(idx.names, name)
+		idx.updateSorted(name, false)
+	}
+}
+
+// inserts or removes name from the sorted names if they've been built
+// the searches using the sorted names only hold the read lock, so this can't run at the same time
+// assumes state is locked
+func (idx *memberNameIndex) updateSorted(name string, added bool) {
+	if idx.sorted == nil {
+		return
+	}
+
+	if idx.sortedUpdates >= maxSortedNameUpdates {
+		idx.sorted = nil
+		return
+	}
+	idx.sortedUpdates++
+
+	i := sort.SearchStrings(idx.sorted, name)
+	if added {
+		idx.sorted = append(idx.sorted, "")
+		copy(idx.sorted[i+1:], idx.sorted[i:])
+		idx.sorted[i] = name
+	} else if i < len(idx.sorted) && idx.sorted[i] == name {
+		idx.sorted = append(idx.sorted[:i], idx.sorted[i+1:]...)
+	}
+}
+
+func (idx *memberNameIndex) sortedNames() []string {
+	idx.sortedMu.Lock()
+	defer idx.sortedMu.Unlock()
+
+	if idx.sorted == nil {
+		sorted := make([]string, 0, len(idx.names))
+		for k := range idx.names {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		idx.sorted = sorted
+	}
+
+	idx.sortedUpdates = 0
+	return idx.sorted
+}
+
+// SearchMembers searches the cached members of a guild by username, username#discriminator and nickname, ignoring case
+// at most limit members are returned, or MaxMemberSearchResults if limit is out of that range
+func (tracker *InMemoryTracker) SearchMembers(guildID int64, query string, mode MemberSearchMode, limit int) []*dstate.MemberState {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil
+	}
+
+	if limit < 1 || limit > MaxMemberSearchResults {
+		limit = MaxMemberSearchResults
+	}
+
+	shard := tracker.rlockGuildShard(guildID)
+	defer shard.mu.RUnlock()
+
+	idx, ok := shard.memberNames[guildID]
+	if !ok {
+		return nil
+	}
+
+	s := &memberSearch{
+		members: shard.members[guildID],
+		seen:    make(map[int64]struct{}),
+		limit:   limit,
+	}
+
+	if !s.add(idx.names[query]) || mode == MemberSearchExact {
+		return s.results
+	}
+
+	// prefix matches
+	sorted := idx.sortedNames()
+	for i := sort.SearchStrings(sorted, query); i < len(sorted) && strings.HasPrefix(sorted[i], query); i++ {
+		if !s.add(idx.names[sorted[i]]) {
+			return s.results
+		}
+	}
+
+	if mode != MemberSearchFuzzy {
+		return s.results
+	}
+
+	for _, name := range sorted {
+		if strings.Contains(name, query) && !s.add(idx.names[name]) {
+			return s.results
+		}
+	}
+
+	maxDist := 1
+	if len(query) > 6 {
+		maxDist = 2
+	}
+
+	q := []rune(query)
+	for _, name := range sorted {
+		if withinEditDistance(q, []rune(name), maxDist) && !s.add(idx.names[name]) {
+			return s.results
+		}
+	}
+
+	return s.results
+}
+
+type memberSearch struct {
+	members map[int64]*WrappedMember
+	seen    map[int64]struct{}
+	results []*dstate.MemberState
+	limit   int
+}
+
+// adds the members to the results, returns false once the limit is reached
+func (s *memberSearch) add(ids map[int64]struct{}) bool {
+	for id := range ids {
+		if _, ok := s.seen[id]; ok {
+			continue
+		}
+
+		if ms, ok := s.members[id]; ok {
+			s.seen[id] = struct{}{}
+			s.results = append(s.results, &ms.MemberState)
+			if len(s.results) >= s.limit {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// returns true if the levenshtein distance between a and b is at most maxDist
+func withinEditDistance(a, b []rune, maxDist int) bool {
+	if len(a)-len(b) > maxDist || len(b)-len(a) > maxDist {
+		return false
+	}
+
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+
+		if rowMin > maxDist {
+			return false
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)] <= maxDist
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// returns the lowercased names a member can be searched by
+func memberNames(wm *WrappedMember) []string {
+	if wm == nil || wm.User.Username == "" {
+		return nil
+	}
+
+	username := strings.ToLower(wm.User.Username)
+	names := []string{username}
+	if wm.User.Discriminator != "" && wm.User.Discriminator != "0" {
+		names = append(names, username+"#"+wm.User.Discriminator)
+	}
+
+	if wm.Member != nil && wm.Member.Nick != "" {
+		names = append(names, strings.ToLower(wm.Member.Nick))
+	}
+
+	return names
+}
+
+// updates the name index for a member that changed from oldMember to newMember, either of which may be nil
+// assumes state is locked
+func (shard *ShardTracker) indexMemberNamesLocked(guildID int64, memberID int64, oldMember *WrappedMember, newMember *WrappedMember) {
+	oldNames := memberNames(oldMember)
+	newNames := memberNames(newMember)
+
+	idx, ok := shard.memberNames[guildID]
+	if !ok {
+		if len(newNames) < 1 {
+			return
+		}
+
+		idx = newMemberNameIndex()
+		shard.memberNames[guildID] = idx
+	}
+
+	for _, v := range oldNames {
+		if !containsString(newNames, v) {
+			idx.remove(v, memberID)
+		}
+	}
+
+	for _, v := range newNames {
+		idx.add(v, memberID)
+	}
+}
+
+func containsString(s []string, v string) bool {
+	for _, sv := range s {
+		if sv == v {
+			return true
+		}
+	}
+
+	return false
+}
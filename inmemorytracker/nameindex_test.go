@@ -0,0 +1,149 @@
+package inmemorytracker
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/jonas747/discordgo"
+)
+
+func createNamedTestMember(id int64, username string, nick string) *discordgo.Member {
+	return &discordgo.Member{
+		GuildID: initialTestGuildID,
+		Nick:    nick,
+		User: &discordgo.User{
+			ID:            id,
+			Username:      username,
+			Discriminator: "1234",
+		},
+	}
+}
+
+func verifySearch(t *testing.T, tracker *InMemoryTracker, query string, mode MemberSearchMode, limit int, expected ...int64) {
+	t.Helper()
+
+	results := tracker.SearchMembers(initialTestGuildID, query, mode, limit)
+	ids := make([]int64, 0, len(results))
+	for _, v := range results {
+		ids = append(ids, v.User.ID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	if len(ids) != len(expected) {
+		t.Fatalf("mismatched results for %q, got: %v, expected: %v", query, ids, expected)
+	}
+
+	for i := range ids {
+		if ids[i] != expected[i] {
+			t.Fatalf("mismatched results for %q, got: %v, expected: %v", query, ids, expected)
+		}
+	}
+}
+
+func TestSearchMembers(t *testing.T) {
+	tracker := createTestState(TrackerConfig{})
+
+	for _, v := range []*discordgo.Member{
+		createNamedTestMember(2000, "Alice", ""),
+		createNamedTestMember(2001, "alicia", "Ally"),
+		createNamedTestMember(2002, "bob", "The Alien"),
+		createNamedTestMember(2003, "Robert", ""),
+	} {
+		tracker.HandleEvent(testSession, &discordgo.GuildMemberAdd{Member: v})
+	}
+
+	verifySearch(t, tracker, "ALICE", MemberSearchExact, 0, 2000)
+	verifySearch(t, tracker, "alice#1234", MemberSearchExact, 0, 2000)
+	verifySearch(t, tracker, "ally", MemberSearchExact, 0, 2001)
+	verifySearch(t, tracker, "ali", MemberSearchExact, 0)
+
+	verifySearch(t, tracker, "ali", MemberSearchPrefix, 0, 2000, 2001)
+	verifySearch(t, tracker, "the al", MemberSearchPrefix, 0, 2002)
+	verifySearch(t, tracker, "ali", MemberSearchPrefix, 1, 2000)
+
+	// substring and typos
+	verifySearch(t, tracker, "alien", MemberSearchFuzzy, 0, 2002)
+	verifySearch(t, tracker, "robrt", MemberSearchFuzzy, 0, 2003)
+	verifySearch(t, tracker, "bert", MemberSearchFuzzy, 0, 2003)
+
+	// nickname changed
+	tracker.HandleEvent(testSession, &discordgo.GuildMemberUpdate{Member: createNamedTestMember(2002, "bob", "")})
+	verifySearch(t, tracker, "the alien", MemberSearchExact, 0)
+	verifySearch(t, tracker, "bob", MemberSearchExact, 0, 2002)
+
+	// username changed through a presence update
+	tracker.HandleEvent(testSession, &discordgo.PresenceUpdate{
+		GuildID: initialTestGuildID,
+		Presence: discordgo.Presence{
+			User:   &discordgo.User{ID: 2003, Username: "Bobby", Discriminator: "1234"},
+			Status: discordgo.StatusOnline,
+		},
+	})
+	verifySearch(t, tracker, "robert", MemberSearchExact, 0)
+	verifySearch(t, tracker, "bob", MemberSearchPrefix, 0, 2002, 2003)
+
+	tracker.HandleEvent(testSession, &discordgo.GuildMemberRemove{Member: createNamedTestMember(2000, "Alice", "")})
+	verifySearch(t, tracker, "ali", MemberSearchPrefix, 0, 2001)
+
+	tracker.HandleEvent(testSession, &discordgo.GuildDelete{Guild: &discordgo.Guild{ID: initialTestGuildID}})
+	verifySearch(t, tracker, "ali", MemberSearchPrefix, 0)
+}
+
+func TestWithinEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		maxDist  int
+		expected bool
+	}{
+		{"kitten", "kitten", 0, true},
+		{"kitten", "sitten", 1, true},
+		{"kitten", "sitting", 2, false},
+		{"kitten", "sitting", 3, true},
+		{"abc", "abcd", 1, true},
+		{"abc", "abcde", 1, false},
+		{"", "a", 1, true},
+	}
+
+	for _, c := range cases {
+		if withinEditDistance([]rune(c.a), []rune(c.b), c.maxDist) != c.expected {
+			t.Errorf("withinEditDistance(%q, %q, %d) != %t", c.a, c.b, c.maxDist, c.expected)
+		}
+	}
+}
+
+func TestMemberNameIndexSorted(t *testing.T) {
+	idx := newMemberNameIndex()
+	idx.add("b", 1)
+	idx.add("d", 2)
+	idx.sortedNames()
+
+	// updated in place once built
+	idx.add("a", 3)
+	idx.add("c", 4)
+	idx.add("c", 5)
+	idx.remove("d", 2)
+	idx.remove("c", 4)
+
+	expected := []string{"a", "b", "c"}
+	if !sort.StringsAreSorted(idx.sorted) || len(idx.sorted) != len(expected) {
+		t.Fatalf("incorrect sorted names: %v", idx.sorted)
+	}
+	for i, v := range expected {
+		if idx.sorted[i] != v {
+			t.Fatalf("incorrect sorted names: %v", idx.sorted)
+		}
+	}
+
+	// too many updates between searches and it's thrown away instead
+	for i := 0; i <= maxSortedNameUpdates; i++ {
+		idx.add(string(rune('e'+i)), int64(10+i))
+	}
+
+	if idx.sorted != nil {
+		t.Fatal("sorted names should have been reset")
+	}
+
+	if sorted := idx.sortedNames(); len(sorted) != 3+maxSortedNameUpdates+1 || !sort.StringsAreSorted(sorted) {
+		t.Fatalf("incorrect rebuilt names: %v", sorted)
+	}
+}
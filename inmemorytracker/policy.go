@@ -0,0 +1,201 @@
+package inmemorytracker
+
+import (
+	"time"
+
+	"github.com/jonas747/dstate/v3"
+)
+
+// CachePolicy decides what is cached for a guild, see TrackerConfig.CachePolicyF
+// the zero value caches everything, limited by the message limits in TrackerConfig
+type CachePolicy struct {
+	NoMembers     bool
+	NoPresences   bool
+	NoVoiceStates bool
+	NoEmojis      bool
+	NoMessages    bool
+
+	// Overrides TrackerConfig.ChannelMessageLen and ChannelMessageDur (or ChannelMessageLimitsF) respectively, each only if set
+	MessageLen int
+	MessageDur time.Duration
+
+	// Overrides the message limits for specific channels, key is the ChannelID
+	ChannelMessageLimits map[int64]MessageLimits
+
+	// Messages in these channels, and the threads in them, are not cached
+	ExcludedChannels []int64
+}
+
+type MessageLimits struct {
+	Len int
+	Dur time.Duration
+}
+
+var defaultCachePolicy = &CachePolicy{}
+
+// IsChannelExcluded returns true if messages should not be cached in the channel
+// this does not know about threads, for those the parent channel has to be checked as well
+func (p *CachePolicy) IsChannelExcluded(channelID int64) bool {
+	if p.NoMessages {
+		return true
+	}
+
+	for _, v := range p.ExcludedChannels {
+		if v == channelID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns true if messages should not be cached in the channel, or if it's a thread, in its parent channel
+// assumes state is locked
+func (shard *ShardTracker) isChannelExcludedLocked(guildID int64, channelID int64) bool {
+	policy := shard.cachePolicyLocked(guildID)
+	if policy.IsChannelExcluded(channelID) {
+		return true
+	}
+
+	if gs, ok := shard.guilds[guildID]; ok {
+		for _, v := range gs.Threads {
+			if v.ID == channelID {
+				return policy.IsChannelExcluded(v.ParentID)
+			}
+		}
+	}
+
+	return false
+}
+
+// returns the message limits of the channel, falling back to the guild wide limits
+func (p *CachePolicy) channelMessageLimits(channelID int64, guildLen int, guildDur time.Duration) (int, time.Duration) {
+	if limits, ok := p.ChannelMessageLimits[channelID]; ok {
+		return limits.Len, limits.Dur
+	}
+
+	return guildLen, guildDur
+}
+
+// cachePolicyLocked returns the policy of the guild, the result of TrackerConfig.CachePolicyF is kept until the guild is removed or RefreshCachePolicy is called
+// it's only kept for guilds in state, as it's not removed for the others
+// assumes state is locked
+func (shard *ShardTracker) cachePolicyLocked(guildID int64) *CachePolicy {
+	if shard.conf.CachePolicyF == nil {
+		return defaultCachePolicy
+	}
+
+	if policy, ok := shard.cachePolicies[guildID]; ok {
+		return policy
+	}
+
+	policy := shard.conf.CachePolicyF(guildID)
+	if policy == nil {
+		policy = defaultCachePolicy
+	}
+
+	if _, ok := shard.guilds[guildID]; ok {
+		shard.cachePolicies[guildID] = policy
+	}
+
+	return policy
+}
+
+// RefreshCachePolicy calls TrackerConfig.CachePolicyF again for the guild, for example after it's been upgraded to premium,
+// and removes anything from the state that's no longer allowed by the new policy
+func (tracker *InMemoryTracker) RefreshCachePolicy(guildID int64) {
+	shard := tracker.lockGuildShard(guildID)
+	delete(shard.cachePolicies, guildID)
+	shard.applyCachePolicyLocked(guildID)
+	shard.mu.Unlock()
+
+	shard.flushChanges()
+}
+
+// assumes state is locked
+func (shard *ShardTracker) applyCachePolicyLocked(guildID int64) {
+	gs, ok := shard.guilds[guildID]
+	if !ok {
+		return
+	}
+
+	policy := shard.cachePolicyLocked(guildID)
+
+	if policy.NoEmojis && len(gs.Emojis) > 0 {
+		newGS := gs.copyGuildSet()
+		newGS.Emojis = nil
+		shard.guilds[guildID] = newGS
+		if shard.changes.active() {
+			shard.emit(&dstate.EmojisChange{GuildID: guildID, Old: gs.Emojis})
+		}
+		gs = newGS
+	}
+
+	if policy.NoVoiceStates && len(gs.VoiceStates) > 0 {
+		newGS := gs.copyVoiceStates()
+		newGS.VoiceStates = nil
+		shard.guilds[guildID] = newGS
+		if shard.changes.active() {
+			for i := range gs.VoiceStates {
+				shard.emit(&dstate.VoiceStateChange{GuildID: guildID, Old: &gs.VoiceStates[i]})
+			}
+		}
+		gs = newGS
+	}
+
+	for _, v := range gs.Channels {
+		if policy.IsChannelExcluded(v.ID) {
+			delete(shard.messages, v.ID)
+		}
+	}
+
+	for _, v := range gs.Threads {
+		if policy.IsChannelExcluded(v.ID) || policy.IsChannelExcluded(v.ParentID) {
+			delete(shard.messages, v.ID)
+		}
+	}
+
+	if !policy.NoMembers && !policy.NoPresences {
+		return
+	}
+
+	for _, v := range shard.members[guildID] {
+		if v.User.ID == shard.conf.BotMemberID {
+			continue
+		}
+
+		member, presence := v.Member, v.Presence
+		if policy.NoMembers {
+			member = nil
+		}
+		if policy.NoPresences {
+			presence = nil
+		}
+
+		if member == v.Member && presence == v.Presence {
+			continue
+		}
+
+		if member == nil && presence == nil {
+			delete(shard.members[guildID], v.User.ID)
+			shard.unindexMemberLocked(v)
+			if shard.changes.active() {
+				shard.emit(&dstate.MemberChange{GuildID: guildID, Old: &v.MemberState})
+			}
+			continue
+		}
+
+		cop := *v
+		cop.Member = member
+		cop.Presence = presence
+		shard.members[guildID][v.User.ID] = &cop
+		shard.indexMemberLocked(guildID, v.User.ID, v, &cop)
+		if shard.changes.active() {
+			shard.emit(&dstate.MemberChange{GuildID: guildID, Old: &v.MemberState, New: &cop.MemberState})
+		}
+	}
+
+	if policy.NoMembers {
+		shard.setMembersCompleteLocked(guildID, false)
+	}
+}
@@ -0,0 +1,255 @@
+package inmemorytracker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+func TestCachePolicy(t *testing.T) {
+	policy := &CachePolicy{
+		NoMembers:        true,
+		NoPresences:      true,
+		NoVoiceStates:    true,
+		NoEmojis:         true,
+		ExcludedChannels: []int64{11},
+	}
+
+	state := NewInMemoryTracker(TrackerConfig{
+		BotMemberID: 999,
+		CachePolicyF: func(guildID int64) *CachePolicy {
+			if guildID == initialTestGuildID {
+				return policy
+			}
+			return nil
+		},
+	}, 1)
+
+	state.HandleEvent(testSession, &discordgo.GuildCreate{
+		Guild: &discordgo.Guild{
+			ID:          initialTestGuildID,
+			MemberCount: 2,
+			Members: []*discordgo.Member{
+				createTestMember(0, initialTestMemberID, nil),
+				createTestMember(0, 999, nil),
+			},
+			Presences: []*discordgo.Presence{
+				{User: createTestUser(initialTestMemberID), Status: discordgo.StatusOnline},
+			},
+			Channels: []*discordgo.Channel{
+				createTestChannel(0, initialTestChannelID, nil),
+				createTestChannel(0, 11, nil),
+			},
+			Emojis:      []*discordgo.Emoji{{ID: 50}},
+			VoiceStates: []*discordgo.VoiceState{{UserID: initialTestMemberID, ChannelID: 11}},
+		},
+	})
+
+	if state.GetMember(initialTestGuildID, initialTestMemberID) != nil {
+		t.Fatal("member should not be cached")
+	}
+
+	assertMemberExists(t, state, initialTestGuildID, 999, true, false)
+
+	if state.IsMemberListComplete(initialTestGuildID) {
+		t.Fatal("member list should not be complete when members are not cached")
+	}
+
+	gs := state.GetGuild(initialTestGuildID)
+	if len(gs.Emojis) != 0 || len(gs.VoiceStates) != 0 {
+		t.Fatal("emojis or voice states should not be cached")
+	}
+
+	state.HandleEvent(testSession, &discordgo.VoiceStateUpdate{VoiceState: &discordgo.VoiceState{GuildID: initialTestGuildID, UserID: 2000, ChannelID: 11}})
+	state.HandleEvent(testSession, &discordgo.GuildEmojisUpdate{GuildID: initialTestGuildID, Emojis: []*discordgo.Emoji{{ID: 51}}})
+
+	gs = state.GetGuild(initialTestGuildID)
+	if len(gs.Emojis) != 0 || len(gs.VoiceStates) != 0 {
+		t.Fatal("emojis or voice states should not be cached")
+	}
+
+	msg := createTestMessage(10000, time.Now())
+	state.HandleEvent(testSession, &discordgo.MessageCreate{Message: msg})
+
+	excluded := createTestMessage(10001, time.Now())
+	excluded.ChannelID = 11
+	state.HandleEvent(testSession, &discordgo.MessageCreate{Message: excluded})
+
+	if state.GetMessage(initialTestGuildID, initialTestChannelID, 10000) == nil {
+		t.Fatal("message should be cached")
+	}
+
+	if state.GetMessage(initialTestGuildID, 11, 10001) != nil {
+		t.Fatal("message in excluded channel should not be cached")
+	}
+
+	// upgrade the guild to full caching, but exclude all messages
+	policy = &CachePolicy{NoMessages: true}
+	state.RefreshCachePolicy(initialTestGuildID)
+
+	if state.GetMessage(initialTestGuildID, initialTestChannelID, 10000) != nil {
+		t.Fatal("messages should have been removed by the new policy")
+	}
+
+	state.HandleEvent(testSession, &discordgo.GuildMemberAdd{Member: createTestMember(initialTestGuildID, 1001, nil)})
+	assertMemberExists(t, state, initialTestGuildID, 1001, true, false)
+
+	// and back to no presences, which should keep the members but remove their presences
+	state.HandleEvent(testSession, &discordgo.PresenceUpdate{GuildID: initialTestGuildID, Presence: discordgo.Presence{User: createTestUser(1001), Status: discordgo.StatusOnline}})
+	assertMemberExists(t, state, initialTestGuildID, 1001, true, true)
+
+	policy = &CachePolicy{NoPresences: true}
+	state.RefreshCachePolicy(initialTestGuildID)
+	if ms := state.GetMember(initialTestGuildID, 1001); ms == nil || ms.Member == nil || ms.Presence != nil {
+		t.Fatalf("expected member without presence: %#v", ms)
+	}
+}
+
+func TestCachePolicyMessageLimits(t *testing.T) {
+	state := createTestState(TrackerConfig{
+		ChannelMessageLen: 1,
+		CachePolicyF: func(guildID int64) *CachePolicy {
+			return &CachePolicy{
+				MessageLen: 3,
+				ChannelMessageLimits: map[int64]MessageLimits{
+					11: {Len: 2},
+				},
+			}
+		},
+	})
+	shard := state.getShard(0)
+
+	state.HandleEvent(testSession, &discordgo.ChannelCreate{Channel: createTestChannel(initialTestGuildID, 11, nil)})
+
+	ts := time.Date(2021, 5, 20, 10, 0, 0, 0, time.UTC)
+	for i := int64(0); i < 5; i++ {
+		state.HandleEvent(testSession, &discordgo.MessageCreate{Message: createTestMessage(10000+i, ts)})
+
+		m := createTestMessage(20000+i, ts)
+		m.ChannelID = 11
+		state.HandleEvent(testSession, &discordgo.MessageCreate{Message: m})
+	}
+
+	shard.gcTick(ts, nil)
+	verifyMessages(t, state, initialTestChannelID, []int64{10002, 10003, 10004})
+	verifyMessages(t, state, 11, []int64{20003, 20004})
+}
+
+func TestCachePolicyMessageLimitsSeparate(t *testing.T) {
+	// the policy only overrides the length, the configured duration should still apply
+	state := createTestState(TrackerConfig{
+		ChannelMessageDur: time.Hour,
+		CachePolicyF: func(guildID int64) *CachePolicy {
+			return &CachePolicy{MessageLen: 3}
+		},
+	})
+
+	ts := time.Date(2021, 5, 20, 10, 0, 0, 0, time.UTC)
+	state.HandleEvent(testSession, &discordgo.MessageCreate{Message: createTestMessage(10000, ts.Add(-time.Hour*2))})
+	for i := int64(1); i < 5; i++ {
+		state.HandleEvent(testSession, &discordgo.MessageCreate{Message: createTestMessage(10000+i, ts)})
+	}
+
+	state.getShard(0).gcTick(ts, nil)
+	verifyMessages(t, state, initialTestChannelID, []int64{10002, 10003, 10004})
+
+	state.getShard(0).gcTick(ts.Add(time.Hour*2), nil)
+	verifyMessages(t, state, initialTestChannelID, []int64{})
+}
+
+func TestCachePolicyUnknownGuild(t *testing.T) {
+	calls := make(map[int64]int)
+	state := createTestState(TrackerConfig{
+		CachePolicyF: func(guildID int64) *CachePolicy {
+			calls[guildID]++
+			return &CachePolicy{}
+		},
+	})
+
+	m := createTestMessage(10000, time.Now())
+	m.GuildID = 555
+	state.HandleEvent(testSession, &discordgo.MessageCreate{Message: m})
+	state.HandleEvent(testSession, &discordgo.MessageCreate{Message: createTestMessage(10001, time.Now())})
+
+	shard := state.getShard(0)
+	if _, ok := shard.cachePolicies[555]; ok {
+		t.Fatal("policy kept for guild not in state")
+	}
+
+	if calls[initialTestGuildID] != 1 {
+		t.Fatalf("policy of guild in state looked up %d times", calls[initialTestGuildID])
+	}
+}
+
+func TestCachePolicyExcludedThreads(t *testing.T) {
+	policy := &CachePolicy{}
+	state := createTestState(TrackerConfig{
+		CachePolicyF: func(guildID int64) *CachePolicy {
+			return policy
+		},
+	})
+	state.HandleEvent(testSession, &dstate.ThreadCreate{ThreadChannel: createTestThread(20, initialTestChannelID, false)})
+
+	msg := createTestMessage(10000, time.Now())
+	msg.ChannelID = 20
+	state.HandleEvent(testSession, &discordgo.MessageCreate{Message: msg})
+	if state.GetMessage(initialTestGuildID, 20, 10000) == nil {
+		t.Fatal("message should be cached")
+	}
+
+	// excluding the parent channel should exclude the thread as well
+	policy = &CachePolicy{ExcludedChannels: []int64{initialTestChannelID}}
+	state.RefreshCachePolicy(initialTestGuildID)
+	if state.GetMessage(initialTestGuildID, 20, 10000) != nil {
+		t.Fatal("message in thread of excluded channel should have been removed")
+	}
+
+	msg = createTestMessage(10001, time.Now())
+	msg.ChannelID = 20
+	state.HandleEvent(testSession, &discordgo.MessageCreate{Message: msg})
+	if state.GetMessage(initialTestGuildID, 20, 10001) != nil {
+		t.Fatal("message in thread of excluded channel should not be cached")
+	}
+}
+
+func TestCachePolicyRefreshChanges(t *testing.T) {
+	policy := &CachePolicy{}
+	state := createTestState(TrackerConfig{
+		CachePolicyF: func(guildID int64) *CachePolicy {
+			return policy
+		},
+	})
+	state.HandleEvent(testSession, &discordgo.VoiceStateUpdate{VoiceState: &discordgo.VoiceState{GuildID: initialTestGuildID, UserID: initialTestMemberID, ChannelID: initialTestChannelID}})
+
+	var changes []dstate.StateChange
+	unsub := state.Subscribe(func(change dstate.StateChange) {
+		changes = append(changes, change)
+	})
+	defer unsub()
+
+	policy = &CachePolicy{NoMembers: true, NoPresences: true, NoVoiceStates: true}
+	state.RefreshCachePolicy(initialTestGuildID)
+
+	// the changes should be dispatched by the refresh itself and not wait for the next event
+	var voiceStates, members int
+	for _, v := range changes {
+		switch c := v.(type) {
+		case *dstate.VoiceStateChange:
+			if c.Old == nil || c.Old.UserID != initialTestMemberID || c.New != nil {
+				t.Fatalf("unexpected voice state change: %#v", c)
+			}
+			voiceStates++
+		case *dstate.MemberChange:
+			if c.Old == nil || c.Old.User.ID != initialTestMemberID || c.New != nil {
+				t.Fatalf("unexpected member change: %#v", c)
+			}
+			members++
+		}
+	}
+
+	if voiceStates != 1 || members != 1 {
+		t.Fatalf("unexpected changes: %d voice states, %d members", voiceStates, members)
+	}
+}
@@ -0,0 +1,131 @@
+package inmemorytracker
+
+import (
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+func (shard *ShardTracker) handleReactionAdd(r *discordgo.MessageReaction) {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.updateReactionsLocked(r, func(reactions []dstate.MessageReactionState) []dstate.MessageReactionState {
+		for i := range reactions {
+			v := &reactions[i]
+			if !dstate.SameEmoji(&v.Emoji, &r.Emoji) {
+				continue
+			}
+
+			// only the tracked users can be checked, see TrackerConfig.MessageReactionUsers
+			if containsInt64(v.UserIDs, r.UserID) {
+				// duplicate event
+				return nil
+			}
+
+			v.Count++
+			v.UserIDs = shard.appendReactionUser(v.UserIDs, r.UserID)
+			return reactions
+		}
+
+		return append(reactions, dstate.MessageReactionState{
+			Emoji:   r.Emoji,
+			Count:   1,
+			UserIDs: shard.appendReactionUser(nil, r.UserID),
+		})
+	})
+}
+
+func (shard *ShardTracker) handleReactionRemove(r *discordgo.MessageReaction) {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.updateReactionsLocked(r, func(reactions []dstate.MessageReactionState) []dstate.MessageReactionState {
+		for i := range reactions {
+			v := &reactions[i]
+			if !dstate.SameEmoji(&v.Emoji, &r.Emoji) {
+				continue
+			}
+
+			if v.Count <= 1 {
+				return append(reactions[:i], reactions[i+1:]...)
+			}
+
+			v.Count--
+			for j, u := range v.UserIDs {
+				if u == r.UserID {
+					userIDs := make([]int64, 0, len(v.UserIDs)-1)
+					userIDs = append(userIDs, v.UserIDs[:j]...)
+					v.UserIDs = append(userIDs, v.UserIDs[j+1:]...)
+					break
+				}
+			}
+
+			return reactions
+		}
+
+		return nil
+	})
+}
+
+func (shard *ShardTracker) handleReactionRemoveAll(r *discordgo.MessageReaction) {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.updateReactionsLocked(r, func(reactions []dstate.MessageReactionState) []dstate.MessageReactionState {
+		if len(reactions) < 1 {
+			return nil
+		}
+
+		return []dstate.MessageReactionState{}
+	})
+}
+
+// calls f with a copy of the message's reactions, f returns the new reactions or nil if nothing changed
+// assumes state is locked
+func (shard *ShardTracker) updateReactionsLocked(r *discordgo.MessageReaction, f func(reactions []dstate.MessageReactionState) []dstate.MessageReactionState) {
+	if r.GuildID == 0 {
+		return
+	}
+
+	cl, ok := shard.messages[r.ChannelID]
+	if !ok {
+		return
+	}
+
+	i, ok := cl.get(r.MessageID)
+	if !ok {
+		return
+	}
+
+	cast := cl.at(i)
+
+	reactions := make([]dstate.MessageReactionState, len(cast.Reactions))
+	copy(reactions, cast.Reactions)
+
+	reactions = f(reactions)
+	if reactions == nil {
+		return
+	}
+
+	cop := *cast
+	cop.Reactions = reactions
+	if len(reactions) < 1 {
+		cop.Reactions = nil
+	}
+
+	cl.set(i, &cop)
+	if shard.changes.active() {
+		shard.emit(&dstate.MessageChange{GuildID: r.GuildID, Old: cast, New: &cop})
+	}
+}
+
+// returns a new slice with the user added if there's room for it
+func (shard *ShardTracker) appendReactionUser(userIDs []int64, userID int64) []int64 {
+	if len(userIDs) >= shard.conf.MessageReactionUsers {
+		return userIDs
+	}
+
+	result := make([]int64, 0, len(userIDs)+1)
+	result = append(result, userIDs...)
+	return append(result, userID)
+}
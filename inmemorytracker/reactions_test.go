@@ -0,0 +1,109 @@
+package inmemorytracker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+func createTestReaction(userID int64, emoji discordgo.Emoji) *discordgo.MessageReaction {
+	return &discordgo.MessageReaction{
+		UserID:    userID,
+		MessageID: 10000,
+		Emoji:     emoji,
+		ChannelID: initialTestChannelID,
+		GuildID:   initialTestGuildID,
+	}
+}
+
+func TestReactions(t *testing.T) {
+	state := createTestState(TrackerConfig{
+		MessageReactionUsers: 2,
+	})
+
+	state.HandleEvent(testSession, &discordgo.MessageCreate{
+		Message: createTestMessage(10000, time.Now()),
+	})
+
+	star := discordgo.Emoji{Name: "⭐"}
+	custom := discordgo.Emoji{ID: 500, Name: "custom"}
+
+	getReaction := func(emoji discordgo.Emoji) *dstate.MessageReactionState {
+		m := state.GetMessage(initialTestGuildID, initialTestChannelID, 10000)
+		return m.FindReaction(&emoji)
+	}
+
+	for _, v := range []int64{1, 2, 3, 3} {
+		state.HandleEvent(testSession, &discordgo.MessageReactionAdd{MessageReaction: createTestReaction(v, star)})
+	}
+	state.HandleEvent(testSession, &discordgo.MessageReactionAdd{MessageReaction: createTestReaction(1, custom)})
+
+	// the second add from user 3 is not detected as a duplicate since only 2 users are tracked
+	if r := getReaction(star); r == nil || r.Count != 4 || len(r.UserIDs) != 2 || r.UserIDs[0] != 1 || r.UserIDs[1] != 2 {
+		t.Fatalf("incorrect reaction: %#v", r)
+	}
+
+	// duplicate add
+	state.HandleEvent(testSession, &discordgo.MessageReactionAdd{MessageReaction: createTestReaction(1, custom)})
+	if r := getReaction(custom); r == nil || r.Count != 1 {
+		t.Fatalf("incorrect reaction: %#v", r)
+	}
+
+	old := getReaction(star)
+	state.HandleEvent(testSession, &discordgo.MessageReactionRemove{MessageReaction: createTestReaction(1, star)})
+	if r := getReaction(star); r == nil || r.Count != 3 || len(r.UserIDs) != 1 || r.UserIDs[0] != 2 {
+		t.Fatalf("incorrect reaction: %#v", r)
+	}
+
+	if old.Count != 4 || len(old.UserIDs) != 2 {
+		t.Fatal("previous version of the message was modified")
+	}
+
+	state.HandleEvent(testSession, &discordgo.MessageReactionRemove{MessageReaction: createTestReaction(1, custom)})
+	if r := getReaction(custom); r != nil {
+		t.Fatalf("expected reaction to be removed: %#v", r)
+	}
+
+	state.HandleEvent(testSession, &discordgo.MessageReactionRemoveAll{MessageReaction: createTestReaction(0, discordgo.Emoji{})})
+	if m := state.GetMessage(initialTestGuildID, initialTestChannelID, 10000); len(m.Reactions) != 0 {
+		t.Fatalf("reactions not removed: %#v", m.Reactions)
+	}
+}
+
+func TestReactionsNoUsers(t *testing.T) {
+	state := createTestState(TrackerConfig{})
+
+	state.HandleEvent(testSession, &discordgo.MessageCreate{
+		Message: createTestMessage(10000, time.Now()),
+	})
+
+	star := discordgo.Emoji{Name: "⭐"}
+	getReaction := func() *dstate.MessageReactionState {
+		m := state.GetMessage(initialTestGuildID, initialTestChannelID, 10000)
+		return m.FindReaction(&star)
+	}
+
+	for _, v := range []int64{1, 2} {
+		state.HandleEvent(testSession, &discordgo.MessageReactionAdd{MessageReaction: createTestReaction(v, star)})
+	}
+
+	if r := getReaction(); r == nil || r.Count != 2 || len(r.UserIDs) != 0 {
+		t.Fatalf("incorrect reaction: %#v", r)
+	}
+
+	// without tracked users duplicates can't be detected, so they're counted
+	state.HandleEvent(testSession, &discordgo.MessageReactionAdd{MessageReaction: createTestReaction(2, star)})
+	if r := getReaction(); r == nil || r.Count != 3 {
+		t.Fatalf("incorrect reaction: %#v", r)
+	}
+
+	for _, v := range []int64{1, 2, 2} {
+		state.HandleEvent(testSession, &discordgo.MessageReactionRemove{MessageReaction: createTestReaction(v, star)})
+	}
+
+	if r := getReaction(); r != nil {
+		t.Fatalf("expected reaction to be removed: %#v", r)
+	}
+}
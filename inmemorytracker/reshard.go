@@ -0,0 +1,227 @@
+package inmemorytracker
+
+import (
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+// the shards and the total shard count they were created for, this is never modified after being created,
+// Reshard creates a new one instead
+type shardLayout struct {
+	totalShards int64
+	shards      []*ShardTracker
+}
+
+func newShardLayout(conf TrackerConfig, totalShards int64, changes *changeBroker) *shardLayout {
+	shards := make([]*ShardTracker, totalShards)
+	for i := range shards {
+		shards[i] = newShard(conf, i, changes)
+	}
+
+	return &shardLayout{
+		totalShards: totalShards,
+		shards:      shards,
+	}
+}
+
+func (layout *shardLayout) guildShard(guildID int64) *ShardTracker {
+	shardID := int((guildID >> 22) % layout.totalShards)
+	return layout.shards[shardID]
+}
+
+func (tracker *InMemoryTracker) getLayout() *shardLayout {
+	return tracker.layout.Load().(*shardLayout)
+}
+
+var _ dstate.ShardCounter = (*InMemoryTracker)(nil)
+
+// TotalShards returns the current total shard count, see Reshard
+func (tracker *InMemoryTracker) TotalShards() int64 {
+	return tracker.getLayout().totalShards
+}
+
+// returns the shard of the guild with its read lock held
+// if the guild was moved by a concurrent Reshard it tries again with the new shard
+func (tracker *InMemoryTracker) rlockGuildShard(guildID int64) *ShardTracker {
+	for {
+		shard := tracker.getGuildShard(guildID)
+		shard.mu.RLock()
+		if !shard.retired {
+			return shard
+		}
+		shard.mu.RUnlock()
+	}
+}
+
+// same as rlockGuildShard but with the write lock held
+func (tracker *InMemoryTracker) lockGuildShard(guildID int64) *ShardTracker {
+	for {
+		shard := tracker.getGuildShard(guildID)
+		shard.mu.Lock()
+		if !shard.retired {
+			return shard
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// returns the shard with its read lock held, retrying if it was replaced by a concurrent Reshard
+func (tracker *InMemoryTracker) rlockShard(shardID int64) *ShardTracker {
+	for {
+		shard := tracker.getShard(shardID)
+		shard.mu.RLock()
+		if !shard.retired {
+			return shard
+		}
+		shard.mu.RUnlock()
+	}
+}
+
+// same as rlockShard but with the write lock held
+func (tracker *InMemoryTracker) lockShard(shardID int64) *ShardTracker {
+	for {
+		shard := tracker.getShard(shardID)
+		shard.mu.Lock()
+		if !shard.retired {
+			return shard
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// Reshard changes the total shard count of the tracker, moving the guilds along with their members, messages and other state
+// to the shards they belong to under the new count.
+//
+// Reads can continue while resharding, they will block while the state is being moved (this does not copy anything, so it's fairly quick)
+// and then continue on the new shards. Events are held back until it's done.
+// Events from sessions with a different shard count than the tracker's (for example ones that have not been restarted yet) are routed by their guild id,
+// events without one, such as ready, are dropped.
+//
+// The state changes of guilds that are moved are not emitted, as nothing changed.
+//
+// This must not be called from a subscriber (see Subscribe), changes are dispatched while the event is being handled,
+// and Reshard waits for that to finish, so it would deadlock.
+func (tracker *InMemoryTracker) Reshard(totalShards int64) {
+	if totalShards < 1 {
+		panic("inmemorytracker: totalShards has to be at least 1")
+	}
+
+	tracker.reshardMu.Lock()
+	defer tracker.reshardMu.Unlock()
+
+	oldLayout := tracker.getLayout()
+	if oldLayout.totalShards == totalShards {
+		return
+	}
+
+	newLayout := newShardLayout(tracker.conf, totalShards, tracker.changes)
+
+	for _, v := range oldLayout.shards {
+		v.stopGcLoop()
+		v.mu.Lock()
+	}
+
+	// the new shards are not reachable until the layout is stored, so they don't need to be locked
+	for _, v := range oldLayout.shards {
+		v.moveStateLocked(newLayout)
+	}
+
+	tracker.layout.Store(newLayout)
+
+	for _, v := range oldLayout.shards {
+		v.retired = true
+		v.reset()
+		v.membersCompleteWaiters = make(map[int64][]chan struct{})
+		v.mu.Unlock()
+	}
+
+	if tracker.gcInterval > 0 {
+		for _, v := range newLayout.shards {
+			v.startGcLoop(tracker.gcInterval)
+		}
+	}
+}
+
+// moves all the state of the shard into the shards of the layout, the references are moved as is
+// assumes state is locked
+func (shard *ShardTracker) moveStateLocked(layout *shardLayout) {
+	// messages and thread members are keyed by channel, so we need to know the guild of each channel
+	channelGuilds := make(map[int64]int64)
+
+	for guildID, gs := range shard.guilds {
+		dst := layout.guildShard(guildID)
+		dst.guilds[guildID] = gs
+		dst.guildSlots.add(guildID)
+
+		for _, c := range gs.Channels {
+			channelGuilds[c.ID] = guildID
+		}
+
+		for _, t := range gs.Threads {
+			channelGuilds[t.ID] = guildID
+		}
+	}
+
+	for guildID, v := range shard.members {
+		layout.guildShard(guildID).members[guildID] = v
+	}
+
+	for guildID, v := range shard.roleMembers {
+		layout.guildShard(guildID).roleMembers[guildID] = v
+	}
+
+	for guildID, v := range shard.memberNames {
+		layout.guildShard(guildID).memberNames[guildID] = v
+	}
+
+	// the slots are moved and not rebuilt so that IterateMembers can continue where it left off
+	for guildID, v := range shard.memberSlots {
+		layout.guildShard(guildID).memberSlots[guildID] = v
+	}
+
+	for guildID, v := range shard.cachePolicies {
+		layout.guildShard(guildID).cachePolicies[guildID] = v
+	}
+
+	for k, v := range shard.memberChunks {
+		layout.guildShard(k.GuildID).memberChunks[k] = v
+	}
+
+	for guildID, v := range shard.membersComplete {
+		layout.guildShard(guildID).membersComplete[guildID] = v
+	}
+
+	for guildID, v := range shard.membersCompleteWaiters {
+		layout.guildShard(guildID).membersCompleteWaiters[guildID] = v
+	}
+
+	for channelID, v := range shard.messages {
+		guildID, ok := channelGuilds[channelID]
+		if !ok && v.Len() > 0 {
+			guildID, ok = v.at(0).GuildID, true
+		}
+
+		if ok {
+			layout.guildShard(guildID).messages[channelID] = v
+		}
+	}
+
+	for threadID, v := range shard.threadMembers {
+		if guildID, ok := channelGuilds[threadID]; ok {
+			layout.guildShard(guildID).threadMembers[threadID] = v
+		}
+	}
+}
+
+// returns the guild id of a gateway event, false if it does not have one
+func eventGuildID(evt interface{}) (int64, bool) {
+	switch t := evt.(type) {
+	case *discordgo.VoiceStateUpdate:
+		return t.GuildID, true
+	case interface{ GetGuildID() int64 }:
+		guildID := t.GetGuildID()
+		return guildID, guildID != 0
+	}
+
+	return 0, false
+}
@@ -0,0 +1,186 @@
+package inmemorytracker
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+const numReshardTestGuilds = 6
+
+// guild i ends up on shard i % totalShards
+func reshardTestGuildID(i int) int64 {
+	return int64(i)<<22 | 1
+}
+
+func createReshardTestState(totalShards int64) *InMemoryTracker {
+	state := NewInMemoryTracker(TrackerConfig{}, totalShards)
+	session := &discordgo.Session{ShardCount: int(totalShards)}
+
+	for i := 0; i < numReshardTestGuilds; i++ {
+		guildID := reshardTestGuildID(i)
+		session.ShardID = int((guildID >> 22) % totalShards)
+
+		state.HandleEvent(session, &discordgo.GuildCreate{
+			Guild: &discordgo.Guild{
+				ID:          guildID,
+				MemberCount: 1,
+				Members: []*discordgo.Member{
+					createTestMember(0, initialTestMemberID, []int64{initialTestRoleID}),
+				},
+				Channels: []*discordgo.Channel{
+					createTestChannel(0, guildID+initialTestChannelID, nil),
+				},
+				Roles: []*discordgo.Role{
+					{ID: initialTestRoleID},
+				},
+			},
+		})
+
+		msg := createTestMessage(10000, time.Now())
+		msg.GuildID = guildID
+		msg.ChannelID = guildID + initialTestChannelID
+		state.HandleEvent(session, &discordgo.MessageCreate{Message: msg})
+	}
+
+	return state
+}
+
+func assertReshardTestState(t *testing.T, state *InMemoryTracker) {
+	t.Helper()
+
+	totalShards := state.TotalShards()
+
+	for i := 0; i < numReshardTestGuilds; i++ {
+		guildID := reshardTestGuildID(i)
+
+		if gs := state.GetGuild(guildID); gs == nil || len(gs.Channels) != 1 {
+			t.Fatalf("guild %d: incorrect guild: %#v", i, gs)
+		}
+
+		if ms := state.GetMember(guildID, initialTestMemberID); ms == nil || ms.Member == nil {
+			t.Fatalf("guild %d: member missing", i)
+		}
+
+		if msgs := state.GetMessages(guildID, guildID+initialTestChannelID, &dstate.MessagesQuery{}); len(msgs) != 1 {
+			t.Fatalf("guild %d: unexpected messages: %d", i, len(msgs))
+		}
+
+		if members := state.GetRoleMembers(guildID, initialTestRoleID); len(members) != 1 {
+			t.Fatalf("guild %d: unexpected role members: %d", i, len(members))
+		}
+
+		if members := state.SearchMembers(guildID, "test member-1000", MemberSearchExact, 10); len(members) != 1 {
+			t.Fatalf("guild %d: unexpected search results: %d", i, len(members))
+		}
+
+		iterated := 0
+		state.IterateMembers(guildID, func(chunk []*dstate.MemberState) bool {
+			iterated += len(chunk)
+			return true
+		})
+		if iterated != 1 {
+			t.Fatalf("guild %d: unexpected iterated members: %d", i, iterated)
+		}
+
+		found := false
+		for _, v := range state.GetShardGuilds(int64(i) % totalShards) {
+			if v.ID == guildID {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("guild %d: not on shard %d", i, int64(i)%totalShards)
+		}
+	}
+
+	counts := state.GetStateCounts()
+	if counts.Guilds != numReshardTestGuilds || counts.CachedMembers != numReshardTestGuilds || counts.CachedMessages != numReshardTestGuilds {
+		t.Fatalf("unexpected counts: %#v", counts)
+	}
+}
+
+func TestReshard(t *testing.T) {
+	state := createReshardTestState(1)
+	assertReshardTestState(t, state)
+
+	state.Reshard(4)
+	if state.TotalShards() != 4 {
+		t.Fatalf("unexpected total shards: %d", state.TotalShards())
+	}
+	assertReshardTestState(t, state)
+
+	state.Reshard(3)
+	assertReshardTestState(t, state)
+}
+
+func TestReshardOldSession(t *testing.T) {
+	state := createReshardTestState(1)
+	state.Reshard(3)
+
+	// events from sessions that still use the old shard count are routed by guild id
+	oldSession := &discordgo.Session{ShardID: 0, ShardCount: 1}
+	guildID := reshardTestGuildID(2)
+	state.HandleEvent(oldSession, &discordgo.GuildMemberAdd{
+		Member: createTestMember(guildID, 5000, nil),
+	})
+
+	if ms := state.GetMember(guildID, 5000); ms == nil {
+		t.Fatal("member added through old session missing")
+	}
+
+	// and events without a guild id are dropped, a ready would otherwise reset shard 0
+	state.HandleEvent(oldSession, &discordgo.Ready{})
+	if len(state.GetShardGuilds(0)) != 2 {
+		t.Fatalf("shard 0 was reset: %d guilds", len(state.GetShardGuilds(0)))
+	}
+}
+
+func TestReshardConcurrentReads(t *testing.T) {
+	state := createReshardTestState(2)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			guildID := reshardTestGuildID(i)
+			for {
+				if ms := state.GetMember(guildID, initialTestMemberID); ms == nil {
+					t.Errorf("guild %d: member missing during reshard", i)
+					return
+				}
+
+				state.SetMember(&dstate.MemberState{
+					GuildID: guildID,
+					User:    discordgo.User{ID: 5000},
+					Member:  &dstate.MemberFields{},
+				})
+
+				select {
+				case <-stop:
+					return
+				default:
+				}
+			}
+		}(i)
+	}
+
+	for i := int64(1); i < 20; i++ {
+		state.Reshard(i%5 + 1)
+	}
+
+	close(stop)
+	wg.Wait()
+
+	for i := 0; i < 4; i++ {
+		if ms := state.GetMember(reshardTestGuildID(i), 5000); ms == nil {
+			t.Fatalf("guild %d: member set during reshard missing", i)
+		}
+	}
+}
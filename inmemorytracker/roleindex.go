@@ -0,0 +1,87 @@
+package inmemorytracker
+
+import (
+	"github.com/jonas747/dstate/v3"
+)
+
+var _ dstate.RoleMembersTracker = (*InMemoryTracker)(nil)
+
+// GetRoleMembers implements dstate.RoleMembersTracker
+func (tracker *InMemoryTracker) GetRoleMembers(guildID int64, roleID int64) []*dstate.MemberState {
+	shard := tracker.rlockGuildShard(guildID)
+	defer shard.mu.RUnlock()
+
+	memberIDs := shard.roleMembers[guildID][roleID]
+	if len(memberIDs) < 1 {
+		return nil
+	}
+
+	members := shard.members[guildID]
+	result := make([]*dstate.MemberState, 0, len(memberIDs))
+	for id := range memberIDs {
+		if ms, ok := members[id]; ok {
+			result = append(result, &ms.MemberState)
+		}
+	}
+
+	return result
+}
+
+// GetRoleMemberCounts implements dstate.RoleMembersTracker
+func (tracker *InMemoryTracker) GetRoleMemberCounts(guildID int64) map[int64]int {
+	shard := tracker.rlockGuildShard(guildID)
+	defer shard.mu.RUnlock()
+
+	roles := shard.roleMembers[guildID]
+	result := make(map[int64]int, len(roles))
+	for roleID, members := range roles {
+		result[roleID] = len(members)
+	}
+
+	return result
+}
+
+// updates the role index for a member whose roles changed from oldRoles to newRoles
+// assumes state is locked
+func (shard *ShardTracker) indexMemberRolesLocked(guildID int64, memberID int64, oldRoles []int64, newRoles []int64) {
+	for _, v := range oldRoles {
+		if containsInt64(newRoles, v) {
+			continue
+		}
+
+		if members, ok := shard.roleMembers[guildID][v]; ok {
+			delete(members, memberID)
+			if len(members) < 1 {
+				delete(shard.roleMembers[guildID], v)
+			}
+		}
+	}
+
+	if len(newRoles) < 1 {
+		return
+	}
+
+	roles, ok := shard.roleMembers[guildID]
+	if !ok {
+		roles = make(map[int64]map[int64]struct{})
+		shard.roleMembers[guildID] = roles
+	}
+
+	for _, v := range newRoles {
+		members, ok := roles[v]
+		if !ok {
+			members = make(map[int64]struct{})
+			roles[v] = members
+		}
+
+		members[memberID] = struct{}{}
+	}
+}
+
+func memberRoles(wm *WrappedMember) []int64 {
+	if wm == nil || wm.Member == nil {
+		return nil
+	}
+
+	return wm.Member.Roles
+}
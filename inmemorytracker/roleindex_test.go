@@ -0,0 +1,84 @@
+package inmemorytracker
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jonas747/discordgo"
+)
+
+func verifyRoleMembers(t *testing.T, tracker *InMemoryTracker, roleID int64, expected []int64) {
+	t.Helper()
+
+	members := tracker.GetRoleMembers(initialTestGuildID, roleID)
+	ids := make([]int64, 0, len(members))
+	for _, v := range members {
+		ids = append(ids, v.User.ID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	if len(ids) != len(expected) {
+		t.Fatalf("mismatched members of role %d, got: %v, expected: %v", roleID, ids, expected)
+	}
+
+	for i := range ids {
+		if ids[i] != expected[i] {
+			t.Fatalf("mismatched members of role %d, got: %v, expected: %v", roleID, ids, expected)
+		}
+	}
+
+	if count := tracker.GetRoleMemberCounts(initialTestGuildID)[roleID]; count != len(expected) {
+		t.Fatalf("mismatched member count of role %d: %d, expected: %d", roleID, count, len(expected))
+	}
+}
+
+func TestRoleIndex(t *testing.T) {
+	tracker := createTestState(TrackerConfig{
+		RemoveOfflineMembersAfter: time.Hour,
+		ChannelMessageLen:         1,
+	})
+	verifyRoleMembers(t, tracker, initialTestRoleID, []int64{initialTestMemberID})
+
+	tracker.HandleEvent(testSession, &discordgo.GuildMemberAdd{
+		Member: createTestMember(initialTestGuildID, 1001, []int64{initialTestRoleID, 101}),
+	})
+	verifyRoleMembers(t, tracker, initialTestRoleID, []int64{initialTestMemberID, 1001})
+	verifyRoleMembers(t, tracker, 101, []int64{1001})
+
+	// roles changed
+	tracker.HandleEvent(testSession, &discordgo.GuildMemberUpdate{
+		Member: createTestMember(initialTestGuildID, 1001, []int64{102}),
+	})
+	verifyRoleMembers(t, tracker, initialTestRoleID, []int64{initialTestMemberID})
+	verifyRoleMembers(t, tracker, 101, nil)
+	verifyRoleMembers(t, tracker, 102, []int64{1001})
+
+	// presence updates should not affect the roles
+	tracker.HandleEvent(testSession, &discordgo.PresenceUpdate{
+		GuildID:  initialTestGuildID,
+		Presence: discordgo.Presence{User: &discordgo.User{ID: 1001}, Status: discordgo.StatusOnline},
+	})
+	verifyRoleMembers(t, tracker, 102, []int64{1001})
+
+	tracker.HandleEvent(testSession, &discordgo.GuildRoleCreate{GuildRole: &discordgo.GuildRole{
+		GuildID: initialTestGuildID,
+		Role:    &discordgo.Role{ID: 102},
+	}})
+	tracker.HandleEvent(testSession, &discordgo.GuildRoleDelete{GuildID: initialTestGuildID, RoleID: 102})
+	verifyRoleMembers(t, tracker, 102, nil)
+
+	tracker.HandleEvent(testSession, &discordgo.GuildMemberRemove{
+		Member: createTestMember(initialTestGuildID, initialTestMemberID, nil),
+	})
+	verifyRoleMembers(t, tracker, initialTestRoleID, nil)
+
+	// gc'd members should be removed from the index
+	tracker.HandleEvent(testSession, &discordgo.GuildMemberAdd{
+		Member: createTestMember(initialTestGuildID, 1002, []int64{initialTestRoleID}),
+	})
+	verifyRoleMembers(t, tracker, initialTestRoleID, []int64{1002})
+
+	tracker.getShard(0).gcTick(time.Now().Add(time.Hour*2), nil)
+	verifyRoleMembers(t, tracker, initialTestRoleID, nil)
+}
@@ -0,0 +1,256 @@
+package inmemorytracker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jonas747/dstate/v3"
+)
+
+// Snapshot file layout:
+// 4 byte magic, 4 byte big endian version, followed by a gob encoded shardSnapshot
+//
+// The version has to be bumped whenever the snapshotted types change, as gob would otherwise silently leave new fields zeroed.
+// 2: added thread members, along with the fields added to the state types since 1
+const snapshotVersion uint32 = 2
+
+var snapshotMagic = [4]byte{'D', 'S', 'T', 'S'}
+
+var ErrInvalidSnapshot = errors.New("inmemorytracker: not a snapshot file")
+
+type shardSnapshot struct {
+	ShardID   int
+	CreatedAt time.Time
+
+	Guilds        []*dstate.GuildSet
+	Members       []*snapshotMember
+	Messages      []*snapshotChannelMessages
+	ThreadMembers []*dstate.ThreadMember
+}
+
+type snapshotMember struct {
+	LastUpdated time.Time
+	Member      *dstate.MemberState
+}
+
+type snapshotChannelMessages struct {
+	ChannelID int64
+	Messages  []*dstate.MessageState
+}
+
+// WriteShardSnapshot writes a snapshot of the shard's guilds, members and messages to w
+//
+// The shard is only read locked while collecting references, as everything stored is effectively immutable,
+// the actual encoding is done without holding the lock
+func (tracker *InMemoryTracker) WriteShardSnapshot(shardID int64, w io.Writer) error {
+	shard := tracker.rlockShard(shardID)
+	snapshot := shard.snapshotLocked()
+	shard.mu.RUnlock()
+
+	var header [8]byte
+	copy(header[:], snapshotMagic[:])
+	binary.BigEndian.PutUint32(header[4:], snapshotVersion)
+
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+
+	return gob.NewEncoder(w).Encode(snapshot)
+}
+
+// RestoreShardSnapshot resets the shard and loads the snapshot from r into it
+// it's intended to be used when starting up, before the shard has connected to the gateway
+//
+// Guilds in the snapshot that no longer belong to this shard (for example if the total shard count changed) are skipped,
+// and the current cache policies (see TrackerConfig.CachePolicyF) are applied to the restored guilds.
+// Snapshots written by other versions of the package are rejected.
+func (tracker *InMemoryTracker) RestoreShardSnapshot(shardID int64, r io.Reader) error {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return ErrInvalidSnapshot
+		}
+		return err
+	}
+
+	if !bytes.Equal(header[:4], snapshotMagic[:]) {
+		return ErrInvalidSnapshot
+	}
+
+	if v := binary.BigEndian.Uint32(header[4:]); v != snapshotVersion {
+		return fmt.Errorf("inmemorytracker: unsupported snapshot version %d, expected %d", v, snapshotVersion)
+	}
+
+	var snapshot shardSnapshot
+	if err := gob.NewDecoder(r).Decode(&snapshot); err != nil {
+		return err
+	}
+
+	shard := tracker.lockShard(shardID)
+	defer shard.mu.Unlock()
+
+	belongs := func(guildID int64) bool {
+		return tracker.getGuildShard(guildID) == shard
+	}
+
+	shard.restore(&snapshot, belongs)
+	return nil
+}
+
+// SaveShardSnapshot writes a snapshot of the shard to path
+// it's first written to a temporary file in the same directory which is then renamed, to avoid leaving partial snapshots around
+func (tracker *InMemoryTracker) SaveShardSnapshot(shardID int64, path string) error {
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(f)
+	err = tracker.WriteShardSnapshot(shardID, bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// LoadShardSnapshot restores the shard from the snapshot file at path, see RestoreShardSnapshot
+func (tracker *InMemoryTracker) LoadShardSnapshot(shardID int64, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return tracker.RestoreShardSnapshot(shardID, bufio.NewReader(f))
+}
+
+// SnapshotPath returns the path of the snapshot file for a shard inside dir, for use with SaveShardSnapshot and LoadShardSnapshot
+func SnapshotPath(dir string, shardID int64) string {
+	return filepath.Join(dir, fmt.Sprintf("shard-%d.dstate", shardID))
+}
+
+// assumes state is locked
+func (shard *ShardTracker) snapshotLocked() *shardSnapshot {
+	snapshot := &shardSnapshot{
+		ShardID:   shard.shardID,
+		CreatedAt: time.Now(),
+		Guilds:    make([]*dstate.GuildSet, 0, len(shard.guilds)),
+		Messages:  make([]*snapshotChannelMessages, 0, len(shard.messages)),
+	}
+
+	for _, v := range shard.guilds {
+		snapshot.Guilds = append(snapshot.Guilds, v.guildSet())
+	}
+
+	for _, members := range shard.members {
+		for _, v := range members {
+			snapshot.Members = append(snapshot.Members, &snapshotMember{
+				LastUpdated: v.lastUpdated,
+				Member:      &v.MemberState,
+			})
+		}
+	}
+
+	for channelID, messages := range shard.messages {
+		cm := &snapshotChannelMessages{
+			ChannelID: channelID,
+			Messages:  make([]*dstate.MessageState, 0, messages.Len()),
+		}
+
+		for i := 0; i < messages.Len(); i++ {
+			cm.Messages = append(cm.Messages, messages.at(i))
+		}
+
+		snapshot.Messages = append(snapshot.Messages, cm)
+	}
+
+	for _, members := range shard.threadMembers {
+		for _, v := range members {
+			snapshot.ThreadMembers = append(snapshot.ThreadMembers, v)
+		}
+	}
+
+	return snapshot
+}
+
+// assumes state is locked
+func (shard *ShardTracker) restore(snapshot *shardSnapshot, belongs func(guildID int64) bool) {
+	shard.reset()
+
+	for _, v := range snapshot.Guilds {
+		if belongs(v.ID) {
+			shard.guilds[v.ID] = SparseGuildStateFromDstate(v)
+			shard.guildSlots.add(v.ID)
+		}
+	}
+
+	for _, v := range snapshot.Members {
+		if !belongs(v.Member.GuildID) {
+			continue
+		}
+
+		members, ok := shard.members[v.Member.GuildID]
+		if !ok {
+			members = make(map[int64]*WrappedMember)
+			shard.members[v.Member.GuildID] = members
+		}
+
+		wm := &WrappedMember{
+			lastUpdated: v.LastUpdated,
+			MemberState: *v.Member,
+		}
+		members[v.Member.User.ID] = wm
+		shard.indexMemberLocked(wm.GuildID, wm.User.ID, nil, wm)
+	}
+
+	for _, v := range snapshot.Messages {
+		if len(v.Messages) < 1 || !belongs(v.Messages[0].GuildID) {
+			continue
+		}
+
+		cl := newChannelMessages()
+		for _, m := range v.Messages {
+			cl.insert(m)
+		}
+		shard.messages[v.ChannelID] = cl
+	}
+
+	threads := make(map[int64]bool)
+	for _, gs := range shard.guilds {
+		for _, v := range gs.Threads {
+			threads[v.ID] = true
+		}
+	}
+
+	for _, v := range snapshot.ThreadMembers {
+		if threads[v.ID] {
+			shard.setThreadMemberLocked(v)
+		}
+	}
+
+	// the policies might have changed since the snapshot was made
+	// restoring doesn't emit any changes, so neither should removing what's no longer allowed from the restored state
+	pending := len(shard.pendingChanges)
+	for guildID := range shard.guilds {
+		shard.applyCachePolicyLocked(guildID)
+	}
+	shard.pendingChanges = shard.pendingChanges[:pending]
+}
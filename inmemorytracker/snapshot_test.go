@@ -0,0 +1,144 @@
+package inmemorytracker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jonas747/discordgo"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	state := createTestState(TrackerConfig{})
+	state.HandleEvent(testSession, &discordgo.MessageCreate{
+		Message: createTestMessage(10000, time.Date(2021, 5, 20, 10, 0, 0, 0, time.UTC)),
+	})
+	state.HandleEvent(testSession, &discordgo.MessageCreate{
+		Message: createTestMessage(10001, time.Date(2021, 5, 20, 10, 0, 2, 0, time.UTC)),
+	})
+
+	lastUpdated := state.getShard(0).members[initialTestGuildID][initialTestMemberID].lastUpdated
+
+	var buf bytes.Buffer
+	if err := state.WriteShardSnapshot(0, &buf); err != nil {
+		t.Fatal("failed writing snapshot: ", err)
+	}
+
+	restored := NewInMemoryTracker(TrackerConfig{}, 1)
+	if err := restored.RestoreShardSnapshot(0, &buf); err != nil {
+		t.Fatal("failed restoring snapshot: ", err)
+	}
+
+	gs := restored.GetGuild(initialTestGuildID)
+	if gs == nil {
+		t.Fatal("gs is nil")
+	}
+
+	if gs.Name != "test guild" || gs.GetChannel(initialTestChannelID) == nil || gs.GetRole(initialTestRoleID) == nil {
+		t.Fatalf("guild not properly restored: %#v", gs)
+	}
+
+	assertMemberExists(t, restored, initialTestGuildID, initialTestMemberID, true, true)
+	if wm := restored.getShard(0).members[initialTestGuildID][initialTestMemberID]; !wm.lastUpdated.Equal(lastUpdated) {
+		t.Fatalf("lastUpdated not restored: %s, expected %s", wm.lastUpdated, lastUpdated)
+	}
+
+	verifyMessages(t, restored, initialTestChannelID, []int64{10000, 10001})
+}
+
+func TestSnapshotSkipsOtherShards(t *testing.T) {
+	state := createTestState(TrackerConfig{})
+
+	var buf bytes.Buffer
+	if err := state.WriteShardSnapshot(0, &buf); err != nil {
+		t.Fatal("failed writing snapshot: ", err)
+	}
+
+	// the test guild belongs to shard 0, so restoring into shard 1 should skip it
+	restored := NewInMemoryTracker(TrackerConfig{}, 2)
+	if err := restored.RestoreShardSnapshot(1, &buf); err != nil {
+		t.Fatal("failed restoring snapshot: ", err)
+	}
+
+	if restored.GetGuild(initialTestGuildID) != nil {
+		t.Fatal("restored guild into the wrong shard")
+	}
+}
+
+func TestSnapshotInvalid(t *testing.T) {
+	restored := NewInMemoryTracker(TrackerConfig{}, 1)
+
+	err := restored.RestoreShardSnapshot(0, bytes.NewReader([]byte("not a snapshot")))
+	if err != ErrInvalidSnapshot {
+		t.Fatal("expected ErrInvalidSnapshot, got: ", err)
+	}
+
+	err = restored.RestoreShardSnapshot(0, bytes.NewReader([]byte{'D', 'S', 'T', 'S', 0, 0, 0, 99}))
+	if err == nil {
+		t.Fatal("expected error on unsupported version")
+	}
+
+	// snapshots from before the format changed
+	err = restored.RestoreShardSnapshot(0, bytes.NewReader([]byte{'D', 'S', 'T', 'S', 0, 0, 0, 1}))
+	if err == nil {
+		t.Fatal("expected error on old version")
+	}
+}
+
+func TestSnapshotRestoreCachePolicy(t *testing.T) {
+	state := createTestState(TrackerConfig{})
+	state.HandleEvent(testSession, &discordgo.MessageCreate{
+		Message: createTestMessage(10000, time.Now()),
+	})
+
+	var buf bytes.Buffer
+	if err := state.WriteShardSnapshot(0, &buf); err != nil {
+		t.Fatal("failed writing snapshot: ", err)
+	}
+
+	restored := NewInMemoryTracker(TrackerConfig{
+		CachePolicyF: func(guildID int64) *CachePolicy {
+			return &CachePolicy{NoMembers: true, NoPresences: true, NoMessages: true}
+		},
+	}, 1)
+	if err := restored.RestoreShardSnapshot(0, &buf); err != nil {
+		t.Fatal("failed restoring snapshot: ", err)
+	}
+
+	if restored.GetGuild(initialTestGuildID) == nil {
+		t.Fatal("guild not restored")
+	}
+
+	if restored.GetMember(initialTestGuildID, initialTestMemberID) != nil {
+		t.Fatal("member excluded by the cache policy was restored")
+	}
+
+	if restored.GetMessage(initialTestGuildID, initialTestChannelID, 10000) != nil {
+		t.Fatal("message excluded by the cache policy was restored")
+	}
+}
+
+func TestSnapshotFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dstate-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	state := createTestState(TrackerConfig{})
+	path := SnapshotPath(dir, 0)
+	if err := state.SaveShardSnapshot(0, path); err != nil {
+		t.Fatal("failed saving snapshot: ", err)
+	}
+
+	restored := NewInMemoryTracker(TrackerConfig{}, 1)
+	if err := restored.LoadShardSnapshot(0, path); err != nil {
+		t.Fatal("failed loading snapshot: ", err)
+	}
+
+	if restored.GetGuild(initialTestGuildID) == nil {
+		t.Fatal("guild not restored")
+	}
+}
@@ -0,0 +1,172 @@
+package inmemorytracker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+const initialTestThreadID = 20
+
+func createTestThread(id int64, parentID int64, archived bool) *dstate.ThreadChannel {
+	return &dstate.ThreadChannel{
+		Channel: discordgo.Channel{
+			ID:       id,
+			GuildID:  initialTestGuildID,
+			ParentID: parentID,
+			Name:     "test thread",
+			Type:     dstate.ChannelTypeGuildPublicThread,
+		},
+		OwnerID: initialTestMemberID,
+		Metadata: &dstate.ThreadMetadata{
+			Archived:            archived,
+			AutoArchiveDuration: 60,
+		},
+	}
+}
+
+func TestThreadCreateUpdateDelete(t *testing.T) {
+	tracker := createTestState(TrackerConfig{})
+	tracker.HandleEvent(testSession, &dstate.ThreadCreate{ThreadChannel: createTestThread(initialTestThreadID, initialTestChannelID, false)})
+
+	thread := tracker.GetGuild(initialTestGuildID).GetThread(initialTestThreadID)
+	if thread == nil {
+		t.Fatal("thread not found")
+	}
+
+	if !thread.IsThread() || thread.ParentID != initialTestChannelID || thread.OwnerID != initialTestMemberID || thread.ThreadMetadata.Archived {
+		t.Fatalf("incorrect thread: %#v", thread)
+	}
+
+	tracker.HandleEvent(testSession, &dstate.ThreadUpdate{ThreadChannel: createTestThread(initialTestThreadID, initialTestChannelID, true)})
+	thread = tracker.GetGuild(initialTestGuildID).GetThread(initialTestThreadID)
+	if thread == nil || !thread.ThreadMetadata.Archived {
+		t.Fatal("thread not updated")
+	}
+
+	msg := createTestMessage(10000, time.Now())
+	msg.ChannelID = initialTestThreadID
+	tracker.HandleEvent(testSession, &discordgo.MessageCreate{Message: msg})
+
+	messages := tracker.GetMessages(initialTestGuildID, initialTestThreadID, &dstate.MessagesQuery{})
+	if len(messages) != 1 {
+		t.Fatal("thread message not found")
+	}
+
+	tracker.HandleEvent(testSession, &dstate.ThreadDelete{ThreadChannel: createTestThread(initialTestThreadID, initialTestChannelID, true)})
+	if tracker.GetGuild(initialTestGuildID).GetThread(initialTestThreadID) != nil {
+		t.Fatal("thread not deleted")
+	}
+
+	if len(tracker.GetMessages(initialTestGuildID, initialTestThreadID, &dstate.MessagesQuery{})) != 0 {
+		t.Fatal("thread messages not deleted")
+	}
+}
+
+func TestThreadPermissions(t *testing.T) {
+	tracker := createTestState(TrackerConfig{})
+	tracker.HandleEvent(testSession, &discordgo.ChannelUpdate{
+		Channel: createTestChannel(initialTestGuildID, initialTestChannelID, []*discordgo.PermissionOverwrite{
+			{Type: "role", ID: initialTestRoleID, Allow: discordgo.PermissionSendMessages},
+		}),
+	})
+	tracker.HandleEvent(testSession, &dstate.ThreadCreate{ThreadChannel: createTestThread(initialTestThreadID, initialTestChannelID, false)})
+
+	perms, ok := tracker.GetRolePermisisons(initialTestGuildID, initialTestThreadID, 1001, []int64{initialTestRoleID})
+	if !ok {
+		t.Fatal("thread not found when calculating permissions")
+	}
+
+	if perms != discordgo.PermissionSendMessages {
+		t.Fatalf("thread did not inherit parent permissions: %d", perms)
+	}
+
+	gsPerms, err := tracker.GetGuild(initialTestGuildID).GetMemberPermissions(initialTestThreadID, 1001, []int64{initialTestRoleID})
+	if err != nil || gsPerms != perms {
+		t.Fatalf("mismatched guild set permissions: %d, err: %v", gsPerms, err)
+	}
+}
+
+func TestThreadListSync(t *testing.T) {
+	tracker := createTestState(TrackerConfig{})
+	tracker.HandleEvent(testSession, &discordgo.ChannelCreate{Channel: createTestChannel(initialTestGuildID, 11, nil)})
+
+	tracker.HandleEvent(testSession, &dstate.ThreadCreate{ThreadChannel: createTestThread(20, initialTestChannelID, false)})
+	tracker.HandleEvent(testSession, &dstate.ThreadCreate{ThreadChannel: createTestThread(21, initialTestChannelID, true)})
+	tracker.HandleEvent(testSession, &dstate.ThreadCreate{ThreadChannel: createTestThread(22, 11, false)})
+
+	// sync only the initial channel, 20 is no longer active, 21 is archived and 22 is in a different channel
+	tracker.HandleEvent(testSession, &dstate.ThreadListSync{
+		GuildID:    initialTestGuildID,
+		ChannelIDs: []int64{initialTestChannelID},
+		Threads:    []*dstate.ThreadChannel{createTestThread(23, initialTestChannelID, false)},
+		Members: []*dstate.ThreadMember{
+			{ID: 23, UserID: initialTestMemberID},
+		},
+	})
+
+	gs := tracker.GetGuild(initialTestGuildID)
+	for _, v := range []int64{21, 22, 23} {
+		if gs.GetThread(v) == nil {
+			t.Fatalf("thread %d not found", v)
+		}
+	}
+
+	if gs.GetThread(20) != nil {
+		t.Fatal("thread 20 should have been removed")
+	}
+
+	members := tracker.GetThreadMembers(initialTestGuildID, 23)
+	if len(members) != 1 || members[0].UserID != initialTestMemberID {
+		t.Fatalf("incorrect thread members: %#v", members)
+	}
+
+	tracker.HandleEvent(testSession, &dstate.ThreadMembersUpdate{
+		ID:               23,
+		GuildID:          initialTestGuildID,
+		MemberCount:      1,
+		AddedMembers:     []*dstate.ThreadMember{{ID: 23, UserID: 1001}},
+		RemovedMemberIDs: []int64{initialTestMemberID},
+	})
+
+	members = tracker.GetThreadMembers(initialTestGuildID, 23)
+	if len(members) != 1 || members[0].UserID != 1001 {
+		t.Fatalf("incorrect thread members after update: %#v", members)
+	}
+
+	if tracker.GetGuild(initialTestGuildID).GetThread(23).MemberCount != 1 {
+		t.Fatal("member count not updated")
+	}
+
+	// deleting the parent channel should also remove the threads in it
+	tracker.HandleEvent(testSession, &discordgo.ChannelDelete{Channel: createTestChannel(initialTestGuildID, 11, nil)})
+	if tracker.GetGuild(initialTestGuildID).GetThread(22) != nil {
+		t.Fatal("thread not removed along with parent")
+	}
+}
+
+func TestThreadMemberUpdateUnknownThread(t *testing.T) {
+	tracker := createTestState(TrackerConfig{})
+	tracker.HandleEvent(testSession, &dstate.ThreadCreate{ThreadChannel: createTestThread(initialTestThreadID, initialTestChannelID, false)})
+
+	tracker.HandleEvent(testSession, &dstate.ThreadMemberUpdate{
+		GuildID:      initialTestGuildID,
+		ThreadMember: &dstate.ThreadMember{ID: initialTestThreadID, UserID: initialTestMemberID},
+	})
+
+	if members := tracker.GetThreadMembers(initialTestGuildID, initialTestThreadID); len(members) != 1 {
+		t.Fatalf("incorrect thread members: %#v", members)
+	}
+
+	// the thread is not in state, so this should be ignored
+	tracker.HandleEvent(testSession, &dstate.ThreadMemberUpdate{
+		GuildID:      initialTestGuildID,
+		ThreadMember: &dstate.ThreadMember{ID: 99, UserID: initialTestMemberID},
+	})
+
+	if len(tracker.getShard(0).threadMembers) != 1 {
+		t.Fatal("thread member stored for unknown thread")
+	}
+}
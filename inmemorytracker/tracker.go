@@ -1,9 +1,9 @@
 package inmemorytracker
 
 import (
-	"container/list"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jonas747/discordgo"
@@ -16,40 +16,102 @@ type TrackerConfig struct {
 
 	ChannelMessageLimitsF func(guildID int64) (int, time.Duration)
 
+	// Decides what to cache per guild, if nil everything is cached
+	// it's called once per guild with the shard locked, and the result is kept until the guild is removed or RefreshCachePolicy is called
+	CachePolicyF func(guildID int64) *CachePolicy
+
+	// The number of previous versions to keep of edited messages, 0 disables revision tracking
+	// the revisions are removed along with the message, so they're also subject to the above limits
+	MessageRevisions int
+
+	// Overrides MessageRevisions per guild
+	MessageRevisionsF func(guildID int64) int
+
+	// The max number of user ID's to track per reaction on cached messages, 0 to only track the counts
+	// duplicate reaction add events (for example replayed after a resume) are only detected for the tracked users, other duplicates are counted again
+	MessageReactionUsers int
+
+	// The max number of members passed to f in each call by IterateMembers, defaults to DefaultIterateMembersChunkSize
+	IterateMembersChunkSize int
+
+	// The max number of guilds passed to f in each call by IterateGuilds, defaults to DefaultIterateGuildsChunkSize
+	IterateGuildsChunkSize int
+
 	RemoveOfflineMembersAfter time.Duration
 
+	// Keep all the activities of presences instead of only the main one, and the client status of dstate.PresenceUpdate events
+	// see dstate.MemberStateFromPresenceFull and dstate.MemberStateFromGatewayPresenceFull
+	// this uses quite a bit more memory in large guilds
+	FullPresences bool
+
+	// Used by FetchMember to fetch members that are not cached
+	MemberFetcher MemberFetcher
+
+	// How long FetchMember remembers users that were not found, defaults to DefaultMemberNotFoundTTL, negative to disable
+	MemberNotFoundTTL time.Duration
+
 	// Set this to avoid GC'ing ourselves
 	BotMemberID int64
 }
 
 type InMemoryTracker struct {
-	totalShards int64
-	shards      []*ShardTracker
-	// conf   TrackerConfig
+	// holds a *shardLayout, replaced by Reshard
+	layout atomic.Value
+	conf   TrackerConfig
+
+	// held for reading while handling events and for writing while resharding
+	reshardMu  sync.RWMutex
+	gcInterval time.Duration
+
+	changes *changeBroker
+	fetcher *memberFetcher
 }
 
 func NewInMemoryTracker(conf TrackerConfig, totalShards int64) *InMemoryTracker {
-	shards := make([]*ShardTracker, totalShards)
-	for i := range shards {
-		shards[i] = newShard(conf, i)
-	}
+	changes := newChangeBroker()
 
-	return &InMemoryTracker{
-		shards:      shards,
-		totalShards: totalShards,
+	tracker := &InMemoryTracker{
+		conf:    conf,
+		changes: changes,
+		fetcher: newMemberFetcher(conf),
 	}
+	tracker.layout.Store(newShardLayout(conf, totalShards, changes))
+
+	return tracker
 }
 
 func (t *InMemoryTracker) HandleEvent(s *discordgo.Session, evt interface{}) {
-	shard := t.getShard(int64(s.ShardID))
+	t.reshardMu.RLock()
+	defer t.reshardMu.RUnlock()
+
+	layout := t.getLayout()
+	if s.ShardCount > 0 && int64(s.ShardCount) != layout.totalShards {
+		// the session is using a different shard count, most likely from before or after a reshard,
+		// so route the event by its guild id instead, events without one (such as ready) are dropped as they would reset the wrong shard
+		guildID, ok := eventGuildID(evt)
+		if !ok {
+			return
+		}
+
+		layout.guildShard(guildID).HandleEvent(s, evt)
+		return
+	}
+
+	shard := layout.shards[s.ShardID]
 	shard.HandleEvent(s, evt)
 }
 
 // RunGCLoop starts a goroutine per shard that runs a gc on a guild per interval
 // note that this is per shard, so if you have the interval set to 1s and 10 shards, there will effectively be 10 guilds per second gc'd
+//
+// The loops are restarted with the new shards after a Reshard
 func (t *InMemoryTracker) RunGCLoop(interval time.Duration) {
-	for _, v := range t.shards {
-		go v.runGcLoop(interval)
+	t.reshardMu.Lock()
+	defer t.reshardMu.Unlock()
+
+	t.gcInterval = interval
+	for _, v := range t.getLayout().shards {
+		v.startGcLoop(interval)
 	}
 }
 
@@ -62,6 +124,7 @@ type SparseGuildState struct {
 	Roles       []discordgo.Role
 	Emojis      []discordgo.Emoji
 	VoiceStates []discordgo.VoiceState
+	Threads     []dstate.ChannelState
 }
 
 func SparseGuildStateFromDstate(gs *dstate.GuildSet) *SparseGuildState {
@@ -71,6 +134,18 @@ func SparseGuildStateFromDstate(gs *dstate.GuildSet) *SparseGuildState {
 		Roles:       gs.Roles,
 		Emojis:      gs.Emojis,
 		VoiceStates: gs.VoiceStates,
+		Threads:     gs.Threads,
+	}
+}
+
+func (s *SparseGuildState) guildSet() *dstate.GuildSet {
+	return &dstate.GuildSet{
+		GuildState:  *s.Guild,
+		Channels:    s.Channels,
+		Roles:       s.Roles,
+		Emojis:      s.Emojis,
+		VoiceStates: s.VoiceStates,
+		Threads:     s.Threads,
 	}
 }
 
@@ -110,7 +185,17 @@ func (s *SparseGuildState) copyRoles() *SparseGuildState {
 	return &guildSetCopy
 }
 
-// returns a new copy of SparseGuildState and the channels slice
+// returns a new copy of SparseGuildState and the threads slice
+func (s *SparseGuildState) copyThreads() *SparseGuildState {
+	guildSetCopy := *s
+
+	guildSetCopy.Threads = make([]dstate.ChannelState, len(guildSetCopy.Threads))
+	copy(guildSetCopy.Threads, s.Threads)
+
+	return &guildSetCopy
+}
+
+// returns a new copy of SparseGuildState and the voice states slice
 func (s *SparseGuildState) copyVoiceStates() *SparseGuildState {
 	guildSetCopy := *s
 
@@ -130,6 +215,39 @@ func (s *SparseGuildState) channel(id int64) *dstate.ChannelState {
 	return nil
 }
 
+func (s *SparseGuildState) thread(id int64) *dstate.ChannelState {
+	for i := range s.Threads {
+		if s.Threads[i].ID == id {
+			return &s.Threads[i]
+		}
+	}
+
+	return nil
+}
+
+// returns the channel holding the permission overwrites for id, which for threads is the parent channel
+func (s *SparseGuildState) permissionsChannel(id int64) *dstate.ChannelState {
+	if c := s.channel(id); c != nil {
+		return c
+	}
+
+	if thread := s.thread(id); thread != nil {
+		return s.channel(thread.ParentID)
+	}
+
+	return nil
+}
+
+func (s *SparseGuildState) role(id int64) *discordgo.Role {
+	for i := range s.Roles {
+		if s.Roles[i].ID == id {
+			return &s.Roles[i]
+		}
+	}
+
+	return nil
+}
+
 type WrappedMember struct {
 	lastUpdated time.Time
 	dstate.MemberState
@@ -140,23 +258,68 @@ type ShardTracker struct {
 
 	shardID int
 
+	// set once the state has been moved to a new shard by Reshard, the shard is not used after that
+	retired bool
+
+	// closed to stop the gc loop
+	stopGC chan struct{}
+
 	// Key is GuildID
 	guilds  map[int64]*SparseGuildState
 	members map[int64]map[int64]*WrappedMember
 
 	// Key is ChannelID
-	messages map[int64]*list.List
+	messages map[int64]*channelMessages
+
+	// Key is ThreadID, then UserID
+	threadMembers map[int64]map[int64]*dstate.ThreadMember
+
+	// Index of members by role, key is GuildID, then RoleID, then the set of member IDs
+	roleMembers map[int64]map[int64]map[int64]struct{}
+
+	// Index of members by lowercased names, key is GuildID
+	memberNames map[int64]*memberNameIndex
+
+	// Stable positions of the members for chunked iteration, key is GuildID
+	memberSlots map[int64]*idSlots
+
+	// Stable positions of the guilds for chunked iteration
+	guildSlots *idSlots
+
+	// Result of TrackerConfig.CachePolicyF, key is GuildID
+	cachePolicies map[int64]*CachePolicy
+
+	// Member list completeness and in progress member requests
+	memberChunks           map[memberChunksKey]*memberChunksProgress
+	membersComplete        map[int64]bool
+	membersCompleteWaiters map[int64][]chan struct{}
 
 	conf TrackerConfig
+
+	// changes queued up while handling a event, dispatched once the lock is released
+	changes           *changeBroker
+	pendingChanges    []dstate.StateChange
+	hasPendingChanges int32
 }
 
-func newShard(conf TrackerConfig, id int) *ShardTracker {
+func newShard(conf TrackerConfig, id int, changes *changeBroker) *ShardTracker {
 	return &ShardTracker{
-		shardID:  id,
-		guilds:   make(map[int64]*SparseGuildState),
-		members:  make(map[int64]map[int64]*WrappedMember),
-		messages: make(map[int64]*list.List),
-		conf:     conf,
+		shardID:       id,
+		guilds:        make(map[int64]*SparseGuildState),
+		members:       make(map[int64]map[int64]*WrappedMember),
+		messages:      make(map[int64]*channelMessages),
+		threadMembers: make(map[int64]map[int64]*dstate.ThreadMember),
+		roleMembers:   make(map[int64]map[int64]map[int64]struct{}),
+		memberNames:   make(map[int64]*memberNameIndex),
+		memberSlots:   make(map[int64]*idSlots),
+		guildSlots:    newIDSlots(),
+		cachePolicies: make(map[int64]*CachePolicy),
+		conf:          conf,
+		changes:       changes,
+
+		memberChunks:           make(map[memberChunksKey]*memberChunksProgress),
+		membersComplete:        make(map[int64]bool),
+		membersCompleteWaiters: make(map[int64][]chan struct{}),
 	}
 }
 
@@ -178,6 +341,10 @@ func (tracker *ShardTracker) HandleEvent(s *discordgo.Session, i interface{}) {
 		tracker.handleMemberUpdate(evt.Member)
 	case *discordgo.GuildMemberRemove:
 		tracker.handleMemberDelete(evt)
+	case *discordgo.GuildMembersChunk:
+		tracker.handleMembersChunk(evt, nil)
+	case *dstate.GuildMembersChunk:
+		tracker.handleMembersChunk(&evt.GuildMembersChunk, evt.Presences)
 
 	// Channel events
 	case *discordgo.ChannelCreate:
@@ -195,6 +362,20 @@ func (tracker *ShardTracker) HandleEvent(s *discordgo.Session, i interface{}) {
 	case *discordgo.GuildRoleDelete:
 		tracker.handleRoleDelete(evt)
 
+	// Thread events
+	case *dstate.ThreadCreate:
+		tracker.handleThreadCreateUpdate(evt.ThreadChannel)
+	case *dstate.ThreadUpdate:
+		tracker.handleThreadCreateUpdate(evt.ThreadChannel)
+	case *dstate.ThreadDelete:
+		tracker.handleThreadDelete(evt.ThreadChannel)
+	case *dstate.ThreadListSync:
+		tracker.handleThreadListSync(evt)
+	case *dstate.ThreadMemberUpdate:
+		tracker.handleThreadMemberUpdate(evt)
+	case *dstate.ThreadMembersUpdate:
+		tracker.handleThreadMembersUpdate(evt)
+
 	// Message events
 	case *discordgo.MessageCreate:
 		tracker.handleMessageCreate(evt)
@@ -204,10 +385,22 @@ func (tracker *ShardTracker) HandleEvent(s *discordgo.Session, i interface{}) {
 		tracker.handleMessageDelete(evt)
 	case *discordgo.MessageDeleteBulk:
 		tracker.handleMessageDeleteBulk(evt)
+	case *discordgo.MessageReactionAdd:
+		tracker.handleReactionAdd(evt.MessageReaction)
+	case *discordgo.MessageReactionRemove:
+		tracker.handleReactionRemove(evt.MessageReaction)
+	case *discordgo.MessageReactionRemoveAll:
+		tracker.handleReactionRemoveAll(evt.MessageReaction)
 
 	// Other
 	case *discordgo.PresenceUpdate:
-		tracker.handlePresenceUpdate(evt)
+		if evt.User != nil {
+			tracker.handlePresenceUpdate(tracker.presenceMemberState(evt))
+		}
+	case *dstate.PresenceUpdate:
+		if evt.User != nil {
+			tracker.handlePresenceUpdate(tracker.gatewayPresenceMemberState(evt.GuildID, &evt.Presence))
+		}
 	case *discordgo.VoiceStateUpdate:
 		tracker.handleVoiceStateUpdate(evt)
 	case *discordgo.Ready:
@@ -218,6 +411,8 @@ func (tracker *ShardTracker) HandleEvent(s *discordgo.Session, i interface{}) {
 		return
 	}
 
+	tracker.flushChanges()
+
 	// if s.Debug {
 	// 	t := reflect.Indirect(reflect.ValueOf(i)).Type()
 	// 	log.Printf("Handled event %s; %#v", t.Name(), i)
@@ -246,14 +441,22 @@ func (shard *ShardTracker) handleGuildCreate(gc *discordgo.GuildCreate) {
 	}
 	sort.Sort(dstate.Roles(roles))
 
-	emojis := make([]discordgo.Emoji, len(gc.Emojis))
-	for i := range gc.Emojis {
-		emojis[i] = *gc.Emojis[i]
+	policy := shard.cachePolicyLocked(gc.ID)
+
+	var emojis []discordgo.Emoji
+	if !policy.NoEmojis {
+		emojis = make([]discordgo.Emoji, len(gc.Emojis))
+		for i := range gc.Emojis {
+			emojis[i] = *gc.Emojis[i]
+		}
 	}
 
-	voiceStates := make([]discordgo.VoiceState, len(gc.VoiceStates))
-	for i := range gc.VoiceStates {
-		voiceStates[i] = *gc.VoiceStates[i]
+	var voiceStates []discordgo.VoiceState
+	if !policy.NoVoiceStates {
+		voiceStates = make([]discordgo.VoiceState, len(gc.VoiceStates))
+		for i := range gc.VoiceStates {
+			voiceStates[i] = *gc.VoiceStates[i]
+		}
 	}
 
 	guildState := &SparseGuildState{
@@ -264,14 +467,31 @@ func (shard *ShardTracker) handleGuildCreate(gc *discordgo.GuildCreate) {
 		VoiceStates: voiceStates,
 	}
 
+	var oldGuild *dstate.GuildState
+	if existing, ok := shard.guilds[gc.ID]; ok {
+		oldGuild = existing.Guild
+
+		// threads are not included in discordgo's guild create, they're synced through a seperate ThreadListSync
+		guildState.Threads = existing.Threads
+	}
+
 	shard.guilds[gc.ID] = guildState
+	shard.guildSlots.add(gc.ID)
+	if shard.conf.CachePolicyF != nil {
+		// the guild was not in state when the policy was looked up above, so it was not kept
+		shard.cachePolicies[gc.ID] = policy
+	}
+
+	if shard.changes.active() {
+		shard.emit(&dstate.GuildChange{GuildID: gc.ID, Old: oldGuild, New: guildState.Guild})
+	}
 
 	for _, v := range gc.Members {
 		// problem: the presences in guild does not include a full user object
 		// solution: only load presences that also have a corresponding member object
 		for _, p := range gc.Presences {
 			if p.User.ID == v.User.ID {
-				pms := dstate.MemberStateFromPresence(&discordgo.PresenceUpdate{
+				pms := shard.presenceMemberState(&discordgo.PresenceUpdate{
 					Presence: *p,
 					GuildID:  gc.ID,
 				})
@@ -284,6 +504,10 @@ func (shard *ShardTracker) handleGuildCreate(gc *discordgo.GuildCreate) {
 		ms.GuildID = gc.ID
 		shard.innerHandleMemberUpdate(ms)
 	}
+
+	// the full member list is only included for guilds that are not large
+	shard.resetMemberChunksLocked(gc.ID)
+	shard.setMembersCompleteLocked(gc.ID, !gc.Unavailable && !gc.Large && !policy.NoMembers)
 }
 
 func (shard *ShardTracker) handleGuildUpdate(gu *discordgo.GuildUpdate) {
@@ -299,10 +523,17 @@ func (shard *ShardTracker) handleGuildUpdate(gu *discordgo.GuildUpdate) {
 
 		newSparseGuild.Guild = newInnerGuild
 		shard.guilds[gu.ID] = newSparseGuild
+		if shard.changes.active() {
+			shard.emit(&dstate.GuildChange{GuildID: gu.ID, Old: existing.Guild, New: newInnerGuild})
+		}
 	} else {
 		shard.guilds[gu.ID] = &SparseGuildState{
 			Guild: newInnerGuild,
 		}
+		shard.guildSlots.add(gu.ID)
+		if shard.changes.active() {
+			shard.emit(&dstate.GuildChange{GuildID: gu.ID, New: newInnerGuild})
+		}
 	}
 }
 
@@ -317,16 +548,36 @@ func (shard *ShardTracker) handleGuildDelete(gd *discordgo.GuildDelete) {
 			newSparseGuild.Guild.Available = false
 
 			shard.guilds[gd.ID] = newSparseGuild
+			if shard.changes.active() {
+				shard.emit(&dstate.GuildChange{GuildID: gd.ID, Old: existing.Guild, New: newSparseGuild.Guild})
+			}
 		}
 	} else {
 		if existing, ok := shard.guilds[gd.ID]; ok {
 			for _, v := range existing.Channels {
 				delete(shard.messages, v.ID)
 			}
+
+			for _, v := range existing.Threads {
+				delete(shard.messages, v.ID)
+				delete(shard.threadMembers, v.ID)
+			}
+
+			if shard.changes.active() {
+				shard.emit(&dstate.GuildChange{GuildID: gd.ID, Old: existing.Guild})
+			}
 		}
 
 		delete(shard.members, gd.ID)
 		delete(shard.guilds, gd.ID)
+		shard.guildSlots.remove(gd.ID)
+		delete(shard.roleMembers, gd.ID)
+		delete(shard.memberNames, gd.ID)
+		delete(shard.memberSlots, gd.ID)
+		delete(shard.cachePolicies, gd.ID)
+
+		shard.resetMemberChunksLocked(gd.ID)
+		shard.setMembersCompleteLocked(gd.ID, false)
 	}
 }
 
@@ -349,6 +600,9 @@ func (shard *ShardTracker) handleChannelCreateUpdate(c *discordgo.Channel) {
 			newSparseGuild.Channels[i] = dstate.ChannelStateFromDgo(c)
 			sort.Sort(dstate.Channels(newSparseGuild.Channels))
 			shard.guilds[c.GuildID] = newSparseGuild
+			if shard.changes.active() {
+				shard.emit(&dstate.ChannelChange{GuildID: c.GuildID, Old: &gs.Channels[i], New: newSparseGuild.channel(c.ID)})
+			}
 			return
 		}
 	}
@@ -359,6 +613,9 @@ func (shard *ShardTracker) handleChannelCreateUpdate(c *discordgo.Channel) {
 	sort.Sort(dstate.Channels(newSparseGuild.Channels))
 
 	shard.guilds[c.GuildID] = newSparseGuild
+	if shard.changes.active() {
+		shard.emit(&dstate.ChannelChange{GuildID: c.GuildID, New: newSparseGuild.channel(c.ID)})
+	}
 }
 
 func (shard *ShardTracker) handleChannelDelete(c *discordgo.ChannelDelete) {
@@ -377,11 +634,198 @@ func (shard *ShardTracker) handleChannelDelete(c *discordgo.ChannelDelete) {
 			newSparseGuild := gs.copyChannels()
 			newSparseGuild.Channels = append(newSparseGuild.Channels[:i], newSparseGuild.Channels[i+1:]...)
 			shard.guilds[c.GuildID] = newSparseGuild
+			if shard.changes.active() {
+				shard.emit(&dstate.ChannelChange{GuildID: c.GuildID, Old: &gs.Channels[i]})
+			}
+
+			// threads are deleted along with their parent
+			shard.removeThreadsLocked(c.GuildID, func(thread *dstate.ChannelState) bool {
+				return thread.ParentID == c.ID
+			})
 			return
 		}
 	}
 }
 
+///////////////////
+// Thread events
+///////////////////
+
+func (shard *ShardTracker) handleThreadCreateUpdate(t *dstate.ThreadChannel) {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.setThreadLocked(dstate.ChannelStateFromThread(t))
+}
+
+// assumes state is locked
+func (shard *ShardTracker) setThreadLocked(thread dstate.ChannelState) {
+	gs, ok := shard.guilds[thread.GuildID]
+	if !ok {
+		return
+	}
+
+	newSparseGuild := gs.copyThreads()
+	shard.guilds[thread.GuildID] = newSparseGuild
+
+	for i := range newSparseGuild.Threads {
+		if newSparseGuild.Threads[i].ID == thread.ID {
+			newSparseGuild.Threads[i] = thread
+			if shard.changes.active() {
+				shard.emit(&dstate.ChannelChange{GuildID: thread.GuildID, Old: &gs.Threads[i], New: &newSparseGuild.Threads[i]})
+			}
+			return
+		}
+	}
+
+	newSparseGuild.Threads = append(newSparseGuild.Threads, thread)
+	if shard.changes.active() {
+		shard.emit(&dstate.ChannelChange{GuildID: thread.GuildID, New: &newSparseGuild.Threads[len(newSparseGuild.Threads)-1]})
+	}
+}
+
+func (shard *ShardTracker) handleThreadDelete(t *dstate.ThreadChannel) {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.removeThreadsLocked(t.GuildID, func(thread *dstate.ChannelState) bool {
+		return thread.ID == t.ID
+	})
+}
+
+// removes the threads matching f along with their messages and members
+// assumes state is locked
+func (shard *ShardTracker) removeThreadsLocked(guildID int64, f func(thread *dstate.ChannelState) bool) {
+	gs, ok := shard.guilds[guildID]
+	if !ok {
+		return
+	}
+
+	var newSparseGuild *SparseGuildState
+	for i := range gs.Threads {
+		thread := &gs.Threads[i]
+		if !f(thread) {
+			if newSparseGuild != nil {
+				newSparseGuild.Threads = append(newSparseGuild.Threads, *thread)
+			}
+			continue
+		}
+
+		if newSparseGuild == nil {
+			// first removal, copy over the ones we've kept so far
+			newSparseGuild = gs.copyGuildSet()
+			newSparseGuild.Threads = make([]dstate.ChannelState, i, len(gs.Threads))
+			copy(newSparseGuild.Threads, gs.Threads[:i])
+		}
+
+		delete(shard.messages, thread.ID)
+		delete(shard.threadMembers, thread.ID)
+		if shard.changes.active() {
+			shard.emit(&dstate.ChannelChange{GuildID: guildID, Old: thread})
+		}
+	}
+
+	if newSparseGuild != nil {
+		shard.guilds[guildID] = newSparseGuild
+	}
+}
+
+func (shard *ShardTracker) handleThreadListSync(ls *dstate.ThreadListSync) {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	// the event contains all the active threads in the synced channels, so the active ones we have that's not in the event are gone
+	shard.removeThreadsLocked(ls.GuildID, func(thread *dstate.ChannelState) bool {
+		if thread.ThreadMetadata != nil && thread.ThreadMetadata.Archived {
+			return false
+		}
+
+		if len(ls.ChannelIDs) > 0 && !containsInt64(ls.ChannelIDs, thread.ParentID) {
+			return false
+		}
+
+		for _, v := range ls.Threads {
+			if v.ID == thread.ID {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	for _, v := range ls.Threads {
+		thread := dstate.ChannelStateFromThread(v)
+		thread.GuildID = ls.GuildID
+		shard.setThreadLocked(thread)
+	}
+
+	for _, v := range ls.Members {
+		shard.setThreadMemberLocked(v)
+	}
+}
+
+func (shard *ShardTracker) handleThreadMemberUpdate(tm *dstate.ThreadMemberUpdate) {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if tm.ThreadMember == nil {
+		return
+	}
+
+	gs, ok := shard.guilds[tm.GuildID]
+	if !ok || gs.thread(tm.ID) == nil {
+		return
+	}
+
+	shard.setThreadMemberLocked(tm.ThreadMember)
+}
+
+func (shard *ShardTracker) handleThreadMembersUpdate(tm *dstate.ThreadMembersUpdate) {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	gs, ok := shard.guilds[tm.GuildID]
+	if !ok || gs.thread(tm.ID) == nil {
+		return
+	}
+
+	for _, v := range tm.AddedMembers {
+		shard.setThreadMemberLocked(v)
+	}
+
+	if members, ok := shard.threadMembers[tm.ID]; ok {
+		for _, v := range tm.RemovedMemberIDs {
+			delete(members, v)
+		}
+	}
+
+	thread := *gs.thread(tm.ID)
+	thread.MemberCount = tm.MemberCount
+	shard.setThreadLocked(thread)
+}
+
+// assumes state is locked
+func (shard *ShardTracker) setThreadMemberLocked(tm *dstate.ThreadMember) {
+	members, ok := shard.threadMembers[tm.ID]
+	if !ok {
+		members = make(map[int64]*dstate.ThreadMember)
+		shard.threadMembers[tm.ID] = members
+	}
+
+	cop := *tm
+	members[tm.UserID] = &cop
+}
+
+func containsInt64(s []int64, v int64) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+
+	return false
+}
+
 ///////////////////
 // Role events
 ///////////////////
@@ -401,6 +845,9 @@ func (shard *ShardTracker) handleRoleCreateUpdate(guildID int64, r *discordgo.Ro
 			newSparseGuild.Roles[i] = *r
 			sort.Sort(dstate.Roles(newSparseGuild.Roles))
 			shard.guilds[guildID] = newSparseGuild
+			if shard.changes.active() {
+				shard.emit(&dstate.RoleChange{GuildID: guildID, Old: &gs.Roles[i], New: newSparseGuild.role(r.ID)})
+			}
 			return
 		}
 	}
@@ -411,6 +858,9 @@ func (shard *ShardTracker) handleRoleCreateUpdate(guildID int64, r *discordgo.Ro
 	sort.Sort(dstate.Roles(newSparseGuild.Roles))
 
 	shard.guilds[guildID] = newSparseGuild
+	if shard.changes.active() {
+		shard.emit(&dstate.RoleChange{GuildID: guildID, New: newSparseGuild.role(r.ID)})
+	}
 }
 
 func (shard *ShardTracker) handleRoleDelete(r *discordgo.GuildRoleDelete) {
@@ -427,6 +877,13 @@ func (shard *ShardTracker) handleRoleDelete(r *discordgo.GuildRoleDelete) {
 			newSparseGuild := gs.copyRoles()
 			newSparseGuild.Roles = append(newSparseGuild.Roles[:i], newSparseGuild.Roles[i+1:]...)
 			shard.guilds[r.GuildID] = newSparseGuild
+			if shard.changes.active() {
+				shard.emit(&dstate.RoleChange{GuildID: r.GuildID, Old: &gs.Roles[i]})
+			}
+
+			if roles, ok := shard.roleMembers[r.GuildID]; ok {
+				delete(roles, r.RoleID)
+			}
 			return
 		}
 	}
@@ -449,17 +906,37 @@ func (shard *ShardTracker) handleMemberCreate(m *discordgo.GuildMemberAdd) {
 	newSparseGuild.Guild.MemberCount++
 	shard.guilds[m.GuildID] = newSparseGuild
 
-	shard.innerHandleMemberUpdate(dstate.MemberStateFromMember(m.Member))
+	shard.handleMemberUpdateLocked(dstate.MemberStateFromMember(m.Member))
 }
 
 func (shard *ShardTracker) handleMemberUpdate(m *discordgo.Member) {
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
-	shard.innerHandleMemberUpdate(dstate.MemberStateFromMember(m))
+	shard.handleMemberUpdateLocked(dstate.MemberStateFromMember(m))
+}
+
+// same as innerHandleMemberUpdate but also emits the change
+// assumes state is locked
+func (shard *ShardTracker) handleMemberUpdateLocked(ms *dstate.MemberState) {
+	if !shard.shouldCacheMemberLocked(ms) {
+		return
+	}
+
+	if !shard.changes.active() {
+		shard.innerHandleMemberUpdate(ms)
+		return
+	}
+
+	old := shard.getMemberLocked(ms.GuildID, ms.User.ID)
+	shard.innerHandleMemberUpdate(ms)
+	shard.emit(&dstate.MemberChange{GuildID: ms.GuildID, Old: old, New: shard.getMemberLocked(ms.GuildID, ms.User.ID)})
 }
 
 // assumes state is locked
 func (shard *ShardTracker) innerHandleMemberUpdate(ms *dstate.MemberState) {
+	if !shard.shouldCacheMemberLocked(ms) {
+		return
+	}
 
 	wrapped := &WrappedMember{
 		lastUpdated: time.Now(),
@@ -471,15 +948,18 @@ func (shard *ShardTracker) innerHandleMemberUpdate(ms *dstate.MemberState) {
 		// intialize map
 		shard.members[ms.GuildID] = make(map[int64]*WrappedMember)
 		shard.members[ms.GuildID][ms.User.ID] = wrapped
+		shard.indexMemberLocked(ms.GuildID, ms.User.ID, nil, wrapped)
 		return
 	}
 
-	if existing, ok := members[ms.User.ID]; ok {
+	existing, ok := members[ms.User.ID]
+	if ok {
 		// carry over presence
 		wrapped.Presence = existing.Presence
 	}
 
 	members[ms.User.ID] = wrapped
+	shard.indexMemberLocked(ms.GuildID, ms.User.ID, existing, wrapped)
 }
 
 func (shard *ShardTracker) handleMemberDelete(mr *discordgo.GuildMemberRemove) {
@@ -498,10 +978,41 @@ func (shard *ShardTracker) handleMemberDelete(mr *discordgo.GuildMemberRemove) {
 
 	// remove member from state
 	if members, ok := shard.members[mr.GuildID]; ok {
-		delete(members, mr.User.ID)
+		if existing, ok := members[mr.User.ID]; ok {
+			delete(members, mr.User.ID)
+			shard.unindexMemberLocked(existing)
+			if shard.changes.active() {
+				shard.emit(&dstate.MemberChange{GuildID: mr.GuildID, Old: &existing.MemberState})
+			}
+		}
 	}
 }
 
+// updates the member indexes after a member changed from oldMember to newMember, either of which may be nil
+// assumes state is locked
+func (shard *ShardTracker) indexMemberLocked(guildID int64, memberID int64, oldMember *WrappedMember, newMember *WrappedMember) {
+	shard.indexMemberRolesLocked(guildID, memberID, memberRoles(oldMember), memberRoles(newMember))
+	shard.indexMemberNamesLocked(guildID, memberID, oldMember, newMember)
+
+	if oldMember == nil && newMember != nil {
+		shard.addMemberSlotLocked(guildID, memberID)
+	} else if oldMember != nil && newMember == nil {
+		shard.removeMemberSlotLocked(guildID, memberID)
+	}
+}
+
+// assumes state is locked
+func (shard *ShardTracker) shouldCacheMemberLocked(ms *dstate.MemberState) bool {
+	// we always need ourselves for permission calculations
+	return ms.User.ID == shard.conf.BotMemberID || !shard.cachePolicyLocked(ms.GuildID).NoMembers
+}
+
+// removes the member from the indexes
+// assumes state is locked
+func (shard *ShardTracker) unindexMemberLocked(wm *WrappedMember) {
+	shard.indexMemberLocked(wm.GuildID, wm.User.ID, wm, nil)
+}
+
 ///////////////////
 // Message events
 ///////////////////
@@ -510,17 +1021,22 @@ func (shard *ShardTracker) handleMessageCreate(m *discordgo.MessageCreate) {
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
 
-	if m.GuildID == 0 {
+	if m.GuildID == 0 || shard.isChannelExcludedLocked(m.GuildID, m.ChannelID) {
 		return
 	}
 
+	ms := dstate.MessageStateFromDgo(m.Message)
 	if cl, ok := shard.messages[m.ChannelID]; ok {
-		cl.PushBack(dstate.MessageStateFromDgo(m.Message))
+		cl.insert(ms)
 	} else {
-		cl := list.New()
-		cl.PushBack(dstate.MessageStateFromDgo(m.Message))
+		cl := newChannelMessages()
+		cl.insert(ms)
 		shard.messages[m.ChannelID] = cl
 	}
+
+	if shard.changes.active() {
+		shard.emit(&dstate.MessageChange{GuildID: m.GuildID, New: ms})
+	}
 }
 
 func (shard *ShardTracker) handleMessageUpdate(m *discordgo.MessageUpdate) {
@@ -531,52 +1047,64 @@ func (shard *ShardTracker) handleMessageUpdate(m *discordgo.MessageUpdate) {
 		return
 	}
 
-	if cl, ok := shard.messages[m.ChannelID]; ok {
-		for e := cl.Back(); e != nil; e = e.Prev() {
-			// do something with e.Value
-			cast := e.Value.(*dstate.MessageState)
-			if cast.ID == m.ID {
-				// Update the message
-				cop := *cast
-
-				if m.Content != "" {
-					cop.Content = m.Content
-				}
-
-				if m.Mentions != nil {
-					cop.Mentions = make([]discordgo.User, len(m.Mentions))
-					for i, v := range m.Mentions {
-						cop.Mentions[i] = *v
-					}
-				}
-				if m.Embeds != nil {
-					cop.Embeds = make([]discordgo.MessageEmbed, len(m.Embeds))
-					for i, v := range m.Embeds {
-						cop.Embeds[i] = *v
-					}
-				}
-
-				if m.Attachments != nil {
-					cop.Attachments = make([]discordgo.MessageAttachment, len(m.Attachments))
-					for i, v := range m.Attachments {
-						cop.Attachments[i] = *v
-					}
-				}
-
-				if m.Author != nil {
-					cop.Author = *m.Author
-				}
-
-				if m.MentionRoles != nil {
-					cop.MentionRoles = m.MentionRoles
-				}
-
-				e.Value = &cop
-				return
-				// m.parseTimes(msg.Timestamp, msg.EditedTimestamp)
-			}
+	cl, ok := shard.messages[m.ChannelID]
+	if !ok {
+		return
+	}
+
+	i, ok := cl.get(m.ID)
+	if !ok {
+		return
+	}
+
+	cast := cl.at(i)
+
+	// Update the message
+	cop := *cast
+
+	if m.EditedTimestamp != "" {
+		if editedAt, err := m.EditedTimestamp.Parse(); err == nil && !editedAt.Equal(cast.ParsedEditedAt) {
+			cop.ParsedEditedAt = editedAt
+			cop.Revisions = shard.appendRevision(m.GuildID, cast)
+		}
+	}
+
+	if m.Content != "" {
+		cop.Content = m.Content
+	}
+
+	if m.Mentions != nil {
+		cop.Mentions = make([]discordgo.User, len(m.Mentions))
+		for i, v := range m.Mentions {
+			cop.Mentions[i] = *v
 		}
 	}
+	if m.Embeds != nil {
+		cop.Embeds = make([]discordgo.MessageEmbed, len(m.Embeds))
+		for i, v := range m.Embeds {
+			cop.Embeds[i] = *v
+		}
+	}
+
+	if m.Attachments != nil {
+		cop.Attachments = make([]discordgo.MessageAttachment, len(m.Attachments))
+		for i, v := range m.Attachments {
+			cop.Attachments[i] = *v
+		}
+	}
+
+	if m.Author != nil {
+		cop.Author = *m.Author
+	}
+
+	if m.MentionRoles != nil {
+		cop.MentionRoles = m.MentionRoles
+	}
+
+	cl.set(i, &cop)
+	if shard.changes.active() {
+		shard.emit(&dstate.MessageChange{GuildID: m.GuildID, Old: cast, New: &cop})
+	}
 }
 
 func (shard *ShardTracker) handleMessageDelete(m *discordgo.MessageDelete) {
@@ -588,15 +1116,8 @@ func (shard *ShardTracker) handleMessageDelete(m *discordgo.MessageDelete) {
 	}
 
 	if cl, ok := shard.messages[m.ChannelID]; ok {
-		for e := cl.Back(); e != nil; e = e.Prev() {
-			cast := e.Value.(*dstate.MessageState)
-
-			if cast.ID == m.ID {
-				cop := *cast
-				cop.Deleted = true
-				e.Value = &cop
-				return
-			}
+		if i, ok := cl.get(m.ID); ok {
+			shard.markMessageDeletedLocked(m.GuildID, cl, i)
 		}
 	}
 }
@@ -610,37 +1131,66 @@ func (shard *ShardTracker) handleMessageDeleteBulk(m *discordgo.MessageDeleteBul
 	}
 
 	if cl, ok := shard.messages[m.ChannelID]; ok {
-		for e := cl.Back(); e != nil; e = e.Prev() {
-			cast := e.Value.(*dstate.MessageState)
-
-			for _, delID := range m.Messages {
-				if delID == cast.ID {
-					cop := *cast
-					cop.Deleted = true
-					e.Value = &cop
-					break
-				}
+		for _, delID := range m.Messages {
+			if i, ok := cl.get(delID); ok {
+				shard.markMessageDeletedLocked(m.GuildID, cl, i)
 			}
 		}
 	}
 }
 
+// assumes state is locked
+func (shard *ShardTracker) markMessageDeletedLocked(guildID int64, cl *channelMessages, i int) {
+	cast := cl.at(i)
+
+	cop := *cast
+	cop.Deleted = true
+	cl.set(i, &cop)
+	if shard.changes.active() {
+		shard.emit(&dstate.MessageChange{GuildID: guildID, Old: cast, New: &cop})
+	}
+}
+
 ///////////////////
 // MISC events
 ///////////////////
 
-func (shard *ShardTracker) handlePresenceUpdate(p *discordgo.PresenceUpdate) {
+func (shard *ShardTracker) handlePresenceUpdate(ms *dstate.MemberState) {
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
 
-	if p.User == nil {
+	if !shard.changes.active() {
+		shard.innerHandlePresenceUpdate(ms, false)
 		return
 	}
 
-	shard.innerHandlePresenceUpdate(dstate.MemberStateFromPresence(p), false)
+	old := shard.getMemberLocked(ms.GuildID, ms.User.ID)
+	shard.innerHandlePresenceUpdate(ms, false)
+	if updated := shard.getMemberLocked(ms.GuildID, ms.User.ID); updated != old {
+		shard.emit(&dstate.MemberChange{GuildID: ms.GuildID, Old: old, New: updated})
+	}
+}
+
+func (shard *ShardTracker) presenceMemberState(p *discordgo.PresenceUpdate) *dstate.MemberState {
+	if shard.conf.FullPresences {
+		return dstate.MemberStateFromPresenceFull(p)
+	}
+
+	return dstate.MemberStateFromPresence(p)
+}
+
+func (shard *ShardTracker) gatewayPresenceMemberState(guildID int64, p *dstate.Presence) *dstate.MemberState {
+	if shard.conf.FullPresences {
+		return dstate.MemberStateFromGatewayPresenceFull(guildID, p)
+	}
+
+	return dstate.MemberStateFromGatewayPresence(guildID, p)
 }
 
 func (shard *ShardTracker) innerHandlePresenceUpdate(ms *dstate.MemberState, skipFullUserCheck bool) {
+	if shard.cachePolicyLocked(ms.GuildID).NoPresences {
+		return
+	}
 
 	wrapped := &WrappedMember{
 		lastUpdated: time.Now(),
@@ -654,13 +1204,15 @@ func (shard *ShardTracker) innerHandlePresenceUpdate(ms *dstate.MemberState, ski
 			// only add to state if we have the user object
 			shard.members[ms.GuildID] = make(map[int64]*WrappedMember)
 			shard.members[ms.GuildID][ms.User.ID] = wrapped
+			shard.indexMemberLocked(ms.GuildID, ms.User.ID, nil, wrapped)
 		}
 
 		return
 	}
 
 	// carry over the member object
-	if existing, ok := members[ms.User.ID]; ok {
+	existing, ok := members[ms.User.ID]
+	if ok {
 		wrapped.Member = existing.Member
 
 		// also carry over user object if needed
@@ -673,6 +1225,7 @@ func (shard *ShardTracker) innerHandlePresenceUpdate(ms *dstate.MemberState, ski
 	}
 
 	members[ms.User.ID] = wrapped
+	shard.indexMemberLocked(ms.GuildID, ms.User.ID, existing, wrapped)
 }
 
 func (shard *ShardTracker) handleVoiceStateUpdate(p *discordgo.VoiceStateUpdate) {
@@ -680,22 +1233,27 @@ func (shard *ShardTracker) handleVoiceStateUpdate(p *discordgo.VoiceStateUpdate)
 	defer shard.mu.Unlock()
 
 	gs, ok := shard.guilds[p.GuildID]
-	if !ok {
+	if !ok || shard.cachePolicyLocked(p.GuildID).NoVoiceStates {
 		return
 	}
 
 	newGS := gs.copyVoiceStates()
 	for i, v := range newGS.VoiceStates {
 		if v.UserID == p.UserID {
+			var newVS *discordgo.VoiceState
 			if p.ChannelID == 0 {
 				// Left voice chat entirely, remove us
 				newGS.VoiceStates = append(newGS.VoiceStates[:i], newGS.VoiceStates[i+1:]...)
 			} else {
 				// just changed state
 				newGS.VoiceStates[i] = *p.VoiceState
+				newVS = &newGS.VoiceStates[i]
 			}
 
 			shard.guilds[p.GuildID] = newGS
+			if shard.changes.active() {
+				shard.emit(&dstate.VoiceStateChange{GuildID: p.GuildID, Old: &gs.VoiceStates[i], New: newVS})
+			}
 			return
 		}
 	}
@@ -704,6 +1262,9 @@ func (shard *ShardTracker) handleVoiceStateUpdate(p *discordgo.VoiceStateUpdate)
 		// joined a voice channel
 		newGS.VoiceStates = append(newGS.VoiceStates, *p.VoiceState)
 		shard.guilds[p.GuildID] = newGS
+		if shard.changes.active() {
+			shard.emit(&dstate.VoiceStateChange{GuildID: p.GuildID, New: &newGS.VoiceStates[len(newGS.VoiceStates)-1]})
+		}
 	}
 }
 
@@ -717,6 +1278,7 @@ func (shard *ShardTracker) handleReady(p *discordgo.Ready) {
 		shard.guilds[v.ID] = &SparseGuildState{
 			Guild: dstate.GuildStateFromDgo(v),
 		}
+		shard.guildSlots.add(v.ID)
 	}
 }
 
@@ -725,7 +1287,7 @@ func (shard *ShardTracker) handleEmojis(e *discordgo.GuildEmojisUpdate) {
 	defer shard.mu.Unlock()
 
 	gs, ok := shard.guilds[e.GuildID]
-	if !ok {
+	if !ok || shard.cachePolicyLocked(e.GuildID).NoEmojis {
 		return
 	}
 
@@ -736,11 +1298,22 @@ func (shard *ShardTracker) handleEmojis(e *discordgo.GuildEmojisUpdate) {
 	}
 
 	shard.guilds[e.GuildID] = newGS
+	if shard.changes.active() {
+		shard.emit(&dstate.EmojisChange{GuildID: e.GuildID, Old: gs.Emojis, New: newGS.Emojis})
+	}
 }
 
 // assumes state is locked
 func (shard *ShardTracker) reset() {
 	shard.guilds = make(map[int64]*SparseGuildState)
 	shard.members = make(map[int64]map[int64]*WrappedMember)
-	shard.messages = make(map[int64]*list.List)
+	shard.messages = make(map[int64]*channelMessages)
+	shard.threadMembers = make(map[int64]map[int64]*dstate.ThreadMember)
+	shard.roleMembers = make(map[int64]map[int64]map[int64]struct{})
+	shard.memberNames = make(map[int64]*memberNameIndex)
+	shard.memberSlots = make(map[int64]*idSlots)
+	shard.guildSlots = newIDSlots()
+	shard.cachePolicies = make(map[int64]*CachePolicy)
+	shard.memberChunks = make(map[memberChunksKey]*memberChunksProgress)
+	shard.membersComplete = make(map[int64]bool)
 }
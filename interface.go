@@ -44,6 +44,62 @@ type StateTracker interface {
 	IterateMembers(guildID int64, f func(chunk []*MemberState) bool)
 }
 
+// RoleMembersTracker is implemented by trackers that keep a index of members by role
+// note that only cached members are included, and that the @everyone role is not indexed as members don't have it in their roles
+type RoleMembersTracker interface {
+	// GetRoleMembers returns the cached members that has the role
+	GetRoleMembers(guildID int64, roleID int64) []*MemberState
+
+	// GetRoleMemberCounts returns the number of cached members that has each role, key is the role ID
+	GetRoleMemberCounts(guildID int64) map[int64]int
+}
+
+// MemberBatchTracker is implemented by trackers that can look up many members at once,
+// taking the lock only once (or doing a single round trip for remote trackers)
+type MemberBatchTracker interface {
+	// GetMembers returns the members with the provided ids, members[i] is the member for ids[i], or nil if not cached
+	// missing contains the ids that were not found, in the same order as in ids
+	GetMembers(guildID int64, ids []int64) (members []*MemberState, missing []int64)
+}
+
+// GetMembers uses MemberBatchTracker.GetMembers if the tracker implements it, and falls back to calling GetMember for each id otherwise
+func GetMembers(tracker StateTracker, guildID int64, ids []int64) (members []*MemberState, missing []int64) {
+	if bt, ok := tracker.(MemberBatchTracker); ok {
+		return bt.GetMembers(guildID, ids)
+	}
+
+	members = make([]*MemberState, len(ids))
+	for i, id := range ids {
+		members[i] = tracker.GetMember(guildID, id)
+		if members[i] == nil {
+			missing = append(missing, id)
+		}
+	}
+
+	return members, missing
+}
+
+// GuildIterator is implemented by trackers that can walk the guilds across all shards
+type GuildIterator interface {
+	// IterateGuilds calls f with chunks of the guilds matching the query, return true to continue or false to stop
+	// a nil query matches all guilds
+	// like IterateMembers this is blocking and f is never called concurrently
+	IterateGuilds(query *GuildsQuery, f func(chunk []*GuildState) bool)
+
+	// GetStateCounts returns totals across all shards
+	GetStateCounts() *StateCounts
+}
+
+type StateCounts struct {
+	Guilds int
+
+	// The sum of the member counts of the guilds, as opposed to the cached ones
+	Members int64
+
+	CachedMembers  int
+	CachedMessages int
+}
+
 // Relatively cheap, less frequently updated things
 // thinking: should we keep voice states in here? those are more frequently updated but ehhh should we?
 type GuildSet struct {
@@ -53,13 +109,18 @@ type GuildSet struct {
 	Roles       []discordgo.Role
 	Emojis      []discordgo.Emoji
 	VoiceStates []discordgo.VoiceState
+
+	// Both active and archived threads
+	Threads []ChannelState
 }
 
+// GetMemberPermissions returns the permissions of the member in the channel
+// if channelID is a thread then the overwrites of the thread's parent channel is used
 func (gs *GuildSet) GetMemberPermissions(channelID int64, memberID int64, roles []int64) (perms int64, err error) {
 
 	var overwrites []discordgo.PermissionOverwrite
 
-	if channel := gs.GetChannel(channelID); channel != nil {
+	if channel := gs.GetPermissionsChannel(channelID); channel != nil {
 		overwrites = channel.PermissionOverwrites
 	} else if channelID != 0 {
 		// we still continue as far as we can with the calculations even though we can't apply channel permissions
@@ -72,6 +133,23 @@ func (gs *GuildSet) GetMemberPermissions(channelID int64, memberID int64, roles
 	return perms, err
 }
 
+// ExplainMemberPermissions is the same as GetMemberPermissions but returns a breakdown of how the permissions were calculated, see ExplainPermissions
+func (gs *GuildSet) ExplainMemberPermissions(channelID int64, memberID int64, roles []int64) (explanation *PermissionsExplanation, err error) {
+
+	var overwrites []discordgo.PermissionOverwrite
+
+	if channel := gs.GetPermissionsChannel(channelID); channel != nil {
+		overwrites = channel.PermissionOverwrites
+	} else if channelID != 0 {
+		err = &ErrChannelNotFound{
+			ChannelID: channelID,
+		}
+	}
+
+	explanation = ExplainPermissions(&gs.GuildState, gs.Roles, overwrites, memberID, roles)
+	return explanation, err
+}
+
 func (gs *GuildSet) GetChannel(id int64) *ChannelState {
 	for i := range gs.Channels {
 		if gs.Channels[i].ID == id {
@@ -82,6 +160,39 @@ func (gs *GuildSet) GetChannel(id int64) *ChannelState {
 	return nil
 }
 
+func (gs *GuildSet) GetThread(id int64) *ChannelState {
+	for i := range gs.Threads {
+		if gs.Threads[i].ID == id {
+			return &gs.Threads[i]
+		}
+	}
+
+	return nil
+}
+
+// GetChannelOrThread returns the channel or thread with the provided id
+func (gs *GuildSet) GetChannelOrThread(id int64) *ChannelState {
+	if c := gs.GetChannel(id); c != nil {
+		return c
+	}
+
+	return gs.GetThread(id)
+}
+
+// GetPermissionsChannel returns the channel that holds the permission overwrites for id
+// for threads that's the parent channel, and for everything else it's the channel itself
+func (gs *GuildSet) GetPermissionsChannel(id int64) *ChannelState {
+	if c := gs.GetChannel(id); c != nil {
+		return c
+	}
+
+	if thread := gs.GetThread(id); thread != nil {
+		return gs.GetChannel(thread.ParentID)
+	}
+
+	return nil
+}
+
 func (gs *GuildSet) GetRole(id int64) *discordgo.Role {
 	for i := range gs.Roles {
 		if gs.Roles[i].ID == id {
@@ -194,6 +305,16 @@ type ChannelState struct {
 	RateLimitPerUser int                   `json:"rate_limit_per_user"`
 
 	PermissionOverwrites []discordgo.PermissionOverwrite `json:"permission_overwrites"`
+
+	// Thread fields, only set if this is a thread, in which case ParentID is the channel the thread is in
+	OwnerID        int64           `json:"owner_id,string,omitempty"`
+	MemberCount    int             `json:"member_count,omitempty"`
+	MessageCount   int             `json:"message_count,omitempty"`
+	ThreadMetadata *ThreadMetadata `json:"thread_metadata,omitempty"`
+}
+
+func (c *ChannelState) IsThread() bool {
+	return IsThreadType(c.Type)
 }
 
 func (c *ChannelState) IsPrivate() bool {
@@ -236,6 +357,48 @@ type PresenceFields struct {
 	// Acitvity here
 	Game   *LightGame
 	Status PresenceStatus
+
+	// All the activities of the user, this is only set if the tracker is configured to keep full presences
+	// see MemberStateFromPresenceFull and MemberStateFromGatewayPresenceFull
+	Activities []*Activity `json:",omitempty"`
+
+	// The status on each platform, like Activities this is only set if the tracker is configured to keep full presences,
+	// and only for presences from PresenceUpdate as discordgo does not decode it
+	ClientStatus *ClientStatus `json:",omitempty"`
+}
+
+// CustomStatus returns the custom status activity, or nil if there is none or activities are not tracked
+func (p *PresenceFields) CustomStatus() *Activity {
+	for _, v := range p.Activities {
+		if v.Type == ActivityTypeCustom {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// ActivityTypeCustom is the type of custom statuses, where the status text is in Activity.State
+const ActivityTypeCustom discordgo.GameType = 4
+
+// Activity is a full presence activity, it can be decoded from the activities in gateway payloads
+// note that discordgo does not decode the assets and emoji, so they're only set for presences from PresenceUpdate
+type Activity struct {
+	LightGame
+
+	TimeStamps    discordgo.TimeStamps `json:"timestamps,omitempty"`
+	Assets        discordgo.Assets     `json:"assets,omitempty"`
+	ApplicationID string               `json:"application_id,omitempty"`
+
+	// The emoji of custom statuses
+	Emoji *discordgo.Emoji `json:"emoji,omitempty"`
+}
+
+// ClientStatus is the status of a user on each platform, StatusNotSet if they're not active on it
+type ClientStatus struct {
+	Desktop PresenceStatus `json:"desktop,omitempty"`
+	Mobile  PresenceStatus `json:"mobile,omitempty"`
+	Web     PresenceStatus `json:"web,omitempty"`
 }
 
 type LightGame struct {
@@ -306,6 +469,64 @@ type MessageState struct {
 	ParsedEditedAt  time.Time
 
 	Deleted bool
+
+	// Previous versions of the message, oldest first
+	// only tracked if enabled in the state tracker
+	Revisions []MessageRevision
+
+	Reactions []MessageReactionState
+}
+
+// MessageReactionState is a single emoji reacted to a message
+type MessageReactionState struct {
+	Emoji discordgo.Emoji
+
+	// note that duplicate events can only be detected for the users in UserIDs, so this may be too high if users are not tracked
+	Count int
+
+	// The users that added the reaction, oldest first
+	// this is capped by the state tracker and only includes users that reacted while the message was cached, so it's incomplete if it's shorter than Count
+	UserIDs []int64
+}
+
+// FindReaction returns the reaction with the emoji, or nil if there is none
+func (m *MessageState) FindReaction(emoji *discordgo.Emoji) *MessageReactionState {
+	for i := range m.Reactions {
+		if SameEmoji(&m.Reactions[i].Emoji, emoji) {
+			return &m.Reactions[i]
+		}
+	}
+
+	return nil
+}
+
+// SameEmoji returns true if a and b are the same emoji, custom emojis are compared by ID and unicode ones by name
+func SameEmoji(a, b *discordgo.Emoji) bool {
+	if a.ID != 0 || b.ID != 0 {
+		return a.ID == b.ID
+	}
+
+	return a.Name == b.Name
+}
+
+// MessageRevision is a single version of a edited message
+type MessageRevision struct {
+	Content     string
+	Embeds      []discordgo.MessageEmbed
+	Attachments []discordgo.MessageAttachment
+
+	// zero for the original version of the message
+	ParsedEditedAt time.Time
+}
+
+// CurrentRevision returns the current version of the message as a revision
+func (m *MessageState) CurrentRevision() MessageRevision {
+	return MessageRevision{
+		Content:        m.Content,
+		Embeds:         m.Embeds,
+		Attachments:    m.Attachments,
+		ParsedEditedAt: m.ParsedEditedAt,
+	}
 }
 
 func (m *MessageState) ContentWithMentionsReplaced() string {
@@ -370,4 +591,111 @@ type MessagesQuery struct {
 
 	Limit          int
 	IncludeDeleted bool
+
+	// The filters below are applied before the limit, so the limit only counts matching messages
+
+	// Only include messages by this author
+	AuthorID int64
+
+	// Only include messages by authors with this role
+	RoleID int64
+
+	// Only include messages created in this range, either can be zero
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	HasAttachments bool
+	HasEmbeds      bool
+
+	// Only include messages this returns true for
+	// note that this can't be sent to remote trackers, so they have to fetch the messages in pages of Limit and apply it locally,
+	// which can take a lot of requests if few messages match, and without a Limit fetches all the messages in the channel
+	// in the in memory tracker this is called while the shard is read locked, so it must not call back into the tracker
+	Predicate func(m *MessageState) bool `json:"-"`
+}
+
+// Match returns true if the message passes the filters in the query, Before, After and Limit are not checked
+// authorRoles should be the current roles of the author with rolesKnown set to true, otherwise the roles in m.Member are used
+func (q *MessagesQuery) Match(m *MessageState, authorRoles []int64, rolesKnown bool) bool {
+	if !q.IncludeDeleted && m.Deleted {
+		return false
+	}
+
+	if q.AuthorID != 0 && m.Author.ID != q.AuthorID {
+		return false
+	}
+
+	if q.RoleID != 0 {
+		if !rolesKnown && m.Member != nil {
+			authorRoles = m.Member.Roles
+		}
+
+		if !containsID(authorRoles, q.RoleID) {
+			return false
+		}
+	}
+
+	if !q.CreatedAfter.IsZero() && !m.ParsedCreatedAt.After(q.CreatedAfter) {
+		return false
+	}
+
+	if !q.CreatedBefore.IsZero() && !m.ParsedCreatedAt.Before(q.CreatedBefore) {
+		return false
+	}
+
+	if (q.HasAttachments && len(m.Attachments) < 1) || (q.HasEmbeds && len(m.Embeds) < 1) {
+		return false
+	}
+
+	if q.Predicate != nil && !q.Predicate(m) {
+		return false
+	}
+
+	return true
+}
+
+// GuildsQuery filters the guilds in GuildIterator.IterateGuilds, zero values are ignored
+type GuildsQuery struct {
+	OwnerID int64
+
+	// Only include guilds with this feature enabled
+	Feature string
+
+	MinMemberCount int64
+	MaxMemberCount int64
+}
+
+// Match returns true if the guild passes the filters in the query
+func (q *GuildsQuery) Match(g *GuildState) bool {
+	if q == nil {
+		return true
+	}
+
+	if q.OwnerID != 0 && g.OwnerID != q.OwnerID {
+		return false
+	}
+
+	if q.Feature != "" && !containsString(g.Features, q.Feature) {
+		return false
+	}
+
+	if q.MinMemberCount != 0 && g.MemberCount < q.MinMemberCount {
+		return false
+	}
+
+	if q.MaxMemberCount != 0 && g.MemberCount > q.MaxMemberCount {
+		return false
+	}
+
+	return true
+}
+
+func containsString(s []string, v string) bool {
+	for _, sv := range s {
+		if sv == v {
+			return true
+		}
+	}
+
+	return false
 }
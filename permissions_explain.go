@@ -0,0 +1,220 @@
+package dstate
+
+import (
+	"strconv"
+
+	"github.com/jonas747/discordgo"
+)
+
+// PermissionSource is what granted, denied or short circuited a permission
+type PermissionSource int
+
+const (
+	PermissionSourceOwner PermissionSource = iota + 1
+	PermissionSourceAdministrator
+	PermissionSourceEveryoneRole
+	PermissionSourceRole
+	PermissionSourceEveryoneOverwrite
+	PermissionSourceRoleOverwrite
+	PermissionSourceMemberOverwrite
+)
+
+func (p PermissionSource) String() string {
+	switch p {
+	case PermissionSourceOwner:
+		return "owner"
+	case PermissionSourceAdministrator:
+		return "administrator"
+	case PermissionSourceEveryoneRole:
+		return "@everyone role"
+	case PermissionSourceRole:
+		return "role"
+	case PermissionSourceEveryoneOverwrite:
+		return "@everyone overwrite"
+	case PermissionSourceRoleOverwrite:
+		return "role overwrite"
+	case PermissionSourceMemberOverwrite:
+		return "member overwrite"
+	}
+
+	return "unknown (" + strconv.Itoa(int(p)) + ")"
+}
+
+// PermissionStep is a single role or overwrite that affected a permission
+type PermissionStep struct {
+	Source PermissionSource
+
+	// The ID of the role, member or overwrite
+	ID int64
+
+	// true if the permission was granted by this step, false if it was denied
+	Allowed bool
+}
+
+// PermissionTrace explains how the final state of a single permission came to be
+type PermissionTrace struct {
+	Permission int64
+	Allowed    bool
+
+	// The steps in the order they were applied, the last one decides the final state
+	// empty if nothing granted the permission
+	Steps []PermissionStep
+}
+
+type PermissionsExplanation struct {
+	// The final permissions, always the same as what CalculatePermissions returns
+	Perms int64
+
+	// Set if the calculation was short circuited by the member being the owner or having Administrator,
+	// in which case the overwrites were not applied
+	ShortCircuit   PermissionSource
+	ShortCircuitID int64
+
+	// One trace per permission, ordered by the permission bit
+	Traces []PermissionTrace
+}
+
+// Trace returns the trace for a single permission, or nil if it's not a part of the explanation
+func (p *PermissionsExplanation) Trace(permission int64) *PermissionTrace {
+	for i := range p.Traces {
+		if p.Traces[i].Permission == permission {
+			return &p.Traces[i]
+		}
+	}
+
+	return nil
+}
+
+// ExplainPermissions works like CalculatePermissions but also returns a breakdown of what granted or denied each permission
+//
+// A trace is included for all the permissions known to discordgo, as well as any other bits set in the roles or overwrites
+func ExplainPermissions(g *GuildState, guildRoles []discordgo.Role, overwrites []discordgo.PermissionOverwrite, memberID int64, roles []int64) *PermissionsExplanation {
+	explanation := &PermissionsExplanation{
+		Perms: CalculatePermissions(g, guildRoles, overwrites, memberID, roles),
+	}
+
+	relevant := int64(discordgo.PermissionAll)
+	for _, role := range guildRoles {
+		relevant |= int64(role.Permissions)
+	}
+	for _, overwrite := range overwrites {
+		relevant |= int64(overwrite.Allow | overwrite.Deny)
+	}
+
+	if g.OwnerID == memberID {
+		explanation.ShortCircuit = PermissionSourceOwner
+		explanation.ShortCircuitID = memberID
+	} else {
+		for _, role := range guildRoles {
+			if role.Permissions&discordgo.PermissionAdministrator == 0 {
+				continue
+			}
+
+			if role.ID == g.ID || containsID(roles, role.ID) {
+				explanation.ShortCircuit = PermissionSourceAdministrator
+				explanation.ShortCircuitID = role.ID
+				break
+			}
+		}
+	}
+
+	// skip the sign bit, which is only set in AllPermissions
+	for bit := uint(0); bit < 63; bit++ {
+		perm := int64(1) << bit
+		if relevant&perm == 0 {
+			continue
+		}
+
+		trace := PermissionTrace{Permission: perm}
+		if explanation.ShortCircuit != 0 {
+			trace.Steps = []PermissionStep{{Source: explanation.ShortCircuit, ID: explanation.ShortCircuitID, Allowed: true}}
+		} else {
+			trace.Steps = explainPermission(g, guildRoles, overwrites, memberID, roles, perm)
+		}
+
+		trace.Allowed = explanation.Perms&perm == perm
+		explanation.Traces = append(explanation.Traces, trace)
+	}
+
+	return explanation
+}
+
+// explainPermission mirrors the steps in CalculatePermissions for a single permission
+func explainPermission(g *GuildState, guildRoles []discordgo.Role, overwrites []discordgo.PermissionOverwrite, memberID int64, roles []int64, perm int64) []PermissionStep {
+	var steps []PermissionStep
+
+	for _, role := range guildRoles {
+		if role.ID == g.ID {
+			if int64(role.Permissions)&perm == perm {
+				steps = append(steps, PermissionStep{Source: PermissionSourceEveryoneRole, ID: role.ID, Allowed: true})
+			}
+			break
+		}
+	}
+
+	for _, role := range guildRoles {
+		if int64(role.Permissions)&perm == perm && containsID(roles, role.ID) {
+			steps = append(steps, PermissionStep{Source: PermissionSourceRole, ID: role.ID, Allowed: true})
+		}
+	}
+
+	if perm&int64(ChannelPermsMask) == 0 {
+		// overwrites can't change this permission
+		return steps
+	}
+
+	for _, overwrite := range overwrites {
+		if overwrite.ID == g.ID {
+			steps = appendOverwriteSteps(steps, PermissionSourceEveryoneOverwrite, &overwrite, perm)
+			break
+		}
+	}
+
+	// role overwrites are merged, so all the denies are applied before the allows
+	var roleAllows []PermissionStep
+	for _, overwrite := range overwrites {
+		if overwrite.Type != "role" || !containsID(roles, overwrite.ID) {
+			continue
+		}
+
+		if int64(overwrite.Deny)&perm == perm {
+			steps = append(steps, PermissionStep{Source: PermissionSourceRoleOverwrite, ID: overwrite.ID, Allowed: false})
+		}
+
+		if int64(overwrite.Allow)&perm == perm {
+			roleAllows = append(roleAllows, PermissionStep{Source: PermissionSourceRoleOverwrite, ID: overwrite.ID, Allowed: true})
+		}
+	}
+	steps = append(steps, roleAllows...)
+
+	for _, overwrite := range overwrites {
+		if overwrite.Type == "member" && overwrite.ID == memberID {
+			steps = appendOverwriteSteps(steps, PermissionSourceMemberOverwrite, &overwrite, perm)
+			break
+		}
+	}
+
+	return steps
+}
+
+func appendOverwriteSteps(steps []PermissionStep, source PermissionSource, overwrite *discordgo.PermissionOverwrite, perm int64) []PermissionStep {
+	if int64(overwrite.Deny)&perm == perm {
+		steps = append(steps, PermissionStep{Source: source, ID: overwrite.ID, Allowed: false})
+	}
+
+	if int64(overwrite.Allow)&perm == perm {
+		steps = append(steps, PermissionStep{Source: source, ID: overwrite.ID, Allowed: true})
+	}
+
+	return steps
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+
+	return false
+}
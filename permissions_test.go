@@ -108,3 +108,79 @@ func expectPerms(t *testing.T, actual int64, expected int64) {
 		t.Fatalf("incorrect perms, got: %d, expected: %d", actual, expected)
 	}
 }
+
+func verifyExplanation(t *testing.T, gs *GuildState, roles []discordgo.Role, overwrites []discordgo.PermissionOverwrite, memberID int64, memberRoles []int64) *PermissionsExplanation {
+	explanation := ExplainPermissions(gs, roles, overwrites, memberID, memberRoles)
+	expectPerms(t, explanation.Perms, CalculatePermissions(gs, roles, overwrites, memberID, memberRoles))
+
+	for _, trace := range explanation.Traces {
+		lastAllowed := false
+		if len(trace.Steps) > 0 {
+			lastAllowed = trace.Steps[len(trace.Steps)-1].Allowed
+		}
+
+		if lastAllowed != trace.Allowed {
+			t.Fatalf("trace for %d does not match the final result: %#v", trace.Permission, trace)
+		}
+	}
+
+	return explanation
+}
+
+func TestExplainPermissions(t *testing.T) {
+	gs := &GuildState{
+		ID:      1,
+		OwnerID: 50,
+	}
+
+	roles := []discordgo.Role{
+		{ID: 10, Permissions: discordgo.PermissionAdministrator},
+		{ID: 11, Permissions: discordgo.PermissionManageMessages | discordgo.PermissionSendMessages},
+		{ID: 12},
+		{ID: 1, Permissions: discordgo.PermissionSendMessages | discordgo.PermissionReadMessages},
+	}
+
+	overwrites := []discordgo.PermissionOverwrite{
+		{Type: "role", ID: 1, Deny: discordgo.PermissionSendMessages},
+		{Type: "role", ID: 12, Deny: discordgo.PermissionReadMessages},
+		{Type: "role", ID: 11, Allow: discordgo.PermissionSendMessages},
+		{Type: "member", ID: 100, Allow: discordgo.PermissionReadMessages},
+	}
+
+	// owner short circuits
+	explanation := verifyExplanation(t, gs, roles, overwrites, 50, nil)
+	if explanation.ShortCircuit != PermissionSourceOwner {
+		t.Fatal("expected owner short circuit, got: ", explanation.ShortCircuit)
+	}
+
+	// administrator short circuits
+	explanation = verifyExplanation(t, gs, roles, overwrites, 100, []int64{10})
+	if explanation.ShortCircuit != PermissionSourceAdministrator || explanation.ShortCircuitID != 10 {
+		t.Fatal("expected administrator short circuit, got: ", explanation.ShortCircuit)
+	}
+
+	// everyone overwrite denies send messages
+	explanation = verifyExplanation(t, gs, roles, overwrites, 101, nil)
+	trace := explanation.Trace(discordgo.PermissionSendMessages)
+	if trace.Allowed || len(trace.Steps) != 2 || trace.Steps[0].Source != PermissionSourceEveryoneRole || trace.Steps[1].Source != PermissionSourceEveryoneOverwrite {
+		t.Fatalf("incorrect trace: %#v", trace)
+	}
+
+	// role overwrite allow takes precedence over role overwrite deny, and the member overwrite over both
+	explanation = verifyExplanation(t, gs, roles, overwrites, 100, []int64{11, 12})
+	trace = explanation.Trace(discordgo.PermissionSendMessages)
+	if !trace.Allowed || trace.Steps[len(trace.Steps)-1].Source != PermissionSourceRoleOverwrite || trace.Steps[len(trace.Steps)-1].ID != 11 {
+		t.Fatalf("incorrect trace: %#v", trace)
+	}
+
+	trace = explanation.Trace(discordgo.PermissionReadMessages)
+	if !trace.Allowed || trace.Steps[len(trace.Steps)-1].Source != PermissionSourceMemberOverwrite {
+		t.Fatalf("incorrect trace: %#v", trace)
+	}
+
+	// nothing grants ban members
+	trace = explanation.Trace(discordgo.PermissionBanMembers)
+	if trace.Allowed || len(trace.Steps) != 0 {
+		t.Fatalf("incorrect trace: %#v", trace)
+	}
+}
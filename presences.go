@@ -0,0 +1,86 @@
+package dstate
+
+import (
+	"github.com/jonas747/discordgo"
+)
+
+// The types below mirror the presence related gateway payloads, for the parts that discordgo does not decode.
+// Like the thread events they can be decoded from the raw event data and passed to a trackers HandleEvent.
+
+// Presence is a presence as sent in member chunks and presence updates
+type Presence struct {
+	User         *discordgo.User       `json:"user"`
+	Status       discordgo.Status      `json:"status"`
+	Activities   []*Activity           `json:"activities"`
+	ClientStatus *PresenceClientStatus `json:"client_status"`
+}
+
+// PresenceClientStatus is the status of the user on each platform, as sent by discord
+type PresenceClientStatus struct {
+	Desktop discordgo.Status `json:"desktop"`
+	Mobile  discordgo.Status `json:"mobile"`
+	Web     discordgo.Status `json:"web"`
+}
+
+// PresenceUpdate is a discordgo.PresenceUpdate with the client status, and the emojis and assets of the activities
+type PresenceUpdate struct {
+	Presence
+	GuildID int64 `json:"guild_id,string"`
+}
+
+func (p *PresenceUpdate) GetGuildID() int64 {
+	return p.GuildID
+}
+
+// GuildMembersChunk is a discordgo.GuildMembersChunk with the presences included, which are sent if requested with presences set to true
+type GuildMembersChunk struct {
+	discordgo.GuildMembersChunk
+	Presences []*Presence `json:"presences"`
+}
+
+// MemberStateFromGatewayPresence works like MemberStateFromPresence but for presences decoded into Presence
+func MemberStateFromGatewayPresence(guildID int64, p *Presence) *MemberState {
+	var user discordgo.User
+	if p.User != nil {
+		user = *p.User
+	}
+
+	// same as MemberStateFromPresence, the first activity or the streaming one
+	var lg *LightGame
+	for i, v := range p.Activities {
+		if i == 0 || v.Type == 1 {
+			game := v.LightGame
+			lg = &game
+		}
+	}
+
+	return &MemberState{
+		User:    user,
+		GuildID: guildID,
+
+		Member: nil,
+		Presence: &PresenceFields{
+			Game:   lg,
+			Status: PresenceStatusFromDgo(p.Status),
+		},
+	}
+}
+
+// MemberStateFromGatewayPresenceFull works like MemberStateFromGatewayPresence but also keeps all the activities in PresenceFields.Activities,
+// and the status of each platform in PresenceFields.ClientStatus
+func MemberStateFromGatewayPresenceFull(guildID int64, p *Presence) *MemberState {
+	ms := MemberStateFromGatewayPresence(guildID, p)
+	if len(p.Activities) > 0 {
+		ms.Presence.Activities = p.Activities
+	}
+
+	if p.ClientStatus != nil {
+		ms.Presence.ClientStatus = &ClientStatus{
+			Desktop: PresenceStatusFromDgo(p.ClientStatus.Desktop),
+			Mobile:  PresenceStatusFromDgo(p.ClientStatus.Mobile),
+			Web:     PresenceStatusFromDgo(p.ClientStatus.Web),
+		}
+	}
+
+	return ms
+}
@@ -0,0 +1,153 @@
+// Package recorder records gateway events passed to a tracker so they can be replayed later,
+// for example to reproduce state bugs from production or to write regression tests from real traffic.
+package recorder
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jonas747/discordgo"
+)
+
+// Recording file layout:
+// 4 byte magic, 4 byte big endian version, followed by the events
+//
+// Each event is a uvarint length of the rest of the event, followed by
+// uvarint shard id, uvarint shard count, varint unix nano timestamp, uvarint length of the type name, the type name, and the json payload
+const recordingVersion uint32 = 1
+
+var recordingMagic = [4]byte{'D', 'S', 'E', 'R'}
+
+// maxEventLength is the largest event length a recording can have, larger ones are treated as a corrupt recording
+// gateway payloads are a lot smaller than this
+const maxEventLength = 16 << 20
+
+var ErrInvalidRecording = errors.New("recorder: not a recording file")
+
+// EventHandler is implemented by trackers, such as inmemorytracker.InMemoryTracker
+type EventHandler interface {
+	HandleEvent(s *discordgo.Session, evt interface{})
+}
+
+// Recorder is a EventHandler that records the events before passing them on to the wrapped handler
+//
+// Only registered event types are recorded (see RegisterEventType), others are just passed on.
+// Each event is written with a single call to Write, so for anything but files you probably want to wrap the writer in a bufio.Writer,
+// and it can be wrapped in a gzip.Writer to make the recording smaller still.
+type Recorder struct {
+	handler EventHandler
+
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+	err error
+}
+
+var _ EventHandler = (*Recorder)(nil)
+
+// NewRecorder writes the recording header to w and returns a new recorder, handler may be nil to only record the events
+func NewRecorder(w io.Writer, handler EventHandler) (*Recorder, error) {
+	var header [8]byte
+	copy(header[:], recordingMagic[:])
+	binary.BigEndian.PutUint32(header[4:], recordingVersion)
+
+	if _, err := w.Write(header[:]); err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		handler: handler,
+		w:       w,
+	}, nil
+}
+
+// HandleEvent records the event and then passes it on to the wrapped handler
+// errors while recording do not stop the event from being handled, see Err
+func (r *Recorder) HandleEvent(s *discordgo.Session, evt interface{}) {
+	r.Record(s.ShardID, s.ShardCount, time.Now(), evt)
+
+	if r.handler != nil {
+		r.handler.HandleEvent(s, evt)
+	}
+}
+
+// Record writes the event to the recording, events of types that are not registered are ignored
+//
+// If writing fails then the error is returned by this and all following calls, as the recording would be incomplete anyways
+// Events larger than the recording format allows return a error but are skipped without stopping the recording
+func (r *Recorder) Record(shardID int, shardCount int, t time.Time, evt interface{}) error {
+	name, ok := eventTypeName(evt)
+	if !ok {
+		return nil
+	}
+
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		return fmt.Errorf("recorder: failed encoding %s: %v", name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	// the header of the event goes at the front of buf, with space reserved for the length
+	buf := r.buf
+	if cap(buf) < binary.MaxVarintLen64 {
+		buf = make([]byte, 0, 128)
+	}
+	buf = buf[:binary.MaxVarintLen64]
+	buf = appendUvarint(buf, uint64(shardID))
+	buf = appendUvarint(buf, uint64(shardCount))
+	buf = appendVarint(buf, t.UnixNano())
+	buf = appendUvarint(buf, uint64(len(name)))
+	buf = append(buf, name...)
+	buf = append(buf, payload...)
+
+	// put the length right in front of the rest
+	length := len(buf) - binary.MaxVarintLen64
+	if length > maxEventLength {
+		r.buf = buf[:0]
+		return fmt.Errorf("recorder: %s is too large to record (%d bytes)", name, length)
+	}
+
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(length))
+	start := binary.MaxVarintLen64 - n
+	copy(buf[start:], lenBuf[:n])
+
+	r.buf = buf
+	if _, err := r.w.Write(buf[start:]); err != nil {
+		r.err = err
+		return err
+	}
+
+	return nil
+}
+
+// Err returns the error that stopped the recording, if any
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
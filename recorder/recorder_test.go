@@ -0,0 +1,181 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+	"github.com/jonas747/dstate/v3/inmemorytracker"
+)
+
+const testGuildID = 1
+const testChannelID = 10
+
+type unregisteredEvent struct{}
+
+func createTestEvents() []interface{} {
+	ts := time.Date(2021, 5, 20, 10, 0, 0, 0, time.UTC)
+
+	return []interface{}{
+		&discordgo.GuildCreate{
+			Guild: &discordgo.Guild{
+				ID:          testGuildID,
+				Name:        "test guild",
+				MemberCount: 1,
+				Members: []*discordgo.Member{
+					{User: &discordgo.User{ID: 1000, Username: "test member"}, Roles: []int64{100}},
+				},
+				Channels: []*discordgo.Channel{
+					{ID: testChannelID, Name: "test channel", Type: discordgo.ChannelTypeGuildText},
+				},
+				Roles: []*discordgo.Role{{ID: 100, Name: "test role", Permissions: discordgo.PermissionSendMessages}},
+			},
+		},
+		&unregisteredEvent{},
+		&discordgo.GuildMemberAdd{
+			Member: &discordgo.Member{GuildID: testGuildID, User: &discordgo.User{ID: 1001, Username: "another member"}},
+		},
+		&discordgo.MessageCreate{
+			Message: &discordgo.Message{
+				ID:        10000,
+				ChannelID: testChannelID,
+				GuildID:   testGuildID,
+				Content:   "hello",
+				Author:    &discordgo.User{ID: 1000, Username: "test member"},
+				Timestamp: discordgo.Timestamp(ts.Format(time.RFC3339)),
+			},
+		},
+		&discordgo.GuildRoleDelete{GuildID: testGuildID, RoleID: 100},
+		&dstate.ThreadCreate{
+			ThreadChannel: &dstate.ThreadChannel{Channel: discordgo.Channel{ID: 20, GuildID: testGuildID, ParentID: testChannelID, Type: dstate.ChannelTypeGuildPublicThread}},
+		},
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	original := inmemorytracker.NewInMemoryTracker(inmemorytracker.TrackerConfig{}, 1)
+
+	var buf bytes.Buffer
+	rec, err := NewRecorder(&buf, original)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := &discordgo.Session{ShardID: 0, ShardCount: 1}
+	events := createTestEvents()
+	for _, v := range events {
+		rec.HandleEvent(session, v)
+	}
+
+	if rec.Err() != nil {
+		t.Fatal(rec.Err())
+	}
+
+	recording := buf.Bytes()
+
+	// verify the events themselves
+	reader, err := NewReader(bytes.NewReader(recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var read []*Event
+	for {
+		evt, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		read = append(read, evt)
+	}
+
+	if len(read) != len(events)-1 {
+		t.Fatalf("expected %d events, got %d", len(events)-1, len(read))
+	}
+
+	if read[0].Type != "discordgo.GuildCreate" || read[0].ShardCount != 1 || read[0].Time.IsZero() {
+		t.Fatalf("unexpected event: %#v", read[0])
+	}
+
+	if m, ok := read[2].Data.(*discordgo.MessageCreate); !ok || m.Content != "hello" || m.Author.ID != 1000 {
+		t.Fatalf("unexpected event data: %#v", read[2].Data)
+	}
+
+	// replaying into a new tracker should end up with the same state
+	replayed := inmemorytracker.NewInMemoryTracker(inmemorytracker.TrackerConfig{}, 1)
+	n, err := Replay(bytes.NewReader(recording), replayed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != len(read) {
+		t.Fatalf("expected %d events replayed, got %d", len(read), n)
+	}
+
+	if !reflect.DeepEqual(original.GetGuild(testGuildID), replayed.GetGuild(testGuildID)) {
+		t.Fatalf("guilds differ:\n%#v\n%#v", original.GetGuild(testGuildID), replayed.GetGuild(testGuildID))
+	}
+
+	for _, id := range []int64{1000, 1001} {
+		if !reflect.DeepEqual(original.GetMember(testGuildID, id), replayed.GetMember(testGuildID, id)) {
+			t.Fatalf("member %d differs", id)
+		}
+	}
+
+	query := &dstate.MessagesQuery{Limit: 10}
+	if !reflect.DeepEqual(original.GetMessages(testGuildID, testChannelID, query), replayed.GetMessages(testGuildID, testChannelID, query)) {
+		t.Fatal("messages differ")
+	}
+}
+
+func TestInvalidRecording(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("not a recording"))); err != ErrInvalidRecording {
+		t.Fatal("expected ErrInvalidRecording, got: ", err)
+	}
+
+	var buf bytes.Buffer
+	rec, err := NewRecorder(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Record(0, 1, time.Now(), &discordgo.GuildDelete{Guild: &discordgo.Guild{ID: testGuildID}})
+
+	// cut off in the middle of the event
+	truncated := buf.Bytes()[:buf.Len()-5]
+	_, err = Replay(bytes.NewReader(truncated), inmemorytracker.NewInMemoryTracker(inmemorytracker.TrackerConfig{}, 1))
+	if err != io.ErrUnexpectedEOF {
+		t.Fatal("expected io.ErrUnexpectedEOF, got: ", err)
+	}
+
+	// a corrupt event length shouldn't be allocated
+	huge := append(buf.Bytes()[:8:8], 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01)
+	_, err = Replay(bytes.NewReader(huge), inmemorytracker.NewInMemoryTracker(inmemorytracker.TrackerConfig{}, 1))
+	if err != ErrInvalidRecording {
+		t.Fatal("expected ErrInvalidRecording, got: ", err)
+	}
+
+	// neither should one just under the limit on a recording that ends right after it
+	short := make([]byte, 8, 8+binary.MaxVarintLen64+100)
+	copy(short, buf.Bytes()[:8])
+	short = short[:8+binary.PutUvarint(short[8:8+binary.MaxVarintLen64], maxEventLength-1)]
+	short = append(short, make([]byte, 100)...)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err = Replay(bytes.NewReader(short), inmemorytracker.NewInMemoryTracker(inmemorytracker.TrackerConfig{}, 1))
+	runtime.ReadMemStats(&after)
+	if err != io.ErrUnexpectedEOF && err != ErrInvalidRecording {
+		t.Fatal("expected io.ErrUnexpectedEOF or ErrInvalidRecording, got: ", err)
+	}
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > maxEventLength/2 {
+		t.Fatalf("allocated %d bytes for a short recording", allocated)
+	}
+}
@@ -0,0 +1,95 @@
+package recorder
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+)
+
+var (
+	registryMu   sync.RWMutex
+	constructors = make(map[string]func() interface{})
+	typeNames    = make(map[reflect.Type]string)
+)
+
+// RegisterEventType registers a event type so that it can be recorded and replayed
+// name is what's written to recordings, so it should not change, and constructor should return a new pointer to the event type
+//
+// The events handled by inmemorytracker are registered by default, under names like "discordgo.GuildCreate" and "dstate.ThreadCreate"
+func RegisterEventType(name string, constructor func() interface{}) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	constructors[name] = constructor
+	typeNames[reflect.TypeOf(constructor())] = name
+}
+
+func eventTypeName(evt interface{}) (string, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	name, ok := typeNames[reflect.TypeOf(evt)]
+	return name, ok
+}
+
+func newEvent(name string) (interface{}, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	constructor, ok := constructors[name]
+	if !ok {
+		return nil, false
+	}
+
+	return constructor(), true
+}
+
+func init() {
+	// Guild events
+	RegisterEventType("discordgo.GuildCreate", func() interface{} { return &discordgo.GuildCreate{} })
+	RegisterEventType("discordgo.GuildUpdate", func() interface{} { return &discordgo.GuildUpdate{} })
+	RegisterEventType("discordgo.GuildDelete", func() interface{} { return &discordgo.GuildDelete{} })
+	RegisterEventType("discordgo.GuildEmojisUpdate", func() interface{} { return &discordgo.GuildEmojisUpdate{} })
+
+	// Member events
+	RegisterEventType("discordgo.GuildMemberAdd", func() interface{} { return &discordgo.GuildMemberAdd{} })
+	RegisterEventType("discordgo.GuildMemberUpdate", func() interface{} { return &discordgo.GuildMemberUpdate{} })
+	RegisterEventType("discordgo.GuildMemberRemove", func() interface{} { return &discordgo.GuildMemberRemove{} })
+	RegisterEventType("discordgo.GuildMembersChunk", func() interface{} { return &discordgo.GuildMembersChunk{} })
+	RegisterEventType("dstate.GuildMembersChunk", func() interface{} { return &dstate.GuildMembersChunk{} })
+	RegisterEventType("dstate.PresenceUpdate", func() interface{} { return &dstate.PresenceUpdate{} })
+
+	// Channel events
+	RegisterEventType("discordgo.ChannelCreate", func() interface{} { return &discordgo.ChannelCreate{} })
+	RegisterEventType("discordgo.ChannelUpdate", func() interface{} { return &discordgo.ChannelUpdate{} })
+	RegisterEventType("discordgo.ChannelDelete", func() interface{} { return &discordgo.ChannelDelete{} })
+
+	// Role events
+	RegisterEventType("discordgo.GuildRoleCreate", func() interface{} { return &discordgo.GuildRoleCreate{} })
+	RegisterEventType("discordgo.GuildRoleUpdate", func() interface{} { return &discordgo.GuildRoleUpdate{} })
+	RegisterEventType("discordgo.GuildRoleDelete", func() interface{} { return &discordgo.GuildRoleDelete{} })
+
+	// Thread events
+	RegisterEventType("dstate.ThreadCreate", func() interface{} { return &dstate.ThreadCreate{} })
+	RegisterEventType("dstate.ThreadUpdate", func() interface{} { return &dstate.ThreadUpdate{} })
+	RegisterEventType("dstate.ThreadDelete", func() interface{} { return &dstate.ThreadDelete{} })
+	RegisterEventType("dstate.ThreadListSync", func() interface{} { return &dstate.ThreadListSync{} })
+	RegisterEventType("dstate.ThreadMemberUpdate", func() interface{} { return &dstate.ThreadMemberUpdate{} })
+	RegisterEventType("dstate.ThreadMembersUpdate", func() interface{} { return &dstate.ThreadMembersUpdate{} })
+
+	// Message events
+	RegisterEventType("discordgo.MessageCreate", func() interface{} { return &discordgo.MessageCreate{} })
+	RegisterEventType("discordgo.MessageUpdate", func() interface{} { return &discordgo.MessageUpdate{} })
+	RegisterEventType("discordgo.MessageDelete", func() interface{} { return &discordgo.MessageDelete{} })
+	RegisterEventType("discordgo.MessageDeleteBulk", func() interface{} { return &discordgo.MessageDeleteBulk{} })
+	RegisterEventType("discordgo.MessageReactionAdd", func() interface{} { return &discordgo.MessageReactionAdd{} })
+	RegisterEventType("discordgo.MessageReactionRemove", func() interface{} { return &discordgo.MessageReactionRemove{} })
+	RegisterEventType("discordgo.MessageReactionRemoveAll", func() interface{} { return &discordgo.MessageReactionRemoveAll{} })
+
+	// Misc events
+	RegisterEventType("discordgo.PresenceUpdate", func() interface{} { return &discordgo.PresenceUpdate{} })
+	RegisterEventType("discordgo.VoiceStateUpdate", func() interface{} { return &discordgo.VoiceStateUpdate{} })
+	RegisterEventType("discordgo.Ready", func() interface{} { return &discordgo.Ready{} })
+}
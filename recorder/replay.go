@@ -0,0 +1,188 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jonas747/discordgo"
+)
+
+// Event is a recorded event
+type Event struct {
+	Time       time.Time
+	ShardID    int
+	ShardCount int
+
+	// The name the type was registered with
+	Type string
+
+	// The decoded event, a pointer to the registered type
+	Data interface{}
+}
+
+// Reader reads events from a recording
+type Reader struct {
+	r   *bufio.Reader
+	buf bytes.Buffer
+}
+
+// NewReader reads the recording header from r and returns a reader for the events
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+
+	var header [8]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return nil, ErrInvalidRecording
+		}
+		return nil, err
+	}
+
+	if !bytes.Equal(header[:4], recordingMagic[:]) {
+		return nil, ErrInvalidRecording
+	}
+
+	if v := binary.BigEndian.Uint32(header[4:]); v != recordingVersion {
+		return nil, fmt.Errorf("recorder: unsupported recording version %d, expected %d", v, recordingVersion)
+	}
+
+	return &Reader{r: br}, nil
+}
+
+// Next returns the next event in the recording, or io.EOF if there are no more
+// a recording that was cut off in the middle of a event returns io.ErrUnexpectedEOF, and one with a corrupt event length ErrInvalidRecording
+func (r *Reader) Next() (*Event, error) {
+	length, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+
+	if length > maxEventLength {
+		return nil, ErrInvalidRecording
+	}
+
+	// the buffer grows with the data that's actually read, so a corrupt length in a short recording doesn't allocate all of it
+	r.buf.Reset()
+	if _, err := io.CopyN(&r.buf, r.r, int64(length)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	buf := r.buf.Bytes()
+
+	d := decoder{buf: buf}
+	shardID := d.uvarint()
+	shardCount := d.uvarint()
+	ts := d.varint()
+	name := string(d.bytes(int(d.uvarint())))
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	data, ok := newEvent(name)
+	if !ok {
+		return nil, fmt.Errorf("recorder: unknown event type %q, it has to be registered with RegisterEventType", name)
+	}
+
+	if err := json.Unmarshal(d.buf, data); err != nil {
+		return nil, fmt.Errorf("recorder: failed decoding %s: %v", name, err)
+	}
+
+	return &Event{
+		Time:       time.Unix(0, ts),
+		ShardID:    int(shardID),
+		ShardCount: int(shardCount),
+		Type:       name,
+		Data:       data,
+	}, nil
+}
+
+// Replay reads all the events in the recording from r and passes them to handler, in the same order they were recorded
+// returns the number of events replayed
+func Replay(r io.Reader, handler EventHandler) (int, error) {
+	reader, err := NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+
+	// reuse the sessions, as some handlers might compare them
+	sessions := make(map[[2]int]*discordgo.Session)
+
+	n := 0
+	for {
+		evt, err := reader.Next()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+
+		key := [2]int{evt.ShardID, evt.ShardCount}
+		session, ok := sessions[key]
+		if !ok {
+			session = &discordgo.Session{ShardID: evt.ShardID, ShardCount: evt.ShardCount}
+			sessions[key] = session
+		}
+
+		handler.HandleEvent(session, evt.Data)
+		n++
+	}
+}
+
+// decoder reads the header fields of a event, the remaining buf is the payload
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = ErrInvalidRecording
+		return 0
+	}
+
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = ErrInvalidRecording
+		return 0
+	}
+
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if n > len(d.buf) {
+		d.err = ErrInvalidRecording
+		return nil
+	}
+
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
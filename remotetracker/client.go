@@ -0,0 +1,390 @@
+package remotetracker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jonas747/dstate/v3"
+)
+
+var _ dstate.StateTracker = (*Client)(nil)
+var _ dstate.GuildIterator = (*Client)(nil)
+var _ dstate.MemberBatchTracker = (*Client)(nil)
+
+// Client is a dstate.StateTracker that queries a remote Server
+//
+// Since the StateTracker interface has no way of returning errors, failed requests are treated as a miss
+// and the error is passed to ErrorHandler if set
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	// Called with any error that occurs during a request
+	ErrorHandler func(err error)
+}
+
+// NewClient returns a new client for the server at baseURL (e.g "http://127.0.0.1:7447")
+// if httpClient is nil then http.DefaultClient is used
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// NewUnixSocketClient returns a new client for a server listening on the unix socket at socketPath
+func NewUnixSocketClient(socketPath string) *Client {
+	dialer := &net.Dialer{}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+
+	return NewClient("http://unix", &http.Client{Transport: transport})
+}
+
+func (c *Client) GetGuild(guildID int64) *dstate.GuildSet {
+	gs, err := c.WithContext().GetGuild(context.Background(), guildID)
+	c.handleErr(err)
+	return gs
+}
+
+func (c *Client) GetShardGuilds(shardID int64) []*dstate.GuildSet {
+	guilds, err := c.WithContext().GetShardGuilds(context.Background(), shardID)
+	c.handleErr(err)
+	return guilds
+}
+
+func (c *Client) GetMember(guildID int64, memberID int64) *dstate.MemberState {
+	ms, err := c.WithContext().GetMember(context.Background(), guildID, memberID)
+	c.handleErr(err)
+	return ms
+}
+
+// GetMembers implements dstate.MemberBatchTracker, looking up all the members in a single request
+// on errors all the ids are returned as missing
+func (c *Client) GetMembers(guildID int64, ids []int64) ([]*dstate.MemberState, []int64) {
+	members, missing, err := c.WithContext().GetMembers(context.Background(), guildID, ids)
+	c.handleErr(err)
+	return members, missing
+}
+
+func (c *Client) GetMessages(guildID int64, channelID int64, query *dstate.MessagesQuery) []*dstate.MessageState {
+	messages, err := c.WithContext().GetMessages(context.Background(), guildID, channelID, query)
+	c.handleErr(err)
+	return messages
+}
+
+// IterateMembers streams the members from the server, calling f once per chunk received
+// returning false from f closes the connection which stops the iteration on the server as well
+func (c *Client) IterateMembers(guildID int64, f func(chunk []*dstate.MemberState) bool) {
+	c.handleErr(c.WithContext().IterateMembers(context.Background(), guildID, f))
+}
+
+// WithContext returns a dstate.ContextStateTracker using this client, which returns errors instead of passing them to ErrorHandler
+func (c *Client) WithContext() *ContextClient {
+	return &ContextClient{client: c}
+}
+
+var _ dstate.ContextStateTracker = (*ContextClient)(nil)
+
+// ContextClient is a dstate.ContextStateTracker that queries a remote Server, see Client.WithContext
+type ContextClient struct {
+	client *Client
+}
+
+func (c *ContextClient) GetGuild(ctx context.Context, guildID int64) (*dstate.GuildSet, error) {
+	var gs *dstate.GuildSet
+	err := c.client.getJSON(ctx, pathGuild, url.Values{
+		"guild_id": {strconv.FormatInt(guildID, 10)},
+	}, &gs)
+
+	if err != nil {
+		return nil, missErr(err, guildID, 0)
+	}
+
+	return gs, nil
+}
+
+func (c *ContextClient) GetShardGuilds(ctx context.Context, shardID int64) ([]*dstate.GuildSet, error) {
+	var guilds []*dstate.GuildSet
+	err := c.client.getJSON(ctx, pathShardGuilds, url.Values{
+		"shard_id": {strconv.FormatInt(shardID, 10)},
+	}, &guilds)
+
+	if err != nil {
+		if _, ok := err.(*errNotFound); ok {
+			return nil, &dstate.ErrShardNotFound{ShardID: shardID}
+		}
+		return nil, err
+	}
+
+	return guilds, nil
+}
+
+func (c *ContextClient) GetMember(ctx context.Context, guildID int64, memberID int64) (*dstate.MemberState, error) {
+	var ms *dstate.MemberState
+	err := c.client.getJSON(ctx, pathMember, url.Values{
+		"guild_id":  {strconv.FormatInt(guildID, 10)},
+		"member_id": {strconv.FormatInt(memberID, 10)},
+	}, &ms)
+
+	if err != nil {
+		return nil, missErr(err, guildID, memberID)
+	}
+
+	return ms, nil
+}
+
+// GetMembers works like Client.GetMembers, but returns the error instead of passing it to ErrorHandler
+// members not found are reported through missing and not as a error, even if the guild is not in the state
+func (c *ContextClient) GetMembers(ctx context.Context, guildID int64, ids []int64) (members []*dstate.MemberState, missing []int64, err error) {
+	err = c.client.getJSON(ctx, pathMembers, url.Values{
+		"guild_id":   {strconv.FormatInt(guildID, 10)},
+		"member_ids": {encodeIDs(ids)},
+	}, &members)
+
+	if err == nil && len(members) != len(ids) {
+		err = fmt.Errorf("remotetracker: got %d members for %d ids", len(members), len(ids))
+	}
+
+	if err != nil {
+		return make([]*dstate.MemberState, len(ids)), ids, err
+	}
+
+	for i, ms := range members {
+		if ms == nil {
+			missing = append(missing, ids[i])
+		}
+	}
+
+	return members, missing, nil
+}
+
+func (c *ContextClient) GetMessages(ctx context.Context, guildID int64, channelID int64, query *dstate.MessagesQuery) ([]*dstate.MessageState, error) {
+	if query == nil {
+		query = &dstate.MessagesQuery{}
+	}
+
+	params := url.Values{
+		"guild_id":   {strconv.FormatInt(guildID, 10)},
+		"channel_id": {strconv.FormatInt(channelID, 10)},
+	}
+	encodeMessagesQuery(params, query)
+
+	// decoding into a slice reuses its backing array, but it would also decode into the existing elements
+	// which we don't own, so clear them out first
+	buf := query.Buf[:cap(query.Buf)]
+	for i := range buf {
+		buf[i] = nil
+	}
+	buf = buf[:0]
+
+	if query.Predicate != nil {
+		return c.getMessagesPredicate(ctx, guildID, params, query, buf)
+	}
+
+	err := c.client.getJSON(ctx, pathMessages, params, &buf)
+	if err != nil {
+		return nil, missErr(err, guildID, 0)
+	}
+
+	return buf, nil
+}
+
+// the predicate can't be sent to the server, so the messages matching the rest of the query are fetched in pages of query.Limit
+// and filtered here until there's enough of them, without a limit that means fetching all of them at once
+func (c *ContextClient) getMessagesPredicate(ctx context.Context, guildID int64, params url.Values, query *dstate.MessagesQuery, buf []*dstate.MessageState) ([]*dstate.MessageState, error) {
+	for {
+		var page []*dstate.MessageState
+		err := c.client.getJSON(ctx, pathMessages, params, &page)
+		if err != nil {
+			return nil, missErr(err, guildID, 0)
+		}
+
+		for _, v := range page {
+			if !query.Predicate(v) {
+				continue
+			}
+
+			buf = append(buf, v)
+			if query.Limit > 0 && len(buf) >= query.Limit {
+				return buf, nil
+			}
+		}
+
+		if query.Limit < 1 || len(page) < query.Limit {
+			return buf, nil
+		}
+
+		// the messages are newest first, so continue before the oldest one
+		params.Set("before", strconv.FormatInt(page[len(page)-1].ID, 10))
+	}
+}
+
+// IterateMembers streams the members from the server, calling f once per chunk received
+// returning false from f or cancelling ctx closes the connection, which stops the iteration on the server as well
+func (c *ContextClient) IterateMembers(ctx context.Context, guildID int64, f func(chunk []*dstate.MemberState) bool) error {
+	resp, err := c.client.do(ctx, pathIterateMembers, url.Values{
+		"guild_id": {strconv.FormatInt(guildID, 10)},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return missErr(readErrResponse(resp), guildID, 0)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var chunk []*dstate.MemberState
+		if err := dec.Decode(&chunk); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		if len(chunk) < 1 {
+			continue
+		}
+
+		if !f(chunk) {
+			return nil
+		}
+	}
+}
+
+// IterateGuilds streams the matching guilds from the server, calling f once per chunk received
+// the server's tracker has to implement dstate.GuildIterator
+func (c *Client) IterateGuilds(query *dstate.GuildsQuery, f func(chunk []*dstate.GuildState) bool) {
+	params := url.Values{}
+	encodeGuildsQuery(params, query)
+
+	resp, err := c.do(context.Background(), pathIterateGuilds, params)
+	if err != nil {
+		c.handleErr(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		c.handleErr(readErrResponse(resp))
+		return
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var chunk []*dstate.GuildState
+		if err := dec.Decode(&chunk); err != nil {
+			if err != io.EOF {
+				c.handleErr(err)
+			}
+			return
+		}
+
+		if len(chunk) < 1 {
+			continue
+		}
+
+		if !f(chunk) {
+			return
+		}
+	}
+}
+
+// GetStateCounts returns the counts of the server's tracker, which has to implement dstate.GuildIterator
+// returns nil on errors
+func (c *Client) GetStateCounts() *dstate.StateCounts {
+	var counts *dstate.StateCounts
+	err := c.getJSON(context.Background(), pathStateCounts, nil, &counts)
+	if err != nil {
+		c.handleErr(err)
+		return nil
+	}
+
+	return counts
+}
+
+// getJSON performs a get request and decodes the response into dst
+// returns a *errNotFound if the server responded with not found, in which case dst is left untouched
+func (c *Client) getJSON(ctx context.Context, path string, params url.Values, dst interface{}) error {
+	resp, err := c.do(ctx, path, params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readErrResponse(resp)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+func (c *Client) do(ctx context.Context, path string, params url.Values) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.httpClient.Do(req.WithContext(ctx))
+}
+
+// passes err to ErrorHandler, misses are not considered errors by the StateTracker interface so they're ignored
+func (c *Client) handleErr(err error) {
+	if err != nil && !dstate.IsMiss(err) && c.ErrorHandler != nil {
+		c.ErrorHandler(err)
+	}
+}
+
+// errNotFound is returned for not found responses, miss is what was missing according to the server
+type errNotFound struct {
+	miss string
+}
+
+func (e *errNotFound) Error() string {
+	return "remotetracker: " + e.miss + " not found"
+}
+
+// converts errNotFound into the dstate errors
+func missErr(err error, guildID int64, memberID int64) error {
+	nf, ok := err.(*errNotFound)
+	if !ok {
+		return err
+	}
+
+	if nf.miss == missMember {
+		return &dstate.ErrMemberNotCached{GuildID: guildID, MemberID: memberID}
+	}
+
+	return &dstate.ErrGuildNotFound{GuildID: guildID}
+}
+
+func readErrResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return &errNotFound{miss: resp.Header.Get(headerMiss)}
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("remotetracker: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,214 @@
+package remotetracker
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonas747/dstate/v3"
+)
+
+const (
+	pathGuild          = "/v1/guild"
+	pathShardGuilds    = "/v1/shard_guilds"
+	pathMember         = "/v1/member"
+	pathMembers        = "/v1/members"
+	pathMessages       = "/v1/messages"
+	pathIterateMembers = "/v1/members/iterate"
+	pathIterateGuilds  = "/v1/guilds/iterate"
+	pathStateCounts    = "/v1/counts"
+)
+
+const (
+	contentTypeJSON   = "application/json"
+	contentTypeNDJSON = "application/x-ndjson"
+)
+
+// not found responses set this header to what was missing, so the client can tell a unknown guild from a member that's not cached
+const headerMiss = "X-Dstate-Miss"
+
+const (
+	missGuild  = "guild"
+	missMember = "member"
+	missShard  = "shard"
+)
+
+// ids are sent as a single comma separated param, as that's a lot more compact than repeating the param for each id
+func encodeIDs(ids []int64) string {
+	buf := make([]byte, 0, len(ids)*20)
+	for i, id := range ids {
+		if i != 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendInt(buf, id, 10)
+	}
+
+	return string(buf)
+}
+
+func decodeIDs(v string) ([]int64, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	split := strings.Split(v, ",")
+	ids := make([]int64, len(split))
+	for i, s := range split {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+
+	return ids, nil
+}
+
+func encodeMessagesQuery(v url.Values, q *dstate.MessagesQuery) {
+	if q == nil {
+		q = &dstate.MessagesQuery{}
+	}
+
+	if q.Before != 0 {
+		v.Set("before", strconv.FormatInt(q.Before, 10))
+	}
+
+	if q.After != 0 {
+		v.Set("after", strconv.FormatInt(q.After, 10))
+	}
+
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	if q.IncludeDeleted {
+		v.Set("include_deleted", "1")
+	}
+
+	if q.AuthorID != 0 {
+		v.Set("author_id", strconv.FormatInt(q.AuthorID, 10))
+	}
+
+	if q.RoleID != 0 {
+		v.Set("role_id", strconv.FormatInt(q.RoleID, 10))
+	}
+
+	if !q.CreatedAfter.IsZero() {
+		v.Set("created_after", q.CreatedAfter.Format(time.RFC3339Nano))
+	}
+
+	if !q.CreatedBefore.IsZero() {
+		v.Set("created_before", q.CreatedBefore.Format(time.RFC3339Nano))
+	}
+
+	if q.HasAttachments {
+		v.Set("has_attachments", "1")
+	}
+
+	if q.HasEmbeds {
+		v.Set("has_embeds", "1")
+	}
+}
+
+func decodeMessagesQuery(v url.Values) (*dstate.MessagesQuery, error) {
+	q := &dstate.MessagesQuery{}
+
+	var err error
+	if s := v.Get("before"); s != "" {
+		if q.Before, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	if s := v.Get("after"); s != "" {
+		if q.After, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	if s := v.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s := v.Get("author_id"); s != "" {
+		if q.AuthorID, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	if s := v.Get("role_id"); s != "" {
+		if q.RoleID, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	if s := v.Get("created_after"); s != "" {
+		if q.CreatedAfter, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s := v.Get("created_before"); s != "" {
+		if q.CreatedBefore, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			return nil, err
+		}
+	}
+
+	q.IncludeDeleted = v.Get("include_deleted") == "1"
+	q.HasAttachments = v.Get("has_attachments") == "1"
+	q.HasEmbeds = v.Get("has_embeds") == "1"
+
+	return q, nil
+}
+
+func encodeGuildsQuery(v url.Values, q *dstate.GuildsQuery) {
+	if q == nil {
+		return
+	}
+
+	if q.OwnerID != 0 {
+		v.Set("owner_id", strconv.FormatInt(q.OwnerID, 10))
+	}
+
+	if q.Feature != "" {
+		v.Set("feature", q.Feature)
+	}
+
+	if q.MinMemberCount != 0 {
+		v.Set("min_member_count", strconv.FormatInt(q.MinMemberCount, 10))
+	}
+
+	if q.MaxMemberCount != 0 {
+		v.Set("max_member_count", strconv.FormatInt(q.MaxMemberCount, 10))
+	}
+}
+
+func decodeGuildsQuery(v url.Values) (*dstate.GuildsQuery, error) {
+	q := &dstate.GuildsQuery{
+		Feature: v.Get("feature"),
+	}
+
+	var err error
+	if s := v.Get("owner_id"); s != "" {
+		if q.OwnerID, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	if s := v.Get("min_member_count"); s != "" {
+		if q.MinMemberCount, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	if s := v.Get("max_member_count"); s != "" {
+		if q.MaxMemberCount, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	return q, nil
+}
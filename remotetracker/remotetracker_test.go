@@ -0,0 +1,348 @@
+package remotetracker
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dstate/v3"
+	"github.com/jonas747/dstate/v3/inmemorytracker"
+)
+
+var testSession = &discordgo.Session{ShardID: 0, ShardCount: 1}
+
+const testGuildID = 1
+const testChannelID = 10
+const testRoleID = 100
+
+func createTestMember(id int64) *discordgo.Member {
+	return &discordgo.Member{
+		GuildID: testGuildID,
+		Roles:   []int64{testRoleID},
+		User: &discordgo.User{
+			ID:            id,
+			Username:      "test member-" + strconv.FormatInt(id, 10),
+			Discriminator: "0000",
+		},
+	}
+}
+
+func createTestSetup(t *testing.T, numMembers int) (*Client, *httptest.Server) {
+	tracker := inmemorytracker.NewInMemoryTracker(inmemorytracker.TrackerConfig{}, 1)
+
+	members := make([]*discordgo.Member, numMembers)
+	for i := range members {
+		members[i] = createTestMember(int64(1000 + i))
+	}
+
+	tracker.HandleEvent(testSession, &discordgo.GuildCreate{
+		Guild: &discordgo.Guild{
+			ID:          testGuildID,
+			Name:        "test guild",
+			MemberCount: numMembers,
+			Members:     members,
+			Channels: []*discordgo.Channel{
+				{ID: testChannelID, GuildID: testGuildID, Name: "test channel", Type: discordgo.ChannelTypeGuildText},
+			},
+			Roles: []*discordgo.Role{
+				{ID: testRoleID, Name: "test role", Permissions: discordgo.PermissionSendMessages},
+			},
+		},
+	})
+
+	ts := time.Date(2021, 5, 20, 10, 0, 0, 0, time.UTC)
+	for i := int64(0); i < 5; i++ {
+		tracker.HandleEvent(testSession, &discordgo.MessageCreate{
+			Message: &discordgo.Message{
+				ID:        10000 + i,
+				GuildID:   testGuildID,
+				ChannelID: testChannelID,
+				Content:   "test message " + strconv.FormatInt(i, 10),
+				Timestamp: discordgo.Timestamp(ts.Add(time.Minute * time.Duration(i)).Format(time.RFC3339)),
+				Author:    &discordgo.User{ID: 1000 + i%2},
+			},
+		})
+	}
+
+	server := NewServer(tracker)
+	server.MembersChunkSize = 10
+
+	hs := httptest.NewServer(server)
+
+	client := NewClient(hs.URL, nil)
+	client.ErrorHandler = func(err error) {
+		t.Error("client error: ", err)
+	}
+
+	return client, hs
+}
+
+func TestGetGuild(t *testing.T) {
+	client, hs := createTestSetup(t, 1)
+	defer hs.Close()
+
+	gs := client.GetGuild(testGuildID)
+	if gs == nil {
+		t.Fatal("gs is nil")
+	}
+
+	if gs.Name != "test guild" {
+		t.Fatalf("unexpected guild name: %s", gs.Name)
+	}
+
+	if gs.GetChannel(testChannelID) == nil {
+		t.Fatal("channel not found")
+	}
+
+	if r := gs.GetRole(testRoleID); r == nil || r.Permissions != discordgo.PermissionSendMessages {
+		t.Fatal("role not found or incorrect")
+	}
+
+	if client.GetGuild(testGuildID+1) != nil {
+		t.Fatal("expected nil for unknown guild")
+	}
+
+	if len(client.GetShardGuilds(0)) != 1 {
+		t.Fatal("expected 1 guild on shard 0")
+	}
+}
+
+func TestGetMember(t *testing.T) {
+	client, hs := createTestSetup(t, 1)
+	defer hs.Close()
+
+	ms := client.GetMember(testGuildID, 1000)
+	if ms == nil || ms.Member == nil {
+		t.Fatal("ms or ms.Member is nil")
+	}
+
+	if ms.User.Username != "test member-1000" || len(ms.Member.Roles) != 1 || ms.Member.Roles[0] != testRoleID {
+		t.Fatalf("incorrect member: %#v", ms)
+	}
+
+	if client.GetMember(testGuildID, 1) != nil {
+		t.Fatal("expected nil for unknown member")
+	}
+}
+
+func TestGetMembers(t *testing.T) {
+	client, hs := createTestSetup(t, 3)
+	defer hs.Close()
+
+	members, missing := client.GetMembers(testGuildID, []int64{1002, 1, 1000})
+	if len(members) != 3 || members[0] == nil || members[0].User.ID != 1002 || members[1] != nil || members[2] == nil || members[2].User.ID != 1000 {
+		t.Fatalf("members not aligned with ids: %#v", members)
+	}
+
+	if len(missing) != 1 || missing[0] != 1 {
+		t.Fatal("unexpected missing ids: ", missing)
+	}
+
+	members, missing = client.GetMembers(testGuildID, nil)
+	if len(members) != 0 || len(missing) != 0 {
+		t.Fatal("expected no results for no ids")
+	}
+}
+
+func TestGetMessages(t *testing.T) {
+	client, hs := createTestSetup(t, 1)
+	defer hs.Close()
+
+	buf := make([]*dstate.MessageState, 0, 10)
+	messages := client.GetMessages(testGuildID, testChannelID, &dstate.MessagesQuery{
+		Buf:    buf,
+		Before: 10004,
+		Limit:  3,
+	})
+
+	if len(messages) != 3 {
+		t.Fatalf("unexpected amount of messages: %d", len(messages))
+	}
+
+	if &messages[:1][0] != &buf[:1][0] {
+		t.Fatal("buffer was not reused")
+	}
+
+	for i, v := range []int64{10003, 10002, 10001} {
+		if messages[i].ID != v {
+			t.Fatalf("unexpected message at [%d]: %d, expected %d", i, messages[i].ID, v)
+		}
+	}
+}
+
+func TestGetMessagesFilters(t *testing.T) {
+	client, hs := createTestSetup(t, 1)
+	defer hs.Close()
+
+	ts := time.Date(2021, 5, 20, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		query    *dstate.MessagesQuery
+		expected []int64
+	}{
+		{&dstate.MessagesQuery{AuthorID: 1000}, []int64{10004, 10002, 10000}},
+		{&dstate.MessagesQuery{AuthorID: 1000, Limit: 2}, []int64{10004, 10002}},
+		// only member 1000 is cached with the role
+		{&dstate.MessagesQuery{RoleID: testRoleID}, []int64{10004, 10002, 10000}},
+		{&dstate.MessagesQuery{CreatedAfter: ts, CreatedBefore: ts.Add(time.Minute * 3)}, []int64{10002, 10001}},
+		{&dstate.MessagesQuery{HasEmbeds: true}, []int64{}},
+		{&dstate.MessagesQuery{
+			Limit: 1,
+			Predicate: func(m *dstate.MessageState) bool {
+				return m.Content == "test message 1" || m.Content == "test message 3"
+			},
+		}, []int64{10003}},
+		// has to page through the messages to find enough matches
+		{&dstate.MessagesQuery{
+			Limit: 2,
+			Predicate: func(m *dstate.MessageState) bool {
+				return m.Content == "test message 1" || m.Content == "test message 3"
+			},
+		}, []int64{10003, 10001}},
+		{nil, []int64{10004, 10003, 10002, 10001, 10000}},
+	}
+
+	for i, c := range cases {
+		messages := client.GetMessages(testGuildID, testChannelID, c.query)
+		if len(messages) != len(c.expected) {
+			t.Fatalf("case %d: unexpected amount of messages: %d, expected: %d", i, len(messages), len(c.expected))
+		}
+
+		for j, v := range c.expected {
+			if messages[j].ID != v {
+				t.Fatalf("case %d: unexpected message at [%d]: %d, expected %d", i, j, messages[j].ID, v)
+			}
+		}
+	}
+}
+
+func TestIterateMembers(t *testing.T) {
+	client, hs := createTestSetup(t, 35)
+	defer hs.Close()
+
+	chunks := 0
+	seen := make(map[int64]bool)
+	client.IterateMembers(testGuildID, func(chunk []*dstate.MemberState) bool {
+		chunks++
+		for _, v := range chunk {
+			seen[v.User.ID] = true
+		}
+		return true
+	})
+
+	if chunks != 4 {
+		t.Fatalf("unexpected amount of chunks: %d", chunks)
+	}
+
+	if len(seen) != 35 {
+		t.Fatalf("unexpected amount of members: %d", len(seen))
+	}
+
+	// stopping early
+	chunks = 0
+	client.IterateMembers(testGuildID, func(chunk []*dstate.MemberState) bool {
+		chunks++
+		return false
+	})
+
+	if chunks != 1 {
+		t.Fatalf("iteration did not stop, chunks: %d", chunks)
+	}
+}
+
+func TestIterateGuilds(t *testing.T) {
+	client, hs := createTestSetup(t, 5)
+	defer hs.Close()
+
+	var guilds []*dstate.GuildState
+	client.IterateGuilds(&dstate.GuildsQuery{MinMemberCount: 5}, func(chunk []*dstate.GuildState) bool {
+		guilds = append(guilds, chunk...)
+		return true
+	})
+
+	if len(guilds) != 1 || guilds[0].ID != testGuildID {
+		t.Fatalf("unexpected guilds: %#v", guilds)
+	}
+
+	client.IterateGuilds(&dstate.GuildsQuery{MinMemberCount: 6}, func(chunk []*dstate.GuildState) bool {
+		t.Fatal("f called with no matching guilds")
+		return true
+	})
+	// nil matches everything
+	guilds = nil
+	client.IterateGuilds(nil, func(chunk []*dstate.GuildState) bool {
+		guilds = append(guilds, chunk...)
+		return true
+	})
+
+	if len(guilds) != 1 {
+		t.Fatalf("unexpected guilds: %#v", guilds)
+	}
+}
+
+func TestGetStateCounts(t *testing.T) {
+	client, hs := createTestSetup(t, 5)
+	defer hs.Close()
+
+	counts := client.GetStateCounts()
+	expected := dstate.StateCounts{
+		Guilds:         1,
+		Members:        5,
+		CachedMembers:  5,
+		CachedMessages: 5,
+	}
+
+	if counts == nil || *counts != expected {
+		t.Fatalf("incorrect counts: %#v, expected: %#v", counts, expected)
+	}
+}
+
+func TestContextClient(t *testing.T) {
+	client, hs := createTestSetup(t, 1)
+	defer hs.Close()
+
+	cc := client.WithContext()
+	ctx := context.Background()
+
+	if _, err := cc.GetGuild(ctx, 999); err == nil {
+		t.Fatal("expected error for unknown guild")
+	} else if is, id := dstate.IsGuildNotFound(err); !is || id != 999 {
+		t.Fatal("expected ErrGuildNotFound, got: ", err)
+	}
+
+	if _, err := cc.GetMember(ctx, 999, 1000); err == nil {
+		t.Fatal("expected error for unknown guild")
+	} else if is, _ := dstate.IsGuildNotFound(err); !is {
+		t.Fatal("expected ErrGuildNotFound, got: ", err)
+	}
+
+	if _, err := cc.GetMember(ctx, testGuildID, 5000); err == nil {
+		t.Fatal("expected error for unknown member")
+	} else if is, id := dstate.IsMemberNotCached(err); !is || id != 5000 {
+		t.Fatal("expected ErrMemberNotCached, got: ", err)
+	}
+
+	if ms, err := cc.GetMember(ctx, testGuildID, 1000); err != nil || ms == nil {
+		t.Fatal("expected member, got error: ", err)
+	}
+
+	if _, err := cc.GetShardGuilds(ctx, 5); err == nil {
+		t.Fatal("expected error for unknown shard")
+	} else if is, _ := dstate.IsShardNotFound(err); !is {
+		t.Fatal("expected ErrShardNotFound, got: ", err)
+	}
+
+	if err := cc.IterateMembers(ctx, 999, func(chunk []*dstate.MemberState) bool { return true }); err == nil {
+		t.Fatal("expected error for unknown guild")
+	} else if is, _ := dstate.IsGuildNotFound(err); !is {
+		t.Fatal("expected ErrGuildNotFound, got: ", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := cc.GetGuild(cancelled, testGuildID); err == nil || dstate.IsMiss(err) {
+		t.Fatal("expected context error, got: ", err)
+	}
+}
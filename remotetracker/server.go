@@ -0,0 +1,277 @@
+package remotetracker
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/jonas747/dstate/v3"
+)
+
+const DefaultMembersChunkSize = 1000
+
+// Server exposes a dstate.StateTracker over http, meant to be used with Client
+// for example for having the state live in a seperate gateway process and querying it from workers
+type Server struct {
+	tracker dstate.StateTracker
+	mux     *http.ServeMux
+
+	// The max amount of members sent in a single chunk in IterateMembers
+	MembersChunkSize int
+}
+
+func NewServer(tracker dstate.StateTracker) *Server {
+	s := &Server{
+		tracker:          tracker,
+		mux:              http.NewServeMux(),
+		MembersChunkSize: DefaultMembersChunkSize,
+	}
+
+	s.mux.HandleFunc(pathGuild, s.handleGetGuild)
+	s.mux.HandleFunc(pathShardGuilds, s.handleGetShardGuilds)
+	s.mux.HandleFunc(pathMember, s.handleGetMember)
+	s.mux.HandleFunc(pathMembers, s.handleGetMembers)
+	s.mux.HandleFunc(pathMessages, s.handleGetMessages)
+	s.mux.HandleFunc(pathIterateMembers, s.handleIterateMembers)
+	s.mux.HandleFunc(pathIterateGuilds, s.handleIterateGuilds)
+	s.mux.HandleFunc(pathStateCounts, s.handleGetStateCounts)
+
+	return s
+}
+
+// Serve serves the state on the provided listener, this can be a unix socket or tcp listener
+// blocks until the listener is closed
+func (s *Server) Serve(l net.Listener) error {
+	return http.Serve(l, s)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleGetGuild(w http.ResponseWriter, r *http.Request) {
+	guildID, ok := parseIntParam(w, r, "guild_id")
+	if !ok {
+		return
+	}
+
+	gs := s.tracker.GetGuild(guildID)
+	if gs == nil {
+		writeNotFound(w, missGuild)
+		return
+	}
+
+	writeJSON(w, gs)
+}
+
+func (s *Server) handleGetShardGuilds(w http.ResponseWriter, r *http.Request) {
+	shardID, ok := parseIntParam(w, r, "shard_id")
+	if !ok {
+		return
+	}
+
+	// GetShardGuilds panics on unknown shards
+	if !dstate.ShardInRange(s.tracker, shardID) {
+		writeNotFound(w, missShard)
+		return
+	}
+
+	writeJSON(w, s.tracker.GetShardGuilds(shardID))
+}
+
+func (s *Server) handleGetMember(w http.ResponseWriter, r *http.Request) {
+	guildID, ok := parseIntParam(w, r, "guild_id")
+	if !ok {
+		return
+	}
+
+	memberID, ok := parseIntParam(w, r, "member_id")
+	if !ok {
+		return
+	}
+
+	ms := s.tracker.GetMember(guildID, memberID)
+	if ms == nil {
+		if s.tracker.GetGuild(guildID) == nil {
+			writeNotFound(w, missGuild)
+		} else {
+			writeNotFound(w, missMember)
+		}
+		return
+	}
+
+	writeJSON(w, ms)
+}
+
+// handleGetMembers responds with a array aligned with the member_ids param, with null for the members that were not found
+func (s *Server) handleGetMembers(w http.ResponseWriter, r *http.Request) {
+	guildID, ok := parseIntParam(w, r, "guild_id")
+	if !ok {
+		return
+	}
+
+	ids, err := decodeIDs(r.URL.Query().Get("member_ids"))
+	if err != nil {
+		http.Error(w, "invalid member_ids", http.StatusBadRequest)
+		return
+	}
+
+	members, _ := dstate.GetMembers(s.tracker, guildID, ids)
+	writeJSON(w, members)
+}
+
+func (s *Server) handleGetMessages(w http.ResponseWriter, r *http.Request) {
+	guildID, ok := parseIntParam(w, r, "guild_id")
+	if !ok {
+		return
+	}
+
+	channelID, ok := parseIntParam(w, r, "channel_id")
+	if !ok {
+		return
+	}
+
+	query, err := decodeMessagesQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	messages := s.tracker.GetMessages(guildID, channelID, query)
+	if messages == nil {
+		if s.tracker.GetGuild(guildID) == nil {
+			writeNotFound(w, missGuild)
+			return
+		}
+
+		// make sure we send a empty array instead of null
+		messages = []*dstate.MessageState{}
+	}
+
+	writeJSON(w, messages)
+}
+
+// handleIterateMembers streams the members as newline delimited json arrays, one line per chunk
+// the client can stop the iteration at any point by closing the connection
+func (s *Server) handleIterateMembers(w http.ResponseWriter, r *http.Request) {
+	guildID, ok := parseIntParam(w, r, "guild_id")
+	if !ok {
+		return
+	}
+
+	if s.tracker.GetGuild(guildID) == nil {
+		writeNotFound(w, missGuild)
+		return
+	}
+
+	chunkSize := s.MembersChunkSize
+	if chunkSize < 1 {
+		chunkSize = DefaultMembersChunkSize
+	}
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", contentTypeNDJSON)
+
+	enc := json.NewEncoder(w)
+	ctx := r.Context()
+
+	s.tracker.IterateMembers(guildID, func(chunk []*dstate.MemberState) bool {
+		for len(chunk) > 0 {
+			if ctx.Err() != nil {
+				// client went away
+				return false
+			}
+
+			n := chunkSize
+			if n > len(chunk) {
+				n = len(chunk)
+			}
+
+			if err := enc.Encode(chunk[:n]); err != nil {
+				return false
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+
+			chunk = chunk[n:]
+		}
+
+		return true
+	})
+}
+
+// handleIterateGuilds streams the guilds the same way as handleIterateMembers
+// only available if the tracker implements dstate.GuildIterator
+func (s *Server) handleIterateGuilds(w http.ResponseWriter, r *http.Request) {
+	iter, ok := s.tracker.(dstate.GuildIterator)
+	if !ok {
+		http.Error(w, "tracker does not support iterating guilds", http.StatusNotImplemented)
+		return
+	}
+
+	query, err := decodeGuildsQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", contentTypeNDJSON)
+
+	enc := json.NewEncoder(w)
+	ctx := r.Context()
+
+	iter.IterateGuilds(query, func(chunk []*dstate.GuildState) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		if err := enc.Encode(chunk); err != nil {
+			return false
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		return true
+	})
+}
+
+func (s *Server) handleGetStateCounts(w http.ResponseWriter, r *http.Request) {
+	iter, ok := s.tracker.(dstate.GuildIterator)
+	if !ok {
+		http.Error(w, "tracker does not support state counts", http.StatusNotImplemented)
+		return
+	}
+
+	writeJSON(w, iter.GetStateCounts())
+}
+
+func parseIntParam(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	v, err := strconv.ParseInt(r.URL.Query().Get(name), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid "+name, http.StatusBadRequest)
+		return 0, false
+	}
+
+	return v, true
+}
+
+func writeNotFound(w http.ResponseWriter, miss string) {
+	w.Header().Set(headerMiss, miss)
+	http.Error(w, miss+" not found", http.StatusNotFound)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,108 @@
+package dstate
+
+import "github.com/jonas747/discordgo"
+
+// Thread channel types, not yet present in discordgo
+const (
+	ChannelTypeGuildNewsThread    discordgo.ChannelType = 10
+	ChannelTypeGuildPublicThread  discordgo.ChannelType = 11
+	ChannelTypeGuildPrivateThread discordgo.ChannelType = 12
+)
+
+func IsThreadType(t discordgo.ChannelType) bool {
+	return t == ChannelTypeGuildNewsThread || t == ChannelTypeGuildPublicThread || t == ChannelTypeGuildPrivateThread
+}
+
+type ThreadMetadata struct {
+	Archived bool `json:"archived"`
+	Locked   bool `json:"locked"`
+
+	// Duration in minutes of inactivity before the thread is automatically archived
+	AutoArchiveDuration int                 `json:"auto_archive_duration"`
+	ArchiveTimestamp    discordgo.Timestamp `json:"archive_timestamp"`
+}
+
+type ThreadMember struct {
+	// The ID of the thread
+	ID            int64               `json:"id,string"`
+	UserID        int64               `json:"user_id,string"`
+	JoinTimestamp discordgo.Timestamp `json:"join_timestamp"`
+	Flags         int                 `json:"flags"`
+}
+
+// The types below mirror the thread related gateway payloads, as discordgo does not decode them yet.
+// They can be decoded from the raw event data and passed to a trackers HandleEvent like any other event.
+
+// ThreadChannel is a discordgo.Channel with the additional thread fields
+type ThreadChannel struct {
+	discordgo.Channel
+
+	OwnerID      int64           `json:"owner_id,string"`
+	MemberCount  int             `json:"member_count"`
+	MessageCount int             `json:"message_count"`
+	Metadata     *ThreadMetadata `json:"thread_metadata"`
+}
+
+type ThreadCreate struct {
+	*ThreadChannel
+}
+
+type ThreadUpdate struct {
+	*ThreadChannel
+}
+
+type ThreadDelete struct {
+	*ThreadChannel
+}
+
+// ThreadListSync is sent when gaining access to channels, it contains all the active threads in them
+// if ChannelIDs is empty then the threads are for the whole guild.
+//
+// discordgo's GuildCreate does not include the guild's active threads, these should be passed as a
+// ThreadListSync without ChannelIDs after the GuildCreate
+type ThreadListSync struct {
+	GuildID    int64             `json:"guild_id,string"`
+	ChannelIDs discordgo.IDSlice `json:"channel_ids,string"`
+	Threads    []*ThreadChannel  `json:"threads"`
+	Members    []*ThreadMember   `json:"members"`
+}
+
+func (t *ThreadListSync) GetGuildID() int64 {
+	return t.GuildID
+}
+
+// ThreadMemberUpdate is sent when the thread member object for the current user is updated
+type ThreadMemberUpdate struct {
+	*ThreadMember
+	GuildID int64 `json:"guild_id,string"`
+}
+
+func (t *ThreadMemberUpdate) GetGuildID() int64 {
+	return t.GuildID
+}
+
+type ThreadMembersUpdate struct {
+	ID               int64             `json:"id,string"`
+	GuildID          int64             `json:"guild_id,string"`
+	MemberCount      int               `json:"member_count"`
+	AddedMembers     []*ThreadMember   `json:"added_members"`
+	RemovedMemberIDs discordgo.IDSlice `json:"removed_member_ids,string"`
+}
+
+func (t *ThreadMembersUpdate) GetGuildID() int64 {
+	return t.GuildID
+}
+
+func ChannelStateFromThread(t *ThreadChannel) ChannelState {
+	cs := ChannelStateFromDgo(&t.Channel)
+	cs.OwnerID = t.OwnerID
+	cs.MemberCount = t.MemberCount
+	cs.MessageCount = t.MessageCount
+
+	if t.Metadata != nil {
+		md := *t.Metadata
+		cs.ThreadMetadata = &md
+	}
+
+	return cs
+}
@@ -0,0 +1,25 @@
+package dstate
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeThreadCreate(t *testing.T) {
+	payload := `{"id":"20","guild_id":"1","parent_id":"10","owner_id":"1000","type":11,"name":"thread","member_count":2,"message_count":5,
+	"thread_metadata":{"archived":true,"auto_archive_duration":1440,"archive_timestamp":"2021-05-20T10:00:00.000000+00:00","locked":false}}`
+
+	var evt ThreadCreate
+	if err := json.Unmarshal([]byte(payload), &evt); err != nil {
+		t.Fatal("failed decoding: ", err)
+	}
+
+	cs := ChannelStateFromThread(evt.ThreadChannel)
+	if cs.ID != 20 || cs.GuildID != 1 || cs.ParentID != 10 || cs.OwnerID != 1000 || cs.MemberCount != 2 || cs.MessageCount != 5 {
+		t.Fatalf("incorrect thread: %#v", cs)
+	}
+
+	if !cs.IsThread() || cs.ThreadMetadata == nil || !cs.ThreadMetadata.Archived || cs.ThreadMetadata.AutoArchiveDuration != 1440 {
+		t.Fatalf("incorrect thread metadata: %#v", cs.ThreadMetadata)
+	}
+}